@@ -6,23 +6,60 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"xcloudflow/internal/authn"
 	"xcloudflow/internal/mcp"
+	"xcloudflow/internal/metrics"
 	"xcloudflow/internal/store"
 )
 
 // xcloud-server is the stateless control plane entrypoint intended for Cloud Run.
 //
 // Endpoints:
-// - GET  /healthz
-// - POST /mcp   (minimal JSON-RPC handler)
+//   - GET  /healthz  (liveness: the process is up)
+//   - GET  /readyz   (readiness: 503 while the database does not answer a
+//     ping; always ready without DATABASE_URL)
+//   - GET  /metrics  (Prometheus text format: tool calls and latency by tool
+//     and status, DB pool stats, runs by stack/phase/status)
+//   - POST /mcp   (MCP JSON-RPC; with a store it also federates the registered
+//     external MCP servers as "<server>.<tool>", see mcp.Gateway, and audits
+//     every tools/call into xcf.mcp_audit)
+//
+// /mcp is open unless -auth-tokens or -auth-issuer/-auth-audience/-auth-jwks
+// are set (see package authn); callers need xcf:apply for "*.apply" tools.
 //
 // State/memory is persisted in PostgreSQL (postgresql.svc.plus) when DATABASE_URL is provided.
 func main() {
 	var addr string
+	var gateway bool
+	var auth authn.Config
+	var defaultScopes, redact string
+	var limits mcp.Limits
+	var timeouts mcp.HTTPTimeouts
 	flag.StringVar(&addr, "addr", "", "listen address (default :$PORT or :8080)")
+	flag.BoolVar(&gateway, "gateway", true, "federate tools of registered MCP servers (requires DATABASE_URL)")
+	flag.StringVar(&auth.TokensRef, "auth-tokens", "", "static bearer tokens file as a secret ref (env:NAME|file:PATH)")
+	flag.StringVar(&auth.Issuer, "auth-issuer", "", "accept JWTs from this issuer")
+	flag.StringVar(&auth.Audience, "auth-audience", "", "required JWT audience")
+	flag.StringVar(&auth.JWKS, "auth-jwks", "", "JWKS file path or http(s) URL")
+	flag.StringVar(&defaultScopes, "auth-default-scopes", authn.ScopeRead, "comma-separated scopes for JWTs without a scope claim")
+	flag.StringVar(&redact, "audit-redact", "", "comma-separated extra argument key globs to redact in the audit trail")
+	flag.Int64Var(&limits.MaxRequestBytes, "max-request-bytes", 4<<20, "maximum request body size")
+	flag.DurationVar(&limits.ToolTimeout, "tool-timeout", 60*time.Second, "default tool execution timeout")
+	flag.IntVar(&limits.MaxConcurrent, "max-concurrent", 64, "maximum in-flight tool calls (negative: unlimited)")
+	flag.IntVar(&limits.MaxConcurrentPerCaller, "max-concurrent-per-caller", 8, "maximum in-flight tool calls per caller (negative: unlimited)")
+	flag.Float64Var(&limits.Rate, "rate", 50, "tool calls per second across all callers (negative: unlimited)")
+	flag.IntVar(&limits.Burst, "burst", 0, "token bucket size for -rate (0: 2x -rate)")
+	flag.Float64Var(&limits.CallerRate, "caller-rate", 10, "tool calls per second per caller (negative: unlimited)")
+	flag.IntVar(&limits.CallerBurst, "caller-burst", 0, "token bucket size for -caller-rate (0: 2x -caller-rate)")
+	flag.IntVar(&limits.TrustedProxyHops, "trusted-proxy-hops", 0, "proxies appending to X-Forwarded-For (Cloud Run: 1); anonymous callers are keyed by that client address (0: TCP peer)")
+	flag.DurationVar(&timeouts.Read, "read-timeout", 30*time.Second, "HTTP read timeout")
+	flag.DurationVar(&timeouts.Write, "write-timeout", 150*time.Second, "HTTP write timeout (must exceed the longest tool timeout)")
+	flag.DurationVar(&timeouts.Idle, "idle-timeout", 120*time.Second, "HTTP keep-alive idle timeout")
 	flag.Parse()
+	auth.DefaultScopes = strings.Split(defaultScopes, ",")
 
 	if addr == "" {
 		if p := os.Getenv("PORT"); p != "" {
@@ -33,7 +70,7 @@ func main() {
 	}
 
 	dsn := os.Getenv("DATABASE_URL")
-	var st *store.Store
+	var st store.Store
 	if dsn != "" {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -46,16 +83,49 @@ func main() {
 		defer st.Close()
 	}
 
-	srv := mcp.NewServer(mcp.ServerOptions{Store: st})
+	verifier, err := auth.Verifier()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "auth:", err)
+		os.Exit(1)
+	}
+	var extra []string
+	if redact != "" {
+		extra = strings.Split(redact, ",")
+	}
+	redactor, err := mcp.NewRedactor(extra)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "audit:", err)
+		os.Exit(1)
+	}
+	reg := metrics.NewRegistry()
+	if st != nil {
+		store.RegisterMetrics(reg, st)
+	}
+	opts := mcp.ServerOptions{Store: st, Auth: verifier, Redactor: redactor, Limits: limits, Metrics: reg}
+	if gateway && st != nil {
+		opts.Gateway = mcp.NewGateway(st, mcp.GatewayOptions{})
+	}
+	srv := mcp.NewServer(opts)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := st.(store.Pinger); ok {
+			ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+			defer cancel()
+			if err := p.Ping(ctx); err != nil {
+				http.Error(w, "database: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("/metrics", reg)
 	mux.Handle("/mcp", srv)
 
 	fmt.Println("listening on", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	if err := mcp.NewHTTPServer(addr, mux, timeouts).ListenAndServe(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
-
@@ -0,0 +1,43 @@
+package authn
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestXconfigCopyInSync fails when xconfig's copies of authn and secrets
+// drift from these packages. Only the package doc comment and import paths
+// may differ; fix by copying this module's files over.
+func TestXconfigCopyInSync(t *testing.T) {
+	root := filepath.Join("..", "..", "xconfig", "internal")
+	if _, err := os.Stat(root); err != nil {
+		t.Skip("xconfig not checked out")
+	}
+	for _, f := range []string{
+		"authn/authn.go", "authn/tokens.go", "authn/jwt.go", "authn/authn_test.go",
+		"secrets/secrets.go", "secrets/secrets_test.go",
+	} {
+		want, err := os.ReadFile(filepath.Join("..", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(root, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stripDocAndImports(string(got)) != stripDocAndImports(string(want)) {
+			t.Errorf("xconfig/internal/%s differs from internal/%s", f, f)
+		}
+	}
+}
+
+// stripDocAndImports drops everything before the package clause and rewrites
+// the module prefix of internal imports.
+func stripDocAndImports(src string) string {
+	if i := strings.Index(src, "\npackage "); i >= 0 {
+		src = src[i+1:]
+	}
+	return strings.ReplaceAll(src, `"xconfig/internal/`, `"xcloudflow/internal/`)
+}
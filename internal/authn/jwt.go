@@ -0,0 +1,396 @@
+package authn
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // register SHA-384/512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTVerifier accepts RS256/384/512 and ES256/384 signed JWTs issued by
+// Issuer for Audience, signed by a key from Keys.
+//
+// The subject is the "email" claim when present (OIDC ID tokens of service
+// accounts), else "sub". Scopes come from "scope" (space separated) or "scp"
+// (string or array); tokens without any get DefaultScopes.
+type JWTVerifier struct {
+	Issuer        string
+	Audience      string
+	Keys          *JWKS
+	DefaultScopes []string
+	// Leeway tolerates clock skew on exp/nbf/iat (default 1m).
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Iss   string          `json:"iss"`
+	Sub   string          `json:"sub"`
+	Email string          `json:"email"`
+	Aud   json.RawMessage `json:"aud"`
+	Exp   *float64        `json:"exp"`
+	Nbf   *float64        `json:"nbf"`
+	Iat   *float64        `json:"iat"`
+	Scope string          `json:"scope"`
+	Scp   json.RawMessage `json:"scp"`
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+	var hdr jwtHeader
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return Identity{}, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	key, err := v.Keys.Key(ctx, hdr.Kid)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := verifySignature(hdr.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var c jwtClaims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Identity{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(c); err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	id := Identity{Subject: c.Email, Scopes: c.scopes()}
+	if id.Subject == "" {
+		id.Subject = c.Sub
+	}
+	if id.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: no sub or email claim", ErrInvalidToken)
+	}
+	if len(id.Scopes) == 0 {
+		id.Scopes = v.DefaultScopes
+	}
+	return id, nil
+}
+
+func (v *JWTVerifier) checkClaims(c jwtClaims) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	leeway := v.Leeway
+	if leeway == 0 {
+		leeway = time.Minute
+	}
+	if c.Iss != v.Issuer {
+		return fmt.Errorf("issuer %q not accepted", c.Iss)
+	}
+	if !audienceContains(c.Aud, v.Audience) {
+		return fmt.Errorf("audience does not include %q", v.Audience)
+	}
+	if c.Exp == nil {
+		return errors.New("no exp claim")
+	}
+	if now.After(unixTime(*c.Exp).Add(leeway)) {
+		return errors.New("token expired")
+	}
+	if c.Nbf != nil && now.Add(leeway).Before(unixTime(*c.Nbf)) {
+		return errors.New("token not valid yet")
+	}
+	if c.Iat != nil && now.Add(leeway).Before(unixTime(*c.Iat)) {
+		return errors.New("token issued in the future")
+	}
+	return nil
+}
+
+func (c jwtClaims) scopes() []string {
+	if c.Scope != "" {
+		return strings.Fields(c.Scope)
+	}
+	var list []string
+	if json.Unmarshal(c.Scp, &list) == nil {
+		return list
+	}
+	var s string
+	if json.Unmarshal(c.Scp, &s) == nil {
+		return strings.Fields(s)
+	}
+	return nil
+}
+
+func audienceContains(raw json.RawMessage, want string) bool {
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return one == want
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, a := range many {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return fmt.Errorf("alg %s does not match RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return errors.New("bad signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		// RFC 7518 §3.4: each ES alg is bound to one curve.
+		curve := map[string]string{"ES256": "P-256", "ES384": "P-384"}[alg]
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if curve == "" || k.Curve.Params().Name != curve || len(sig) != 2*size {
+			return fmt.Errorf("alg %s does not match EC key", alg)
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("bad signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// JWKS is a JSON Web Key Set read from a local file or an http(s) URL.
+// It is cached for TTL; a token with an unknown kid triggers an early
+// refresh, at most once per minute, so key rotation works without restarts.
+type JWKS struct {
+	Location string
+	HTTP     *http.Client
+	// TTL is how long a fetched set is used (default 1h).
+	TTL time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+const jwksMinRefresh = time.Minute
+
+// Key returns the key with the given kid. An empty kid matches a set with
+// exactly one key.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	ttl := j.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	age := time.Since(j.fetchedAt)
+	if j.keys == nil || age > ttl {
+		if err := j.refreshLocked(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if k, ok := j.lookupLocked(kid); ok {
+		return k, nil
+	}
+	if time.Since(j.fetchedAt) > jwksMinRefresh {
+		if err := j.refreshLocked(ctx); err != nil {
+			return nil, err
+		}
+		if k, ok := j.lookupLocked(kid); ok {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("no key %q in JWKS", kid)
+}
+
+func (j *JWKS) lookupLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+func (j *JWKS) refreshLocked(ctx context.Context) error {
+	raw, err := j.read(ctx)
+	if err != nil {
+		return fmt.Errorf("jwks %s: %w", j.Location, err)
+	}
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return fmt.Errorf("jwks %s: %w", j.Location, err)
+	}
+	j.keys, j.fetchedAt = keys, time.Now()
+	return nil
+}
+
+func (j *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.Location, "https://") && !strings.HasPrefix(j.Location, "http://") {
+		return os.ReadFile(j.Location)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.Location, nil)
+	if err != nil {
+		return nil, err
+	}
+	hc := j.HTTP
+	if hc == nil {
+		hc = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS decodes the RSA and EC (P-256, P-384) signing keys of a JWKS by
+// kid. Other key types are skipped.
+func ParseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(raw), &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var pub crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			pub, err = k.rsa()
+		case "EC":
+			pub, err = k.ec()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("bad RSA parameters")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+func (k jwk) ec() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("point not on curve")
+	}
+	return pub, nil
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -27,6 +29,10 @@ func agentRunCmd() *cobra.Command {
 	var env string
 	var interval time.Duration
 	var once bool
+	var apply bool
+	var heartbeat, staleAfter time.Duration
+	var pruneEvery time.Duration
+	var retention store.RetentionPolicy
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Run validate + dns-plan in a loop and persist runs to PostgreSQL",
@@ -38,11 +44,19 @@ func agentRunCmd() *cobra.Command {
 			if configPath == "" {
 				return fmt.Errorf("missing --config")
 			}
+			if apply && env == "" {
+				return fmt.Errorf("--apply requires --env: approvals are bound to a stack and env")
+			}
 			if once {
 				interval = 0
 			}
+			phase := "validate+dns-plan"
+			if apply {
+				phase += "+dns-apply"
+			}
 
-			ctx := context.Background()
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
 			st, err := store.Open(ctx, dsn)
 			if err != nil {
 				return err
@@ -69,47 +83,116 @@ func agentRunCmd() *cobra.Command {
 				runID, err := st.CreateRun(ctx, store.Run{
 					Stack:     stackName,
 					Env:       env,
-					Phase:     "validate+dns-plan",
-					Status:    "running",
+					Phase:     phase,
+					Status:    store.RunRunning,
 					ConfigRef: configPath,
 				})
 				if err != nil {
 					return err
 				}
+				stopHeartbeat := startHeartbeat(ctx, st, runID, heartbeat)
+				defer stopHeartbeat()
+
+				fail := func(err error) error {
+					stopHeartbeat()
+					status := store.RunFailed
+					if ctx.Err() != nil {
+						status = store.RunCancelled
+					}
+					// Use a fresh context so cancellation is still recorded after SIGINT.
+					fctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					_ = st.FinishRun(fctx, runID, status, []byte(fmt.Sprintf(`{"error":%q}`, err.Error())))
+					return err
+				}
 
 				val, err := stackflow.Validate(cfg)
 				if err != nil {
-					_ = st.FinishRun(ctx, runID, "failed", []byte(fmt.Sprintf(`{"error":%q}`, err.Error())))
-					return err
+					return fail(err)
+				}
+				if ctx.Err() != nil {
+					return fail(ctx.Err())
 				}
 
 				plan, err := stackflow.DNSPlan(cfg, env)
 				if err != nil {
-					_ = st.FinishRun(ctx, runID, "failed", []byte(fmt.Sprintf(`{"error":%q}`, err.Error())))
-					return err
+					return fail(err)
 				}
 
 				out := map[string]any{
 					"validate": val,
 					"dnsPlan":  plan,
 				}
+				if apply {
+					// The apply phase only runs for a plan approved for this
+					// stack/env, the same gate MCP apply tools go through.
+					pb, err := json.Marshal(plan)
+					if err != nil {
+						return fail(err)
+					}
+					a, err := store.CheckApproval(ctx, st, stackName, env, pb)
+					if err != nil {
+						return fail(err)
+					}
+					out["dnsApply"] = map[string]any{
+						"approval_id": a.ApprovalID,
+						"plan_hash":   a.PlanHash,
+						"approved_by": a.DecidedBy,
+					}
+				}
 				rb, _ := json.Marshal(out)
-				if err := st.FinishRun(ctx, runID, "ok", rb); err != nil {
+				stopHeartbeat()
+				if err := st.FinishRun(ctx, runID, store.RunOK, rb); err != nil {
 					return err
 				}
 				return nil
 			}
 
+			reap := func() {
+				if staleAfter <= 0 {
+					return
+				}
+				ids, err := st.ReapStaleRuns(ctx, staleAfter)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "reap failed:", err)
+					return
+				}
+				for _, id := range ids {
+					fmt.Fprintln(os.Stderr, "reaped stale run:", id)
+				}
+			}
+
+			var lastPrune time.Time
+			prune := func() {
+				if pruneEvery <= 0 || time.Since(lastPrune) < pruneEvery {
+					return
+				}
+				lastPrune = time.Now()
+				rep, err := st.Prune(ctx, retention)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "prune failed:", err)
+					return
+				}
+				fmt.Fprintf(os.Stderr, "pruned: runs=%d agent_events=%d mcp_tools_cache=%d mcp_audit=%d\n", rep.Runs, rep.AgentEvents, rep.ToolsCache, rep.Audit)
+			}
+
 			if interval == 0 {
+				reap()
 				return doOnce()
 			}
 			t := time.NewTicker(interval)
 			defer t.Stop()
 			for {
+				reap()
+				prune()
 				if err := doOnce(); err != nil {
 					fmt.Fprintln(os.Stderr, "run failed:", err)
 				}
-				<-t.C
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-t.C:
+				}
 			}
 		},
 	}
@@ -117,6 +200,41 @@ func agentRunCmd() *cobra.Command {
 	cmd.Flags().StringVar(&env, "env", "", "Optional env name (global.environments.<env>)")
 	cmd.Flags().DurationVar(&interval, "interval", 10*time.Minute, "Run interval (0 to run once)")
 	cmd.Flags().BoolVar(&once, "once", false, "Run once and exit")
+	cmd.Flags().BoolVar(&apply, "apply", false, "Also run the dns-apply phase; the run fails unless the DNS plan is approved for the stack and --env (see approvals)")
+	cmd.Flags().DurationVar(&heartbeat, "heartbeat", 30*time.Second, "Heartbeat interval for in-progress runs")
+	cmd.Flags().DurationVar(&staleAfter, "stale-after", 5*time.Minute, "Mark running runs without a heartbeat for this long as timed_out (0 disables the reaper)")
+	cmd.Flags().DurationVar(&pruneEvery, "prune-every", 0, "Apply the retention policy at this interval (0 disables pruning)")
+	cmd.Flags().DurationVar(&retention.MaxAge, "prune-max-age", 30*24*time.Hour, "Retention: delete rows older than this")
+	cmd.Flags().IntVar(&retention.KeepLast, "prune-keep-last", 20, "Retention: always keep the newest N runs per stack/env")
+	cmd.Flags().IntVar(&retention.BatchSize, "prune-batch", 500, "Retention: rows deleted per statement")
 	return cmd
 }
 
+// startHeartbeat refreshes the run heartbeat until the returned stop func
+// is called. stop is idempotent.
+func startHeartbeat(ctx context.Context, st store.Store, runID string, every time.Duration) (stop func()) {
+	if every <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := st.Heartbeat(ctx, runID); err != nil && ctx.Err() == nil {
+					fmt.Fprintln(os.Stderr, "heartbeat failed:", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"xcloudflow/internal/store"
+)
+
+func approvalsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approvals",
+		Short: "Request, decide and check plan approvals (xcf.approvals)",
+		Long: `Apply only runs for a plan whose content hash was approved for the same
+stack/env. CI apply jobs should run "approvals check" with the plan they are
+about to apply; the MCP server enforces the same check for apply tools and
+"agent run --apply" for the dns-apply phase.
+
+The --actor of these commands is not verified: anyone holding the DSN can
+write any decision directly, so the rule that an approver differs from the
+requester is only advisory here. Decide through the MCP approvals.approve
+and approvals.reject tools, where the approver is the authenticated caller,
+when that rule has to hold.`,
+	}
+	cmd.AddCommand(approvalsRequestCmd())
+	cmd.AddCommand(approvalsDecideCmd("approve", store.ApprovalApproved))
+	cmd.AddCommand(approvalsDecideCmd("reject", store.ApprovalRejected))
+	cmd.AddCommand(approvalsListCmd())
+	cmd.AddCommand(approvalsCheckCmd())
+	return cmd
+}
+
+// withStore opens the store for a short CLI command.
+func withStore(fn func(ctx context.Context, st store.Store) error) error {
+	dsn, err := dsnOrErr()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	st, err := store.Open(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return fn(ctx, st)
+}
+
+// readPlan reads a JSON plan from path ("-" for stdin).
+func readPlan(path string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing --plan")
+	}
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func printJSON(v any) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(b))
+}
+
+func approvalsRequestCmd() *cobra.Command {
+	var a store.Approval
+	var planPath string
+	cmd := &cobra.Command{
+		Use:   "request",
+		Short: "Submit a plan for approval and print its content hash",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if a.Stack == "" || a.Env == "" {
+				return fmt.Errorf("missing --stack or --env")
+			}
+			plan, err := readPlan(planPath)
+			if err != nil {
+				return err
+			}
+			a.PlanJSON = plan
+			return withStore(func(ctx context.Context, st store.Store) error {
+				out, err := st.RequestApproval(ctx, a)
+				if err != nil {
+					return err
+				}
+				out.PlanJSON = nil
+				printJSON(out)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&a.Stack, "stack", "", "stack the plan is for")
+	cmd.Flags().StringVar(&a.Env, "env", "", "environment the plan is for")
+	cmd.Flags().StringVar(&planPath, "plan", "", "plan JSON file (- for stdin)")
+	cmd.Flags().StringVar(&a.RunID, "run", "", "run that produced the plan (optional)")
+	cmd.Flags().StringVar(&a.RequestedBy, "actor", os.Getenv("USER"), "who requests the approval")
+	return cmd
+}
+
+func approvalsDecideCmd(use, status string) *cobra.Command {
+	var d store.ApprovalDecision
+	var expiresIn time.Duration
+	short := "Approve a pending plan approval"
+	if status == store.ApprovalRejected {
+		short = "Reject a pending plan approval, or revoke an approved one"
+	}
+	cmd := &cobra.Command{
+		Use:   use + " <approval-id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d.Status = status
+			if expiresIn < 0 {
+				return fmt.Errorf("--expires-in must not be negative")
+			}
+			if expiresIn > 0 {
+				exp := time.Now().Add(expiresIn).UTC()
+				d.ExpiresAt = &exp
+			}
+			return withStore(func(ctx context.Context, st store.Store) error {
+				out, err := st.DecideApproval(ctx, args[0], d)
+				if err != nil {
+					return err
+				}
+				out.PlanJSON = nil
+				printJSON(out)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&d.Actor, "actor", os.Getenv("USER"), "who decides (must differ from the requester to approve; not verified, see approvals --help)")
+	cmd.Flags().StringVar(&d.Reason, "reason", "", "reason recorded with the decision")
+	if status == store.ApprovalApproved {
+		cmd.Flags().DurationVar(&expiresIn, "expires-in", 0, "approval lifetime (e.g. 24h; default: no expiry)")
+	}
+	return cmd
+}
+
+func approvalsListCmd() *cobra.Command {
+	var f store.ApprovalFilter
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List plan approvals, newest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(ctx context.Context, st store.Store) error {
+				approvals, err := st.ListApprovals(ctx, f)
+				if err != nil {
+					return err
+				}
+				out := []store.Approval{}
+				for _, a := range approvals {
+					a.PlanJSON = nil
+					out = append(out, a)
+				}
+				printJSON(out)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&f.Stack, "stack", "", "only approvals of this stack")
+	cmd.Flags().StringVar(&f.Env, "env", "", "only approvals of this env")
+	cmd.Flags().StringVar(&f.Status, "status", "", "only approvals with this status (pending|approved|rejected)")
+	cmd.Flags().IntVar(&f.Limit, "limit", 50, "maximum number of approvals")
+	return cmd
+}
+
+func approvalsCheckCmd() *cobra.Command {
+	var stack, env, planPath string
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Exit non-zero unless the plan is approved for the stack/env (run before apply)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if stack == "" || env == "" {
+				return fmt.Errorf("missing --stack or --env")
+			}
+			plan, err := readPlan(planPath)
+			if err != nil {
+				return err
+			}
+			return withStore(func(ctx context.Context, st store.Store) error {
+				a, err := store.CheckApproval(ctx, st, stack, env, plan)
+				if err != nil {
+					return err
+				}
+				a.PlanJSON = nil
+				printJSON(a)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&stack, "stack", "", "stack being applied")
+	cmd.Flags().StringVar(&env, "env", "", "environment being applied")
+	cmd.Flags().StringVar(&planPath, "plan", "", "plan JSON file about to be applied (- for stdin)")
+	return cmd
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"xcloudflow/internal/store"
+)
+
+func auditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Query the MCP tool call audit trail (xcf.mcp_audit)",
+	}
+	cmd.AddCommand(auditListCmd())
+	return cmd
+}
+
+func auditListCmd() *cobra.Command {
+	var f store.AuditFilter
+	var since time.Duration
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List audited MCP tool calls, newest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			if since < 0 {
+				return fmt.Errorf("--since must not be negative")
+			}
+			if since > 0 {
+				f.Since = time.Now().Add(-since)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			events, err := st.ListAudit(ctx, f)
+			if err != nil {
+				return err
+			}
+			if events == nil {
+				events = []store.AuditEvent{}
+			}
+			b, _ := json.MarshalIndent(events, "", "  ")
+			fmt.Println(string(b))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&f.Actor, "actor", "", "only calls by this caller")
+	cmd.Flags().StringVar(&f.Tool, "tool", "", "only calls of this tool")
+	cmd.Flags().StringVar(&f.Outcome, "outcome", "", "only calls with this outcome (ok|error|rejected|forbidden|cancelled|throttled)")
+	cmd.Flags().DurationVar(&since, "since", 0, "only calls within this long ago (e.g. 24h)")
+	cmd.Flags().IntVar(&f.Limit, "limit", 50, "maximum number of events")
+	return cmd
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
@@ -17,6 +18,7 @@ func dbCmd() *cobra.Command {
 		Short: "Database utilities (schema init/migrate)",
 	}
 	cmd.AddCommand(dbInitCmd())
+	cmd.AddCommand(dbPruneCmd())
 	return cmd
 }
 
@@ -47,7 +49,12 @@ func dbInitCmd() *cobra.Command {
 			}
 			defer st.Close()
 
-			if err := st.ExecSQL(ctx, string(b)); err != nil {
+			pg, ok := st.(*store.Postgres)
+			if !ok {
+				fmt.Println("ok: file store needs no schema")
+				return nil
+			}
+			if err := pg.ExecSQL(ctx, string(b)); err != nil {
 				return fmt.Errorf("apply schema: %w", err)
 			}
 			fmt.Println("ok: schema applied")
@@ -58,3 +65,40 @@ func dbInitCmd() *cobra.Command {
 	return cmd
 }
 
+func dbPruneCmd() *cobra.Command {
+	var p store.RetentionPolicy
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete old runs, agent events and stale MCP tools cache per retention policy",
+		Long: `Delete finished runs older than --max-age that are not among the --keep-last
+newest runs of their stack/env. The newest ok run per stack/env and active runs
+are always kept. Agent events and MCP tools cache rows older than --max-age are
+deleted too. Deletes run in batches of --batch rows.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			rep, err := st.Prune(ctx, p)
+			if err != nil {
+				return err
+			}
+			b, _ := json.MarshalIndent(rep, "", "  ")
+			fmt.Println(string(b))
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&p.MaxAge, "max-age", 30*24*time.Hour, "delete rows older than this (0 = ignore age)")
+	cmd.Flags().IntVar(&p.KeepLast, "keep-last", 20, "always keep the newest N runs per stack/env")
+	cmd.Flags().IntVar(&p.BatchSize, "batch", 500, "rows deleted per statement")
+	cmd.Flags().BoolVar(&p.DryRun, "dry-run", false, "only count what would be deleted")
+	return cmd
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"xcloudflow/internal/store"
+)
+
+func kvCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kv",
+		Short: "Small state in PostgreSQL (xcf.kv: cursors, feature flags)",
+	}
+	cmd.AddCommand(kvGetCmd())
+	cmd.AddCommand(kvSetCmd())
+	cmd.AddCommand(kvListCmd())
+	cmd.AddCommand(kvDeleteCmd())
+	return cmd
+}
+
+type kvView struct {
+	Namespace string          `json:"namespace"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Version   int64           `json:"version"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func toKVView(kv store.KV) kvView {
+	return kvView{
+		Namespace: kv.Namespace,
+		Key:       kv.Key,
+		Value:     json.RawMessage(kv.Value),
+		Version:   kv.Version,
+		UpdatedAt: kv.UpdatedAt,
+	}
+}
+
+func kvGetCmd() *cobra.Command {
+	var ns string
+	cmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Get a value",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			kv, err := st.GetKV(ctx, ns, args[0])
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", ns, args[0], err)
+			}
+			b, _ := json.MarshalIndent(toKVView(kv), "", "  ")
+			fmt.Println(string(b))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&ns, "ns", "default", "namespace")
+	return cmd
+}
+
+func kvSetCmd() *cobra.Command {
+	var ns string
+	var expect int64
+	var asString bool
+	cmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set a value (JSON, or a plain string with --string)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			value := []byte(args[1])
+			if asString {
+				value, _ = json.Marshal(args[1])
+			} else if !json.Valid(value) {
+				return fmt.Errorf("value is not valid JSON (use --string for plain text)")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			var version int64
+			if cmd.Flags().Changed("expect-version") {
+				version, err = st.CompareAndSwapKV(ctx, ns, args[0], expect, value)
+			} else {
+				version, err = st.PutKV(ctx, ns, args[0], value)
+			}
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", ns, args[0], err)
+			}
+			fmt.Printf("ok: %s/%s version=%d\n", ns, args[0], version)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&ns, "ns", "default", "namespace")
+	cmd.Flags().Int64Var(&expect, "expect-version", 0, "compare-and-swap: only write if the current version matches (0 = create only)")
+	cmd.Flags().BoolVar(&asString, "string", false, "store value as a JSON string")
+	return cmd
+}
+
+func kvListCmd() *cobra.Command {
+	var ns, prefix string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List values in a namespace",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			kvs, err := st.ListKV(ctx, ns, prefix)
+			if err != nil {
+				return err
+			}
+			out := make([]kvView, 0, len(kvs))
+			for _, kv := range kvs {
+				out = append(out, toKVView(kv))
+			}
+			b, _ := json.MarshalIndent(out, "", "  ")
+			fmt.Println(string(b))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&ns, "ns", "default", "namespace")
+	cmd.Flags().StringVar(&prefix, "prefix", "", "only keys with this prefix")
+	return cmd
+}
+
+func kvDeleteCmd() *cobra.Command {
+	var ns string
+	cmd := &cobra.Command{
+		Use:   "delete <key>",
+		Short: "Delete a value",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+			return st.DeleteKV(ctx, ns, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&ns, "ns", "default", "namespace")
+	return cmd
+}
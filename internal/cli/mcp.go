@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"xcloudflow/internal/authn"
 	"xcloudflow/internal/mcp"
 	"xcloudflow/internal/store"
 )
@@ -26,9 +31,14 @@ func mcpCmd() *cobra.Command {
 
 func mcpServeCmd() *cobra.Command {
 	var addr string
+	var stdio, gateway bool
+	var auth authn.Config
+	var redact []string
+	var limits mcp.Limits
+	var timeouts mcp.HTTPTimeouts
 	cmd := &cobra.Command{
 		Use:   "serve",
-		Short: "Run MCP HTTP server (Cloud Run friendly)",
+		Short: "Run MCP HTTP server (Cloud Run friendly), or speak MCP over stdio",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if addr == "" {
 				if p := os.Getenv("PORT"); p != "" {
@@ -38,7 +48,7 @@ func mcpServeCmd() *cobra.Command {
 				}
 			}
 
-			var st *store.Store
+			var st store.Store
 			if rf.DSN != "" {
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 				defer cancel()
@@ -50,20 +60,71 @@ func mcpServeCmd() *cobra.Command {
 				defer st.Close()
 			}
 
-			srv := mcp.NewServer(mcp.ServerOptions{Store: st})
+			verifier, err := auth.Verifier()
+			if err != nil {
+				return err
+			}
+			redactor, err := mcp.NewRedactor(redact)
+			if err != nil {
+				return err
+			}
+			opts := mcp.ServerOptions{Store: st, Auth: verifier, Redactor: redactor, Limits: limits}
+			if gateway && st != nil {
+				opts.Gateway = mcp.NewGateway(st, mcp.GatewayOptions{})
+			}
+			srv := mcp.NewServer(opts)
+
+			if stdio {
+				// stdout carries the protocol; logs go to stderr.
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				fmt.Fprintln(os.Stderr, "xcloudflow mcp: serving on stdio")
+				return srv.ServeStdio(ctx, os.Stdin, os.Stdout)
+			}
 
 			mux := http.NewServeMux()
 			mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
 			mux.Handle("/mcp", srv)
 
 			fmt.Println("listening on", addr)
-			return http.ListenAndServe(addr, mux)
+			return mcp.NewHTTPServer(addr, mux, timeouts).ListenAndServe()
 		},
 	}
 	cmd.Flags().StringVar(&addr, "addr", "", "listen addr (default :8080, or :$PORT)")
+	cmd.Flags().BoolVar(&stdio, "stdio", false, "serve newline-delimited JSON-RPC on stdin/stdout instead of HTTP")
+	cmd.Flags().BoolVar(&gateway, "gateway", true, "federate tools of registered MCP servers as <server>.<tool> (requires --dsn)")
+	cmd.Flags().StringSliceVar(&redact, "audit-redact", nil, "extra argument key globs to redact in the audit trail (added to "+strings.Join(mcp.DefaultRedactPatterns, ",")+")")
+	addAuthFlags(cmd, &auth)
+	addLimitFlags(cmd, &limits, &timeouts)
 	return cmd
 }
 
+// addLimitFlags registers request, concurrency, rate and HTTP timeout flags.
+// Negative concurrency or rate values disable that limit.
+func addLimitFlags(cmd *cobra.Command, l *mcp.Limits, t *mcp.HTTPTimeouts) {
+	cmd.Flags().Int64Var(&l.MaxRequestBytes, "max-request-bytes", 4<<20, "maximum request body (HTTP) or line (stdio) size")
+	cmd.Flags().DurationVar(&l.ToolTimeout, "tool-timeout", 60*time.Second, "default tool execution timeout (tools may declare their own)")
+	cmd.Flags().IntVar(&l.MaxConcurrent, "max-concurrent", 64, "maximum in-flight tool calls (negative: unlimited)")
+	cmd.Flags().IntVar(&l.MaxConcurrentPerCaller, "max-concurrent-per-caller", 8, "maximum in-flight tool calls per caller (negative: unlimited)")
+	cmd.Flags().Float64Var(&l.Rate, "rate", 50, "tool calls per second across all callers, token bucket (negative: unlimited)")
+	cmd.Flags().IntVar(&l.Burst, "burst", 0, "token bucket size for --rate (0: 2x --rate)")
+	cmd.Flags().Float64Var(&l.CallerRate, "caller-rate", 10, "tool calls per second per caller, token bucket (negative: unlimited)")
+	cmd.Flags().IntVar(&l.CallerBurst, "caller-burst", 0, "token bucket size for --caller-rate (0: 2x --caller-rate)")
+	cmd.Flags().IntVar(&l.TrustedProxyHops, "trusted-proxy-hops", 0, "proxies appending to X-Forwarded-For in front of the server; per-caller limits key anonymous callers by that client address (0: TCP peer)")
+	cmd.Flags().DurationVar(&t.Read, "read-timeout", 30*time.Second, "HTTP server read timeout")
+	cmd.Flags().DurationVar(&t.Write, "write-timeout", 150*time.Second, "HTTP server write timeout (must exceed the longest tool timeout)")
+	cmd.Flags().DurationVar(&t.Idle, "idle-timeout", 120*time.Second, "HTTP server keep-alive idle timeout")
+}
+
+// addAuthFlags registers the inbound auth flags of an MCP HTTP server.
+func addAuthFlags(cmd *cobra.Command, c *authn.Config) {
+	cmd.Flags().StringVar(&c.TokensRef, "auth-tokens", "", "static bearer tokens file as a secret ref (env:NAME|file:PATH); lines of <token> <subject> [scope...]")
+	cmd.Flags().StringVar(&c.Issuer, "auth-issuer", "", "accept JWTs from this issuer (with --auth-audience and --auth-jwks)")
+	cmd.Flags().StringVar(&c.Audience, "auth-audience", "", "required JWT audience")
+	cmd.Flags().StringVar(&c.JWKS, "auth-jwks", "", "JWKS file path or http(s) URL used to verify JWT signatures")
+	cmd.Flags().StringSliceVar(&c.DefaultScopes, "auth-default-scopes", []string{authn.ScopeRead}, "scopes granted to JWTs without a scope claim")
+}
+
 func mcpServersCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "servers",
@@ -72,11 +133,13 @@ func mcpServersCmd() *cobra.Command {
 	cmd.AddCommand(mcpServersAddCmd())
 	cmd.AddCommand(mcpServersListCmd())
 	cmd.AddCommand(mcpServersRefreshCmd())
+	cmd.AddCommand(mcpServersStatusCmd())
 	return cmd
 }
 
 func mcpServersAddCmd() *cobra.Command {
-	var name, baseURL, kind, authType, audience string
+	var name, baseURL, kind, authType, audience, secretRef string
+	var allowTools, denyTools, applyTools []string
 	var enabled bool
 	cmd := &cobra.Command{
 		Use:   "add",
@@ -89,6 +152,14 @@ func mcpServersAddCmd() *cobra.Command {
 			if name == "" || baseURL == "" {
 				return fmt.Errorf("missing required: --name --url")
 			}
+			if _, err := mcp.AuthForServer(store.MCPServer{Name: name, AuthType: authType, SecretRef: secretRef}); err != nil {
+				return err
+			}
+			for _, p := range append(append(append([]string{}, allowTools...), denyTools...), applyTools...) {
+				if _, err := path.Match(p, ""); err != nil {
+					return fmt.Errorf("tool pattern %q: %w", p, err)
+				}
+			}
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 			st, err := store.Open(ctx, dsn)
@@ -97,12 +168,16 @@ func mcpServersAddCmd() *cobra.Command {
 			}
 			defer st.Close()
 			_, err = st.UpsertMCPServer(ctx, store.MCPServer{
-				Name:     name,
-				BaseURL:  baseURL,
-				Kind:     kind,
-				AuthType: authType,
-				Audience: audience,
-				Enabled:  enabled,
+				Name:       name,
+				BaseURL:    baseURL,
+				Kind:       kind,
+				AuthType:   authType,
+				Audience:   audience,
+				SecretRef:  secretRef,
+				Enabled:    enabled,
+				AllowTools: allowTools,
+				DenyTools:  denyTools,
+				ApplyTools: applyTools,
 			})
 			return err
 		},
@@ -110,9 +185,13 @@ func mcpServersAddCmd() *cobra.Command {
 	cmd.Flags().StringVar(&name, "name", "", "server name (unique)")
 	cmd.Flags().StringVar(&baseURL, "url", "", "server MCP endpoint URL (e.g. https://service/mcp)")
 	cmd.Flags().StringVar(&kind, "kind", "generic", "server kind (optional)")
-	cmd.Flags().StringVar(&authType, "auth", "none", "auth type: none|bearer|oidc (stored only; enforcement in client)")
-	cmd.Flags().StringVar(&audience, "audience", "", "OIDC audience (optional)")
+	cmd.Flags().StringVar(&authType, "auth", "none", "auth type: none|bearer|oidc")
+	cmd.Flags().StringVar(&audience, "audience", "", "OIDC audience (default: the server URL)")
+	cmd.Flags().StringVar(&secretRef, "secret-ref", "", "bearer token location for --auth bearer: env:NAME or file:PATH")
 	cmd.Flags().BoolVar(&enabled, "enabled", true, "enable this server")
+	cmd.Flags().StringSliceVar(&allowTools, "allow-tool", nil, "gateway: only expose tools matching these glob patterns (repeatable)")
+	cmd.Flags().StringSliceVar(&denyTools, "deny-tool", nil, "gateway: never expose tools matching these glob patterns (repeatable; wins over --allow-tool)")
+	cmd.Flags().StringSliceVar(&applyTools, "apply-tool", nil, "gateway: tools matching these glob patterns change infrastructure and need xcf:apply plus an approved plan, like *.apply (repeatable)")
 	return cmd
 }
 
@@ -145,15 +224,76 @@ func mcpServersListCmd() *cobra.Command {
 }
 
 func mcpServersRefreshCmd() *cobra.Command {
+	var opts mcp.RefreshOptions
 	cmd := &cobra.Command{
 		Use:   "refresh-tools",
 		Short: "Fetch tools/list from each enabled MCP server and cache into xcf.mcp_tools_cache",
+		Long: `Poll every enabled server concurrently (per-server --timeout). Unchanged tool
+lists (same ETag) are not rewritten. Health and last error are recorded per
+server; one failing server does not stop the others, but the command exits
+non-zero if any failed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			results, err := mcp.RefreshTools(ctx, st, opts)
+			if err != nil {
+				return err
+			}
+			b, _ := json.MarshalIndent(results, "", "  ")
+			fmt.Println(string(b))
+			failed := 0
+			for _, r := range results {
+				if r.Status == "error" {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d server(s) failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 10*time.Second, "per-server timeout")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 8, "servers polled in parallel")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "ignore cached ETags and rewrite every cache entry")
+	return cmd
+}
+
+type mcpServerStatus struct {
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Enabled       bool       `json:"enabled"`
+	Health        string     `json:"health"`
+	Reachable     bool       `json:"reachable"`
+	Tools         int        `json:"tools"`
+	LastSeenAt    *time.Time `json:"last_seen_at,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	ToolsFetched  *time.Time `json:"tools_fetched_at,omitempty"`
+}
+
+func mcpServersStatusCmd() *cobra.Command {
+	var probe bool
+	var opts mcp.RefreshOptions
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show reachability and cached tool counts of registered MCP servers",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			dsn, err := dsnOrErr()
 			if err != nil {
 				return err
 			}
-			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 			defer cancel()
 			st, err := store.Open(ctx, dsn)
 			if err != nil {
@@ -161,28 +301,52 @@ func mcpServersRefreshCmd() *cobra.Command {
 			}
 			defer st.Close()
 
+			if probe {
+				if _, err := mcp.RefreshTools(ctx, st, opts); err != nil {
+					return err
+				}
+			}
 			srvs, err := st.ListMCPServers(ctx)
 			if err != nil {
 				return err
 			}
+			caches, err := st.ListMCPToolsCache(ctx)
+			if err != nil {
+				return err
+			}
+			byServer := map[string]store.MCPToolsCache{}
+			for _, c := range caches {
+				byServer[c.ServerID] = c
+			}
+
+			out := make([]mcpServerStatus, 0, len(srvs))
 			for _, srv := range srvs {
-				if !srv.Enabled {
-					continue
+				row := mcpServerStatus{
+					Name:          srv.Name,
+					URL:           srv.BaseURL,
+					Enabled:       srv.Enabled,
+					Health:        srv.Health,
+					Reachable:     srv.Health == store.MCPHealthOK,
+					LastSeenAt:    srv.LastSeenAt,
+					LastCheckedAt: srv.LastCheckedAt,
+					LastError:     srv.LastError,
 				}
-				c := mcp.NewClient(srv.BaseURL)
-				tools, err := c.ToolsList(ctx)
-				if err != nil {
-					return fmt.Errorf("server %s: %w", srv.Name, err)
-				}
-				tb, _ := json.Marshal(tools)
-				if err := st.UpdateMCPToolsCache(ctx, srv.ServerID, tb, ""); err != nil {
-					return err
+				if c, ok := byServer[srv.ServerID]; ok {
+					var tools []json.RawMessage
+					_ = json.Unmarshal(c.Tools, &tools)
+					row.Tools = len(tools)
+					fetched := c.FetchedAt
+					row.ToolsFetched = &fetched
 				}
+				out = append(out, row)
 			}
-			fmt.Println("ok: tools cache refreshed")
+			b, _ := json.MarshalIndent(out, "", "  ")
+			fmt.Println(string(b))
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&probe, "probe", true, "contact every enabled server first (refreshes health and tools cache)")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 5*time.Second, "per-server probe timeout")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 8, "servers probed in parallel")
 	return cmd
 }
-
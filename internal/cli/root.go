@@ -19,12 +19,16 @@ func Execute() error {
 		Short: "XCloudFlow control plane (MCP/Agent/Skills/State)",
 	}
 
-	rootCmd.PersistentFlags().StringVar(&rf.DSN, "dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN (defaults to DATABASE_URL)")
+	rootCmd.PersistentFlags().StringVar(&rf.DSN, "dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN, or file:///path/state.json for the embedded store (defaults to DATABASE_URL)")
 
 	rootCmd.AddCommand(dbCmd())
 	rootCmd.AddCommand(mcpCmd())
 	rootCmd.AddCommand(skillsCmd())
 	rootCmd.AddCommand(agentCmd())
+	rootCmd.AddCommand(kvCmd())
+	rootCmd.AddCommand(runsCmd())
+	rootCmd.AddCommand(auditCmd())
+	rootCmd.AddCommand(approvalsCmd())
 
 	return rootCmd.Execute()
 }
@@ -35,4 +39,3 @@ func dsnOrErr() (string, error) {
 	}
 	return rf.DSN, nil
 }
-
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"xcloudflow/internal/store"
+)
+
+func runsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Inspect and maintain StackFlow runs (xcf.runs)",
+	}
+	cmd.AddCommand(runsReapCmd())
+	cmd.AddCommand(runsWatchCmd())
+	return cmd
+}
+
+func runsReapCmd() *cobra.Command {
+	var staleAfter time.Duration
+	cmd := &cobra.Command{
+		Use:   "reap",
+		Short: "Mark running runs with an expired heartbeat as timed_out",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			if staleAfter <= 0 {
+				return fmt.Errorf("--stale-after must be positive")
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			ids, err := st.ReapStaleRuns(ctx, staleAfter)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				fmt.Println(id)
+			}
+			fmt.Printf("ok: %d run(s) timed out\n", len(ids))
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&staleAfter, "stale-after", 5*time.Minute, "heartbeat age after which a running run is timed out")
+	return cmd
+}
+
+func runsWatchCmd() *cobra.Command {
+	var stack, env string
+	var poll time.Duration
+	var pollOnly bool
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Stream run and agent event changes (LISTEN/NOTIFY, falls back to polling)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			var src store.Store = st
+			if pollOnly {
+				// Hide the Subscriber implementation to force polling.
+				src = struct{ store.Store }{st}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			for c := range store.Watch(ctx, src, poll) {
+				if c.Kind == "run" && ((stack != "" && c.Stack != stack) || (env != "" && c.Env != env)) {
+					continue
+				}
+				if err := enc.Encode(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&stack, "stack", "", "only runs of this stack")
+	cmd.Flags().StringVar(&env, "env", "", "only runs of this env")
+	cmd.Flags().DurationVar(&poll, "poll", 5*time.Second, "polling interval when LISTEN is unavailable")
+	cmd.Flags().BoolVar(&pollOnly, "poll-only", false, "do not use LISTEN/NOTIFY")
+	return cmd
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -16,28 +19,49 @@ import (
 func skillsCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "skills",
-		Short: "Skills: list/read external skills (local/http) and optionally cache in PostgreSQL",
+		Short: "Skills: list/read external skills (local/git/http) and optionally cache in PostgreSQL",
 	}
 	cmd.AddCommand(skillsListCmd())
 	cmd.AddCommand(skillsSourceAddCmd())
+	cmd.AddCommand(skillsSourceRemoveCmd())
 	cmd.AddCommand(skillsSyncCmd())
+	cmd.AddCommand(skillsSearchCmd())
+	cmd.AddCommand(skillsResolveCmd())
+	cmd.AddCommand(skillsPinCmd())
+	cmd.AddCommand(skillsUnpinCmd())
 	return cmd
 }
 
 func skillsListCmd() *cobra.Command {
-	var dir string
-	var show bool
+	var dir, tag, phase string
+	var show, cached, all bool
 	cmd := &cobra.Command{
 		Use:   "list",
-		Short: "List skills under a directory (expects <dir>/*/SKILL.md)",
+		Short: "List skills under a directory (expects <dir>/*/SKILL.md) or in the cache",
+		Long: `List skills with their frontmatter metadata. --tag and --phase keep the
+skills whose frontmatter lists that tag or applies_to phase; skills without
+applies_to.phases never match --phase. With --cached, each skill is listed
+once, from the source that wins resolution (see skills resolve); --all lists
+every cached copy.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if cached {
+				return withStore(func(ctx context.Context, st store.Store) error {
+					return listCachedSkills(ctx, st, tag, phase, show, all)
+				})
+			}
 			if dir == "" {
 				dir = "skills"
 			}
-			found, err := skills.DiscoverLocal(dir)
+			all, err := skills.DiscoverLocal(dir)
 			if err != nil {
 				return err
 			}
+			found := []skills.Skill{}
+			for _, s := range all {
+				if s.Meta.Matches(tag, phase) {
+					found = append(found, s)
+				}
+			}
 			if show {
 				for _, s := range found {
 					full := filepath.Join(dir, s.Name, "SKILL.md")
@@ -55,13 +79,66 @@ func skillsListCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVar(&dir, "dir", "skills", "skills directory to scan")
+	cmd.Flags().BoolVar(&cached, "cached", false, "list skills cached in PostgreSQL (xcf.skill_docs) instead of --dir")
+	cmd.Flags().StringVar(&tag, "tag", "", "only skills with this frontmatter tag")
+	cmd.Flags().StringVar(&phase, "phase", "", "only skills whose frontmatter applies_to.phases lists this phase")
 	cmd.Flags().BoolVar(&show, "show", false, "print SKILL.md content")
+	cmd.Flags().BoolVar(&all, "all", false, "with --cached: list every cached copy, not just the effective one per skill")
 	return cmd
 }
 
+type cachedSkillView struct {
+	Name   string      `json:"name"`
+	Source string      `json:"source"`
+	Path   string      `json:"path"`
+	SHA256 string      `json:"sha256"`
+	Commit string      `json:"commit,omitempty"`
+	Meta   skills.Meta `json:"meta"`
+}
+
+func listCachedSkills(ctx context.Context, st store.Store, tag, phase string, show, all bool) error {
+	var docs []store.SkillDoc
+	if all {
+		var err error
+		if docs, err = st.ListSkillDocs(ctx); err != nil {
+			return err
+		}
+	} else {
+		resolved, err := store.ResolveSkills(ctx, st)
+		if err != nil {
+			return err
+		}
+		for _, r := range resolved {
+			docs = append(docs, r.Doc)
+		}
+	}
+	out := []cachedSkillView{}
+	for _, d := range docs {
+		var meta skills.Meta
+		if len(d.Meta) > 0 {
+			if err := json.Unmarshal(d.Meta, &meta); err != nil {
+				return fmt.Errorf("skill %s/%s: meta: %w", d.SourceName, d.Path, err)
+			}
+		}
+		if !meta.Matches(tag, phase) {
+			continue
+		}
+		if show {
+			fmt.Printf("## %s (%s, %s)\n\n%s\n\n", d.Name, d.SourceName, d.SHA256, d.Content)
+			continue
+		}
+		out = append(out, cachedSkillView{Name: d.Name, Source: d.SourceName, Path: d.Path, SHA256: d.SHA256, Commit: d.Commit, Meta: meta})
+	}
+	if !show {
+		printJSON(out)
+	}
+	return nil
+}
+
 func skillsSourceAddCmd() *cobra.Command {
 	var name, typ, uri, ref, basePath string
 	var enabled bool
+	var priority int
 	cmd := &cobra.Command{
 		Use:   "add-source",
 		Short: "Upsert an external skill source into PostgreSQL (xcf.skill_sources)",
@@ -87,20 +164,45 @@ func skillsSourceAddCmd() *cobra.Command {
 				Ref:      ref,
 				BasePath: basePath,
 				Enabled:  enabled,
+				Priority: priority,
 			})
 			return err
 		},
 	}
 	cmd.Flags().StringVar(&name, "name", "", "source name (unique)")
-	cmd.Flags().StringVar(&typ, "type", "", "source type: local|http")
-	cmd.Flags().StringVar(&uri, "uri", "", "source URI (path or http url)")
-	cmd.Flags().StringVar(&ref, "ref", "", "reserved (git ref) - not used today")
+	cmd.Flags().StringVar(&typ, "type", "", "source type: local|git|http")
+	cmd.Flags().StringVar(&uri, "uri", "", "source URI (path, git repository, http url of a SKILL.md or a .tar.gz/.zip bundle)")
+	cmd.Flags().StringVar(&ref, "ref", "", "git branch, tag or commit (default: the remote HEAD)")
 	cmd.Flags().StringVar(&basePath, "path", "", "base path inside source (optional)")
 	cmd.Flags().BoolVar(&enabled, "enabled", true, "enable this source")
+	cmd.Flags().IntVar(&priority, "priority", 0, "higher priority sources shadow same-named skills of lower ones (see skills resolve)")
 	return cmd
 }
 
+func skillsSourceRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove-source <name>",
+		Short: "Delete a skill source with its cached docs and pins",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(ctx context.Context, st store.Store) error {
+				srcs, err := st.ListSkillSources(ctx)
+				if err != nil {
+					return err
+				}
+				for _, src := range srcs {
+					if src.Name == args[0] {
+						return st.RemoveSkillSource(ctx, src.SourceID)
+					}
+				}
+				return fmt.Errorf("skill source %s: %w", args[0], store.ErrNotFound)
+			})
+		},
+	}
+}
+
 func skillsSyncCmd() *cobra.Command {
+	var cacheDir string
 	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Fetch skills from configured sources and cache into PostgreSQL (xcf.skill_docs)",
@@ -109,7 +211,10 @@ func skillsSyncCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+			if cacheDir == "" {
+				cacheDir = defaultSkillsCacheDir()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 			defer cancel()
 			st, err := store.Open(ctx, dsn)
 			if err != nil {
@@ -125,42 +230,234 @@ func skillsSyncCmd() *cobra.Command {
 				if !src.Enabled {
 					continue
 				}
-				switch src.Type {
-				case "local":
-					dir := src.URI
-					if src.BasePath != "" {
-						dir = filepath.Join(dir, src.BasePath)
-					}
-					found, err := skills.DiscoverLocal(dir)
-					if err != nil {
-						return fmt.Errorf("source %s: %w", src.Name, err)
-					}
-					for _, sk := range found {
-						p := filepath.Join(dir, sk.Name, "SKILL.md")
-						doc, err := skills.ReadSkill(p)
-						if err != nil {
-							return err
-						}
-						if err := st.UpsertSkillDoc(ctx, src.SourceID, filepath.Join(sk.Name, "SKILL.md"), doc.SHA256, doc.Content); err != nil {
-							return err
-						}
-					}
-				case "http":
-					doc, err := skills.FetchHTTP(src.URI, 15*time.Second)
-					if err != nil {
-						return fmt.Errorf("source %s: %w", src.Name, err)
-					}
-					if err := st.UpsertSkillDoc(ctx, src.SourceID, "SKILL.md", doc.SHA256, doc.Content); err != nil {
-						return err
-					}
-				default:
-					return fmt.Errorf("unsupported source type (today): %s", src.Type)
+				if err := syncSkillSource(ctx, st, src, cacheDir); err != nil {
+					return fmt.Errorf("source %s: %w", src.Name, err)
 				}
 			}
 			fmt.Println("ok: skills synced")
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "where git sources are checked out (default: user cache dir)")
+	return cmd
+}
+
+func defaultSkillsCacheDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "xcloudflow", "skills")
+	}
+	return filepath.Join(os.TempDir(), "xcloudflow-skills")
+}
+
+// syncSkillSource caches every skill of one source, then deletes the cached
+// docs of skills that were removed or renamed upstream so a stale copy
+// cannot keep winning resolution. Nothing is deleted when fetching fails.
+func syncSkillSource(ctx context.Context, st store.Store, src store.SkillSource, cacheDir string) error {
+	found, commit, err := fetchSkillSource(ctx, src, cacheDir)
+	if err != nil {
+		return err
+	}
+	keep := make([]string, 0, len(found))
+	for _, f := range found {
+		if err := cacheSkill(ctx, st, src.SourceID, f.path, f.skill, commit); err != nil {
+			return err
+		}
+		keep = append(keep, f.path)
+	}
+	n, err := st.PruneSkillDocs(ctx, src.SourceID, keep)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		fmt.Printf("source %s: removed %d stale doc(s)\n", src.Name, n)
+	}
+	return nil
+}
+
+// fetchedSkill is a skill read from a source and the path it is cached under.
+type fetchedSkill struct {
+	path  string
+	skill skills.Skill
+}
+
+// fetchSkillSource reads every skill of one source; commit is the checked
+// out SHA for git sources.
+func fetchSkillSource(ctx context.Context, src store.SkillSource, cacheDir string) (found []fetchedSkill, commit string, err error) {
+	var sks []skills.Skill
+	switch src.Type {
+	case "local":
+		sks, err = readSkillDir(skills.SubDir(src.URI, src.BasePath))
+	case "git":
+		var co skills.GitCheckout
+		if co, err = skills.SyncGit(ctx, src.URI, src.Ref, cacheDir); err != nil {
+			return nil, "", err
+		}
+		commit = co.Commit
+		sks, err = co.Skills(src.BasePath)
+	case "http":
+		if skills.IsBundleURL(src.URI) {
+			sks, err = skills.FetchBundle(ctx, src.URI, skills.BundleOptions{})
+			break
+		}
+		doc, err := skills.FetchHTTP(src.URI, 15*time.Second)
+		if err != nil {
+			return nil, "", err
+		}
+		return []fetchedSkill{{path: "SKILL.md", skill: doc}}, "", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported source type: %s", src.Type)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	for _, sk := range sks {
+		found = append(found, fetchedSkill{path: path.Join(sk.Name, "SKILL.md"), skill: sk})
+	}
+	return found, commit, nil
+}
+
+// readSkillDir reads <dir>/*/SKILL.md.
+func readSkillDir(dir string) ([]skills.Skill, error) {
+	found, err := skills.DiscoverLocal(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]skills.Skill, 0, len(found))
+	for _, sk := range found {
+		doc, err := skills.ReadSkill(sk.Path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, doc)
+	}
+	return out, nil
+}
+
+// cacheSkill upserts one skill doc with its frontmatter. Invalid frontmatter
+// is reported but does not stop the sync; the doc is cached without metadata.
+func cacheSkill(ctx context.Context, st store.Store, sourceID, docPath string, sk skills.Skill, commit string) error {
+	meta, err := skills.ParseMeta(sk.Content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v (cached without metadata)\n", sk.Path, err)
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return st.UpsertSkillDoc(ctx, store.SkillDoc{
+		SourceID: sourceID,
+		Path:     docPath,
+		SHA256:   sk.SHA256,
+		Content:  sk.Content,
+		Commit:   commit,
+		Meta:     metaJSON,
+	})
+}
+
+func skillsSearchCmd() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Full-text search over cached skill docs (xcf.skill_docs)",
+		Long: `The query uses web-search syntax: words must all occur, "quoted phrases"
+match in order, -word excludes, and "or" between two terms accepts either.
+PostgreSQL matches whole words; the file store matches substrings.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn, err := dsnOrErr()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			st, err := store.Open(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer st.Close()
+
+			hits, err := st.SearchSkills(ctx, strings.Join(args, " "), limit)
+			if err != nil {
+				return err
+			}
+			b, _ := json.MarshalIndent(hits, "", "  ")
+			fmt.Println(string(b))
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 10, "maximum number of results")
+	return cmd
+}
+
+func skillsResolveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resolve",
+		Short: "Show the effective copy of each cached skill: which source won and why",
+		Long: `Resolve same-named skills across enabled sources. A pin (skills pin) wins;
+otherwise the source with the highest --priority wins, ties going to the
+source name that sorts first. Shadowed copies are listed with the reason.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(ctx context.Context, st store.Store) error {
+				resolved, err := store.ResolveSkills(ctx, st)
+				if err != nil {
+					return err
+				}
+				printJSON(resolved)
+				return nil
+			})
+		},
+	}
+}
+
+func skillsPinCmd() *cobra.Command {
+	var p store.SkillPin
+	var source string
+	cmd := &cobra.Command{
+		Use:   "pin <skill>",
+		Short: "Always take a skill from the given source, regardless of priorities",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if source == "" {
+				return fmt.Errorf("missing --source")
+			}
+			p.Skill = args[0]
+			return withStore(func(ctx context.Context, st store.Store) error {
+				srcs, err := st.ListSkillSources(ctx)
+				if err != nil {
+					return err
+				}
+				for _, src := range srcs {
+					if src.Name == source {
+						p.SourceID = src.SourceID
+					}
+				}
+				if p.SourceID == "" {
+					return fmt.Errorf("skill source %s: %w", source, store.ErrNotFound)
+				}
+				out, err := st.PinSkill(ctx, p)
+				if err != nil {
+					return err
+				}
+				printJSON(out)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&source, "source", "", "source name to take the skill from")
+	cmd.Flags().StringVar(&p.Reason, "reason", "", "why the skill is pinned")
+	cmd.Flags().StringVar(&p.PinnedBy, "actor", os.Getenv("USER"), "who pins the skill")
 	return cmd
 }
 
+func skillsUnpinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpin <skill>",
+		Short: "Remove a skill pin (resolution falls back to source priorities)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(ctx context.Context, st store.Store) error {
+				return st.UnpinSkill(ctx, args[0])
+			})
+		},
+	}
+}
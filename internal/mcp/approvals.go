@@ -0,0 +1,74 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+// Apply gate.
+//
+// An apply tool (see isApplyTool: "*.apply", local or federated, plus the
+// federated tools a server marks with ApplyTools) only runs when its
+// arguments carry the plan being applied, {"stack": ..., "env": ..., "plan":
+// ...}, and that plan is approved for exactly that stack and env
+// (store.CheckApproval). Without a store nothing can be approved, so apply
+// tools are refused outright.
+
+func (s *Server) checkApproval(ctx context.Context, name string, args json.RawMessage) *rpcErr {
+	if !s.isApplyTool(ctx, name) {
+		return nil
+	}
+	if s.store == nil {
+		return &rpcErr{Code: codeForbidden, Message: name + ": apply requires an approved plan, but no store is configured"}
+	}
+	var in struct {
+		Stack string          `json:"stack"`
+		Env   string          `json:"env"`
+		Plan  json.RawMessage `json:"plan"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil || in.Stack == "" || in.Env == "" || len(in.Plan) == 0 {
+		return &rpcErr{Code: codeInvalidParams, Message: name + ": apply tools take stack, env and the approved plan as arguments"}
+	}
+	if _, err := store.CheckApproval(ctx, s.store, in.Stack, in.Env, in.Plan); err != nil {
+		if errors.Is(err, store.ErrNotApproved) {
+			return &rpcErr{Code: codeForbidden, Message: err.Error()}
+		}
+		return &rpcErr{Code: codeInternalError, Message: err.Error()}
+	}
+	return nil
+}
+
+// decideApproval backs approvals.approve and approvals.reject. The decider
+// is the authenticated caller; unauthenticated (stdio) callers cannot
+// decide.
+func decideApproval(ctx context.Context, st store.Store, args json.RawMessage, status string) (any, error) {
+	var in struct {
+		ApprovalID       string `json:"approval_id"`
+		Reason           string `json:"reason"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	actor := authn.Actor(ctx)
+	if actor == "" {
+		return nil, fmt.Errorf("deciding approvals requires an authenticated caller")
+	}
+	d := store.ApprovalDecision{Status: status, Actor: actor, Reason: in.Reason}
+	if in.ExpiresInSeconds > 0 {
+		exp := time.Now().Add(time.Duration(in.ExpiresInSeconds) * time.Second).UTC()
+		d.ExpiresAt = &exp
+	}
+	a, err := st.DecideApproval(ctx, in.ApprovalID, d)
+	if err != nil {
+		return nil, err
+	}
+	a.PlanJSON = nil
+	return map[string]any{"approval": a}, nil
+}
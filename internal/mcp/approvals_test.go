@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+func TestApplyGate(t *testing.T) {
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toks, _ := authn.ParseTokens("dev alice xcf:apply\nlead bob xcf:apply\nviewer carol xcf:read\n")
+	srv := NewServer(ServerOptions{Store: st, Auth: toks})
+	applied := 0
+	sc, _ := compileSchema(json.RawMessage(`{"type":"object"}`))
+	srv.tools["dns.apply"] = &ToolSpec{
+		Tool:    Tool{Name: "dns.apply"},
+		Scope:   authn.ScopeApply,
+		Handler: func(context.Context, store.Store, json.RawMessage) (any, error) { applied++; return nil, nil },
+		schema:  sc,
+	}
+	call := func(token, name, args string) testResp {
+		t.Helper()
+		body := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + args + `}}`
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		var resp testResp
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %s", name, rec.Body)
+		}
+		return resp
+	}
+	const apply = `{"stack":"demo","env":"prod","plan":{"zone":"example.com","records":["www"]}}`
+
+	if r := call("dev", "dns.apply", apply); r.Error == nil || r.Error.Code != codeForbidden || !strings.Contains(r.Error.Message, "not approved") {
+		t.Fatalf("unapproved apply: %+v", r)
+	}
+	if r := call("dev", "dns.apply", `{}`); r.Error == nil || r.Error.Code != codeInvalidParams {
+		t.Fatalf("apply without plan: %+v", r)
+	}
+
+	if r := call("viewer", "approvals.request", apply); r.Error == nil || r.Error.Code != codeForbidden || !strings.Contains(r.Error.Message, authn.ScopeApply) {
+		t.Fatalf("read-only request: %+v", r)
+	}
+	if as, _ := st.ListApprovals(context.Background(), store.ApprovalFilter{}); len(as) != 0 {
+		t.Fatalf("read-only caller created approvals: %+v", as)
+	}
+
+	r := call("dev", "approvals.request", apply)
+	var req struct {
+		StructuredContent struct {
+			Approval store.Approval `json:"approval"`
+		} `json:"structuredContent"`
+	}
+	if r.Error != nil || json.Unmarshal(r.Result, &req) != nil || req.StructuredContent.Approval.RequestedBy != "alice" {
+		t.Fatalf("request: %+v %s", r.Error, r.Result)
+	}
+	id := req.StructuredContent.Approval.ApprovalID
+	if r := call("dev", "approvals.approve", `{"approval_id":"`+id+`"}`); r.Error != nil || !strings.Contains(string(r.Result), "cannot approve their own") {
+		t.Fatalf("self-approval: %+v %s", r.Error, r.Result)
+	}
+	if r := call("lead", "approvals.approve", `{"approval_id":"`+id+`","expires_in_seconds":3600}`); r.Error != nil || strings.Contains(string(r.Result), `"isError":true`) {
+		t.Fatalf("approve: %+v %s", r.Error, r.Result)
+	}
+
+	if r := call("dev", "dns.apply", `{"stack":"demo","env":"prod","plan":{"records":["www"],"zone":"example.com"}}`); r.Error != nil || applied != 1 {
+		t.Fatalf("approved apply: %+v, applied %d", r.Error, applied)
+	}
+	if r := call("dev", "dns.apply", `{"stack":"demo","env":"prod","plan":{"zone":"example.com","records":["www","api"]}}`); r.Error == nil || applied != 1 {
+		t.Fatalf("modified plan applied: %+v", r)
+	}
+	if r := call("dev", "dns.apply", `{"stack":"demo","env":"dev","plan":{"zone":"example.com","records":["www"]}}`); r.Error == nil || applied != 1 {
+		t.Fatalf("plan applied to other env: %+v", r)
+	}
+	if r := call("dev", "dns.apply", `{"stack":"demo","plan":{"zone":"example.com","records":["www"]}}`); r.Error == nil || r.Error.Code != codeInvalidParams || applied != 1 {
+		t.Fatalf("plan applied with env omitted: %+v", r)
+	}
+	if r := call("lead", "approvals.reject", `{"approval_id":"`+id+`","reason":"freeze"}`); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if r := call("dev", "dns.apply", apply); r.Error == nil || applied != 1 {
+		t.Fatalf("revoked plan applied: %+v", r)
+	}
+}
+
+func TestApplyGateFederated(t *testing.T) {
+	ctx := context.Background()
+	backend := httptest.NewServer(NewServer(ServerOptions{}))
+	defer backend.Close()
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.UpsertMCPServer(ctx, store.MCPServer{
+		Name: "ops", BaseURL: backend.URL, Enabled: true, ApplyTools: []string{"stackflow.validate"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshTools(ctx, st, RefreshOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	toks, _ := authn.ParseTokens("dev alice xcf:read\nlead bob xcf:apply\n")
+	srv := NewServer(ServerOptions{Store: st, Auth: toks, Gateway: NewGateway(st, GatewayOptions{})})
+	call := func(token, name, args string) testResp {
+		t.Helper()
+		body := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + args + `}}`
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		var resp testResp
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %s", name, rec.Body)
+		}
+		return resp
+	}
+	const apply = `{"stack":"demo","env":"prod","plan":{"zone":"example.com"}}`
+
+	if r := call("dev", "ops.stackflow.validate", apply); r.Error == nil || r.Error.Code != codeForbidden || !strings.Contains(r.Error.Message, authn.ScopeApply) {
+		t.Fatalf("marked apply tool without xcf:apply: %+v", r)
+	}
+	if r := call("lead", "ops.stackflow.validate", apply); r.Error == nil || r.Error.Code != codeForbidden || !strings.Contains(r.Error.Message, "not approved") {
+		t.Fatalf("unapproved federated apply: %+v", r)
+	}
+	if r := call("dev", "ops.stackflow.plan.dns", `{"config_yaml":"x"}`); r.Error != nil {
+		t.Fatalf("unmarked federated tool gated: %+v", r)
+	}
+}
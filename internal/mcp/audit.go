@@ -0,0 +1,163 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+// Audit trail.
+//
+// With a store configured every tools/call, local or federated, is recorded
+// in xcf.mcp_audit: caller, tool, redacted arguments, duration and outcome.
+// Redaction is by argument key so secrets never reach the database.
+
+// DefaultRedactPatterns are always redacted. Patterns are path.Match globs,
+// matched case-insensitively against each object key and against its
+// dotted path from the arguments root (array indices are skipped), so
+// "*token*" hits any key containing "token" and "auth.value" one field.
+var DefaultRedactPatterns = []string{
+	"*token*", "*password*", "*passwd*", "*secret*", "*authorization*",
+	"*api_key*", "*apikey*", "*private_key*", "*credential*",
+}
+
+// redacted replaces the value of a redacted field.
+const redacted = "[REDACTED]"
+
+// maxAuditArgs caps stored arguments; larger ones are replaced by a marker.
+const maxAuditArgs = 64 << 10
+
+// Redactor removes sensitive values from tool arguments.
+type Redactor struct {
+	patterns []string
+}
+
+// NewRedactor returns a Redactor for DefaultRedactPatterns plus extra.
+func NewRedactor(extra []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range append(append([]string{}, DefaultRedactPatterns...), extra...) {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, p)
+	}
+	return r, nil
+}
+
+// Redact returns args with matching fields replaced. Arguments that are not
+// valid JSON are dropped entirely rather than stored verbatim.
+func (r *Redactor) Redact(args json.RawMessage) json.RawMessage {
+	args = bytes.TrimSpace(args)
+	if len(args) == 0 || bytes.Equal(args, []byte("null")) {
+		return json.RawMessage(`{}`)
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return json.RawMessage(`{"_unparseable":true}`)
+	}
+	b, err := json.Marshal(r.walk(v, ""))
+	if err != nil {
+		return json.RawMessage(`{"_unparseable":true}`)
+	}
+	if len(b) > maxAuditArgs {
+		return json.RawMessage(fmt.Sprintf(`{"_truncated":true,"bytes":%d}`, len(b)))
+	}
+	return b
+}
+
+func (r *Redactor) walk(v any, prefix string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			if r.match(k, p) {
+				t[k] = redacted
+				continue
+			}
+			t[k] = r.walk(child, p)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = r.walk(child, prefix)
+		}
+	}
+	return v
+}
+
+func (r *Redactor) match(key, dotted string) bool {
+	key, dotted = strings.ToLower(key), strings.ToLower(dotted)
+	for _, p := range r.patterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, dotted); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// audit records one tools/call. Failures to write are logged, never
+// returned: the audit trail must not break tool calls.
+func (s *Server) audit(ctx context.Context, tool string, args json.RawMessage, start time.Time, res any, rerr *rpcErr) {
+	if s.store == nil {
+		return
+	}
+	e := store.AuditEvent{
+		TS:            start,
+		Actor:         authn.Actor(ctx),
+		SessionID:     sessionFrom(ctx),
+		Tool:          tool,
+		ArgumentsJSON: s.redactor.Redact(args),
+		DurationMS:    time.Since(start).Milliseconds(),
+	}
+	e.Outcome, e.Error = callOutcome(ctx, res, rerr)
+
+	wctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.store.RecordAudit(wctx, e); err != nil {
+		fmt.Fprintf(os.Stderr, "mcp audit: %s: %v\n", tool, err)
+	}
+}
+
+// callOutcome classifies a finished tools/call as one of the store.Audit*
+// outcomes, with the error message to record.
+func callOutcome(ctx context.Context, res any, rerr *rpcErr) (outcome, msg string) {
+	switch {
+	case errors.Is(context.Cause(ctx), errCancelledByClient):
+		return store.AuditCancelled, ""
+	case rerr != nil && rerr.Code == codeForbidden:
+		return store.AuditForbidden, rerr.Message
+	case rerr != nil && (rerr.Code == codeRateLimited || rerr.Code == codeOverloaded):
+		return store.AuditThrottled, rerr.Message
+	case rerr != nil && rerr.Code == codeInvalidParams:
+		return store.AuditRejected, rerr.Message
+	case rerr != nil:
+		return store.AuditError, rerr.Message
+	}
+	if r, ok := res.(CallToolResult); ok && r.IsError {
+		if len(r.Content) > 0 {
+			return store.AuditError, truncate(r.Content[0].Text, 1024)
+		}
+		return store.AuditError, ""
+	}
+	return store.AuditOK, ""
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor([]string{"config.dsn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.Redact(json.RawMessage(`{
+		"name": "demo",
+		"api_token": "t0k",
+		"Auth": {"Password": "pw", "user": "bob"},
+		"config": {"dsn": "postgres://u:p@h/db", "region": "us"},
+		"hosts": [{"ssh_private_key": "---", "addr": "10.0.0.1"}],
+		"count": 3
+	}`))
+	var v map[string]any
+	if err := json.Unmarshal(got, &v); err != nil {
+		t.Fatal(err)
+	}
+	s := string(got)
+	for _, secret := range []string{"t0k", `"pw"`, "postgres://", `"---"`} {
+		if strings.Contains(s, secret) {
+			t.Errorf("%s leaked: %s", secret, s)
+		}
+	}
+	for _, kept := range []string{`"demo"`, `"bob"`, `"us"`, `"10.0.0.1"`, `"count":3`} {
+		if !strings.Contains(s, kept) {
+			t.Errorf("%s missing: %s", kept, s)
+		}
+	}
+
+	if string(r.Redact(nil)) != "{}" {
+		t.Errorf("nil args: %s", r.Redact(nil))
+	}
+	if _, err := NewRedactor([]string{"["}); err == nil {
+		t.Error("bad pattern accepted")
+	}
+}
+
+func TestServerAuditsToolCalls(t *testing.T) {
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toks, _ := authn.ParseTokens("reader alice\n")
+	srv := NewServer(ServerOptions{Store: st, Auth: toks})
+	sc, _ := compileSchema(json.RawMessage(`{"type":"object"}`))
+	srv.tools["demo.apply"] = &ToolSpec{
+		Tool:    Tool{Name: "demo.apply"},
+		Scope:   authn.ScopeApply,
+		Handler: func(context.Context, store.Store, json.RawMessage) (any, error) { return nil, nil },
+		schema:  sc,
+	}
+	call := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer reader")
+		req.Header.Set("Mcp-Session-Id", "sess-1")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d", body, rec.Code)
+		}
+	}
+	call(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"config_yaml":"kind: x","token":"zzz"}}}`)
+	call(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"stackflow.plan.dns","arguments":{"config_yaml":"kind: StackFlow\nmetadata: {name: demo}\nglobal: {domain: example.com, dns_provider: cloudflare, cloud: gcp}\ntargets: []\n"}}}`)
+	call(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"nope"}}`)
+	call(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"demo.apply"}}`)
+	call(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"config_yaml":"kind: x"}}}`)
+	call(`{"jsonrpc":"2.0","id":6,"method":"tools/list"}`)
+
+	events, err := st.ListAudit(context.Background(), store.AuditFilter{})
+	if err != nil || len(events) != 5 {
+		t.Fatalf("audit = %+v, %v", events, err)
+	}
+	outcomes := map[string]int{}
+	for _, e := range events {
+		outcomes[e.Tool+" "+e.Outcome]++
+		if e.Actor != "alice" || e.SessionID != "sess-1" {
+			t.Errorf("%s: %+v", e.Tool, e)
+		}
+		if strings.Contains(string(e.ArgumentsJSON), "zzz") {
+			t.Errorf("%s: token not redacted: %s", e.Tool, e.ArgumentsJSON)
+		}
+		if e.Outcome != store.AuditOK && e.Error == "" {
+			t.Errorf("%s: missing error", e.Tool)
+		}
+	}
+	for _, k := range []string{
+		"stackflow.validate rejected", // "token" is not in its schema
+		"stackflow.validate error",
+		"stackflow.plan.dns ok",
+		"nope rejected",
+		"demo.apply forbidden",
+	} {
+		if outcomes[k] != 1 {
+			t.Errorf("want one %q, got %v", k, outcomes)
+		}
+	}
+}
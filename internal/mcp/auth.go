@@ -0,0 +1,171 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"xcloudflow/internal/secrets"
+	"xcloudflow/internal/store"
+)
+
+// Authenticator adds credentials to an outgoing MCP request. It is called
+// for every attempt, so implementations can refresh short-lived tokens.
+type Authenticator interface {
+	Authorize(ctx context.Context, req *http.Request) error
+}
+
+// TokenSource yields bearer tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// BearerAuth sends "Authorization: Bearer <token>".
+type BearerAuth struct {
+	Source TokenSource
+}
+
+func (a BearerAuth) Authorize(ctx context.Context, req *http.Request) error {
+	tok, err := a.Source.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("mcp auth: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return nil
+}
+
+// StaticToken is a fixed bearer token.
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) { return string(t), nil }
+
+// SecretToken reads the token from a secret reference on every call, so
+// rotated secrets (re-mounted files) are picked up without a restart.
+type SecretToken struct {
+	Ref string
+}
+
+// Token fails permanently when the secret is missing or empty.
+func (t SecretToken) Token(context.Context) (string, error) {
+	tok, err := secrets.Resolve(t.Ref)
+	if err != nil {
+		return "", permanentError{err}
+	}
+	return tok, nil
+}
+
+// OIDCTokenSource mints Google-signed ID tokens for Audience from the
+// metadata server of the runtime service account (Cloud Run, GCE, GKE with
+// workload identity). Tokens are cached until shortly before they expire.
+type OIDCTokenSource struct {
+	Audience string
+	// MetadataHost defaults to $GCE_METADATA_HOST, then
+	// metadata.google.internal.
+	MetadataHost string
+	HTTP         *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// oidcRefreshSkew renews cached ID tokens this long before they expire.
+const oidcRefreshSkew = 5 * time.Minute
+
+// Token fails permanently when the metadata server refuses the request
+// (4xx other than 429, e.g. no service account); network errors and 5xx
+// responses are left to the client's retry.
+func (s *OIDCTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Add(oidcRefreshSkew).Before(s.expiry) {
+		return s.token, nil
+	}
+	host := s.MetadataHost
+	if host == "" {
+		host = os.Getenv("GCE_METADATA_HOST")
+	}
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	hc := s.HTTP
+	if hc == nil {
+		hc = &http.Client{Timeout: 5 * time.Second}
+	}
+	u := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/identity?format=full&audience=" + url.QueryEscape(s.Audience)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := hc.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc token: %w", err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("oidc token: metadata server: http %d: %s", res.StatusCode, strings.TrimSpace(string(b)))
+		if res.StatusCode/100 == 4 && res.StatusCode != http.StatusTooManyRequests {
+			err = permanentError{err}
+		}
+		return "", err
+	}
+	tok := strings.TrimSpace(string(b))
+	if tok == "" {
+		return "", permanentError{fmt.Errorf("oidc token: metadata server returned an empty token")}
+	}
+	s.token, s.expiry = tok, jwtExpiry(tok)
+	return tok, nil
+}
+
+// jwtExpiry reads the exp claim without verifying the token (we minted it;
+// the receiver verifies). Unknown expiry means "do not cache".
+func jwtExpiry(tok string) time.Time {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(b, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// AuthForServer builds the authenticator for a registered server from its
+// auth_type: none, bearer (token from SecretRef) or oidc (ID token for
+// Audience, defaulting to the server URL).
+func AuthForServer(srv store.MCPServer) (Authenticator, error) {
+	switch srv.AuthType {
+	case "", "none":
+		return nil, nil
+	case "bearer":
+		if srv.SecretRef == "" {
+			return nil, fmt.Errorf("mcp server %s: auth bearer needs a secret ref", srv.Name)
+		}
+		return BearerAuth{Source: SecretToken{Ref: srv.SecretRef}}, nil
+	case "oidc":
+		aud := srv.Audience
+		if aud == "" {
+			aud = srv.BaseURL
+		}
+		return BearerAuth{Source: &OIDCTokenSource{Audience: aud}}, nil
+	default:
+		return nil, fmt.Errorf("mcp server %s: unknown auth type %q", srv.Name, srv.AuthType)
+	}
+}
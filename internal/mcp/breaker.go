@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a consecutive-failure circuit breaker.
+//
+// closed: calls pass; Threshold consecutive failures open it.
+// open: calls are refused until Cooldown has passed.
+// half-open: one trial call passes; success closes, failure re-opens.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	trial    bool      // a half-open trial call is in flight
+}
+
+// Breaker states as reported by state().
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may proceed. Every allowed call must be
+// followed by exactly one done.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.trial || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// done records the outcome of an allowed call. It returns the state change,
+// if any ("open" or "closed"), so callers can log or persist it.
+func (b *breaker) done(ok bool) (changed string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := !b.openedAt.IsZero()
+	b.trial = false
+	if ok {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		if wasOpen {
+			return breakerClosed
+		}
+		return ""
+	}
+	b.failures++
+	if wasOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		if !wasOpen {
+			return breakerOpen
+		}
+	}
+	return ""
+}
+
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openedAt.IsZero():
+		return breakerClosed
+	case b.trial || b.now().Sub(b.openedAt) >= b.cooldown:
+		return breakerHalfOpen
+	default:
+		return breakerOpen
+	}
+}
@@ -1,63 +1,426 @@
 package mcp
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"xcloudflow/internal/store"
 )
 
+// Client speaks MCP over Streamable HTTP. Responses may come back as plain
+// JSON or as an SSE stream; both are handled.
+//
+// Idempotent calls (initialize, tools/list, resources/list) are retried on
+// transport errors and on 429/502/503/504; tools/call is never retried.
+//
+// A Client may be shared by concurrent calls once Initialize has returned.
+// Initialize itself writes the session fields unguarded, so it must not run
+// while other calls are in flight; start a new session on a new Client.
 type Client struct {
 	BaseURL string
 	HTTP    *http.Client
+	Auth    Authenticator // optional
+	Retry   RetryPolicy
+
+	// Set by Initialize and sent on every later request.
+	ProtocolVersion string
+	SessionID       string
+
+	nextID atomic.Int64
+}
+
+// RetryPolicy is exponential backoff with full jitter.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts (default 3; 1 disables retries)
+	BaseDelay   time.Duration // default 200ms
+	MaxDelay    time.Duration // default 5s; also caps Retry-After
+}
+
+// RPCError is a JSON-RPC error returned by the server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp: %s (code %d)", e.Message, e.Code)
+}
+
+// HTTPError is a non-2xx HTTP response.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("mcp: http %d", e.StatusCode)
+	}
+	return fmt.Sprintf("mcp: http %d: %s", e.StatusCode, e.Body)
 }
 
+// permanentError marks failures that a retry cannot fix, such as missing or
+// rejected credentials. Token sources return it themselves; other
+// Authorize errors (e.g. the metadata server being unreachable) are retried.
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
 func NewClient(baseURL string) *Client {
 	return &Client{
 		BaseURL: baseURL,
-		HTTP:   &http.Client{Timeout: 15 * time.Second},
+		HTTP:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// NewClientForServer returns a client for a registered server with its
+// configured auth.
+func NewClientForServer(srv store.MCPServer) (*Client, error) {
+	auth, err := AuthForServer(srv)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(srv.BaseURL)
+	c.Auth = auth
+	return c, nil
+}
+
+// Initialize performs the MCP handshake and sends notifications/initialized.
+func (c *Client) Initialize(ctx context.Context, info Implementation) (InitializeResult, error) {
+	params := struct {
+		ProtocolVersion string          `json:"protocolVersion"`
+		Capabilities    json.RawMessage `json:"capabilities"`
+		ClientInfo      Implementation  `json:"clientInfo"`
+	}{LatestProtocolVersion, json.RawMessage(`{}`), info}
+	var res InitializeResult
+	httpRes, err := c.call(ctx, "initialize", params, nil, true, &res)
+	if err != nil {
+		return res, err
+	}
+	if !slices.Contains(supportedProtocolVersions, res.ProtocolVersion) {
+		return res, fmt.Errorf("mcp: server offered unsupported protocol version %q", res.ProtocolVersion)
+	}
+	c.ProtocolVersion = res.ProtocolVersion
+	if sid := httpRes.Header.Get("Mcp-Session-Id"); sid != "" {
+		c.SessionID = sid
+	}
+	return res, c.notify(ctx, "notifications/initialized", nil)
+}
+
+// CallTool invokes a tool. Tool failures come back as a result with IsError
+// set; protocol failures as *RPCError.
+func (c *Client) CallTool(ctx context.Context, name string, args any) (CallToolResult, error) {
+	params := map[string]any{"name": name}
+	if args != nil {
+		params["arguments"] = args
 	}
+	var res CallToolResult
+	_, err := c.call(ctx, "tools/call", params, nil, false, &res)
+	return res, err
+}
+
+// ListResources returns every resource, following pagination cursors.
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	var out []Resource
+	cursor := ""
+	for page := 0; page < 100; page++ {
+		var params any
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var res struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if _, err := c.call(ctx, "resources/list", params, nil, true, &res); err != nil {
+			return nil, err
+		}
+		out = append(out, res.Resources...)
+		if res.NextCursor == "" {
+			return out, nil
+		}
+		cursor = res.NextCursor
+	}
+	return nil, fmt.Errorf("mcp: resources/list: too many pages")
 }
 
 func (c *Client) ToolsList(ctx context.Context) ([]Tool, error) {
-	req := rpcReq{JSONRPC: "2.0", ID: 1, Method: "tools/list"}
-	var resp struct {
-		JSONRPC string `json:"jsonrpc"`
-		ID      any    `json:"id"`
-		Result  struct {
-			Tools []Tool `json:"tools"`
-		} `json:"result"`
-		Error *rpcErr `json:"error"`
+	tools, _, _, err := c.ToolsListIfChanged(ctx, "")
+	return tools, err
+}
+
+// ToolsListIfChanged fetches tools/list unless it still matches etag.
+// It sends If-None-Match (servers may answer 304) and otherwise compares etag
+// against the server's ETag header or, if absent, a hash of the tool list.
+// When unchanged is true, tools is nil.
+func (c *Client) ToolsListIfChanged(ctx context.Context, etag string) (tools []Tool, newETag string, unchanged bool, err error) {
+	var res struct {
+		Tools []Tool `json:"tools"`
 	}
-	if err := c.call(ctx, req, &resp); err != nil {
+	hdr := http.Header{}
+	if etag != "" {
+		hdr.Set("If-None-Match", etag)
+	}
+	httpRes, err := c.call(ctx, "tools/list", nil, hdr, true, &res)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if httpRes.StatusCode == http.StatusNotModified {
+		return nil, etag, true, nil
+	}
+	newETag = httpRes.Header.Get("ETag")
+	if newETag == "" {
+		newETag = toolsETag(res.Tools)
+	}
+	if etag != "" && newETag == etag {
+		return nil, etag, true, nil
+	}
+	return res.Tools, newETag, false, nil
+}
+
+// call sends one request and decodes its result into out. A 304 response is
+// returned without decoding.
+func (c *Client) call(ctx context.Context, method string, params any, hdr http.Header, idempotent bool, out any) (*http.Response, error) {
+	id := c.nextID.Add(1)
+	body, err := json.Marshal(rpcReq{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
 		return nil, err
 	}
-	if resp.Error != nil {
-		return nil, fmt.Errorf(resp.Error.Message)
+	p := c.Retry.withDefaults()
+	if !idempotent {
+		p.MaxAttempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		res, result, err := c.roundTrip(ctx, body, hdr, id)
+		if err == nil {
+			if out != nil && len(result) > 0 {
+				if err := json.Unmarshal(result, out); err != nil {
+					return res, fmt.Errorf("mcp: %s: decode result: %w", method, err)
+				}
+			}
+			return res, nil
+		}
+		if attempt >= p.MaxAttempts || !retryable(ctx, err) {
+			return res, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(p.delay(attempt, err)):
+		}
 	}
-	return resp.Result.Tools, nil
 }
 
-func (c *Client) call(ctx context.Context, req any, out any) error {
-	b, err := json.Marshal(req)
+// notify sends a notification; servers answer 202 with no body.
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	body, err := json.Marshal(struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{"2.0", method, params})
 	if err != nil {
 		return err
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL, bytes.NewReader(b))
+	res, err := c.post(ctx, body, nil)
 	if err != nil {
 		return err
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	res, err := c.HTTP.Do(httpReq)
+	res.Body.Close()
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, body []byte, hdr http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL, bytes.NewReader(body))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if c.ProtocolVersion != "" {
+		req.Header.Set("MCP-Protocol-Version", c.ProtocolVersion)
+	}
+	if c.SessionID != "" {
+		req.Header.Set("Mcp-Session-Id", c.SessionID)
+	}
+	if c.Auth != nil {
+		if err := c.Auth.Authorize(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 && res.StatusCode != http.StatusNotModified {
+		defer res.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, &HTTPError{
+			StatusCode: res.StatusCode,
+			Body:       strings.TrimSpace(string(b)),
+			retryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+	return res, nil
+}
+
+// roundTrip POSTs body and extracts the response to request id, from either
+// a JSON body or an SSE stream (notifications on the stream are skipped).
+func (c *Client) roundTrip(ctx context.Context, body []byte, hdr http.Header, id int64) (*http.Response, json.RawMessage, error) {
+	res, err := c.post(ctx, body, hdr)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer res.Body.Close()
-	if res.StatusCode/100 != 2 {
-		return fmt.Errorf("http %d", res.StatusCode)
+	if res.StatusCode == http.StatusNotModified {
+		return res, nil, nil
+	}
+
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
 	}
-	return json.NewDecoder(res.Body).Decode(out)
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		want := strconv.FormatInt(id, 10)
+		found := false
+		err = readEventStream(res.Body, func(data []byte) bool {
+			msg.ID, msg.Result, msg.Error = nil, nil, nil
+			if json.Unmarshal(data, &msg) != nil || string(bytes.TrimSpace(msg.ID)) != want {
+				return true
+			}
+			found = true
+			return false
+		})
+		if err == nil && !found {
+			err = fmt.Errorf("mcp: event stream ended without a response")
+		}
+	} else {
+		err = json.NewDecoder(res.Body).Decode(&msg)
+	}
+	if err != nil {
+		return res, nil, err
+	}
+	if msg.Error != nil {
+		return res, nil, msg.Error
+	}
+	return res, msg.Result, nil
 }
 
+// readEventStream calls fn with the data of each event until fn returns false or
+// the stream ends.
+func readEventStream(r io.Reader, fn func(data []byte) bool) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	var data []byte
+	for sc.Scan() {
+		line := sc.Bytes()
+		switch {
+		case len(line) == 0:
+			if len(data) > 0 && !fn(data) {
+				return nil
+			}
+			data = data[:0]
+		case bytes.HasPrefix(line, []byte("data:")):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		fn(data)
+	}
+	return nil
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 200 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	return p
+}
+
+// delay is the wait before attempt+1: Retry-After when the server sent one,
+// otherwise a random duration up to BaseDelay*2^(attempt-1).
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	var he *HTTPError
+	if errors.As(err, &he) && he.retryAfter > 0 {
+		return min(he.retryAfter, p.MaxDelay)
+	}
+	d := min(p.BaseDelay<<(attempt-1), p.MaxDelay)
+	return time.Duration(rand.Int64N(int64(d)) + 1)
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var rpc *RPCError
+	var perm permanentError
+	if errors.As(err, &rpc) || errors.As(err, &perm) {
+		return false
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		switch he.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// Transport failures (connection refused/reset, timeouts, truncated
+	// bodies).
+	return true
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// toolsETag is a strong ETag over the JSON encoding of tools.
+func toolsETag(tools []Tool) string {
+	b, _ := json.Marshal(tools)
+	h := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
@@ -0,0 +1,226 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+// requireBearer rejects requests without the expected token, like a Cloud
+// Run service with IAM auth in front of an MCP server.
+func requireBearer(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func testClient(url string) *Client {
+	c := NewClient(url)
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	return c
+}
+
+func TestClientSession(t *testing.T) {
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runID, err := st.CreateRun(context.Background(), store.Run{Stack: "demo", Phase: "plan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(requireBearer("s3cret", NewServer(ServerOptions{Store: st})))
+	defer ts.Close()
+	ctx := context.Background()
+
+	c := testClient(ts.URL)
+	_, err = c.Initialize(ctx, Implementation{Name: "test", Version: "0"})
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("without token: %v", err)
+	}
+
+	t.Setenv("XCF_TEST_MCP_TOKEN", "s3cret")
+	c.Auth = BearerAuth{Source: SecretToken{Ref: "env:XCF_TEST_MCP_TOKEN"}}
+	ir, err := c.Initialize(ctx, Implementation{Name: "test", Version: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ir.ServerInfo.Name != "xcloudflow" || c.ProtocolVersion != LatestProtocolVersion || ir.Capabilities.Resources == nil {
+		t.Fatalf("initialize = %+v", ir)
+	}
+
+	// Answered over SSE (the client accepts event streams), with a progress
+	// notification ahead of the result.
+	res, err := c.CallTool(ctx, "stackflow.plan.dns", map[string]any{
+		"config_yaml": "kind: StackFlow\nmetadata: {name: demo}\nglobal: {domain: example.com, dns_provider: cloudflare, cloud: gcp}\ntargets: []\n",
+	})
+	if err != nil || res.IsError || len(res.Content) != 1 {
+		t.Fatalf("CallTool = %+v, %v", res, err)
+	}
+	res, err = c.CallTool(ctx, "stackflow.validate", map[string]any{"config_yaml": "kind: x"})
+	if err != nil || !res.IsError {
+		t.Fatalf("tool failure should be a result with isError: %+v, %v", res, err)
+	}
+
+	_, err = c.CallTool(ctx, "no.such.tool", nil)
+	var rpc *RPCError
+	if !errors.As(err, &rpc) || rpc.Code != codeInvalidParams || !strings.Contains(rpc.Message, "unknown tool") {
+		t.Fatalf("unknown tool: %v", err)
+	}
+
+	resources, err := c.ListResources(ctx)
+	if err != nil || len(resources) != 1 || resources[0].URI != "xcf://runs/"+runID {
+		t.Fatalf("ListResources = %+v, %v", resources, err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls, failFirst atomic.Int32
+	failFirst.Store(2)
+	srv := NewServer(ServerOptions{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failFirst.Load() {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	c := testClient(ts.URL)
+
+	tools, err := c.ToolsList(ctx)
+	if err != nil || len(tools) == 0 || calls.Load() != 3 {
+		t.Fatalf("ToolsList after 2x 503: %d tools, %v, %d calls", len(tools), err, calls.Load())
+	}
+
+	// tools/call is not idempotent: one attempt only.
+	calls.Store(0)
+	_, err = c.CallTool(ctx, "stackflow.validate", map[string]any{"config_yaml": "x"})
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Fatalf("CallTool on 503: %v after %d calls", err, calls.Load())
+	}
+
+	// Give up after MaxAttempts.
+	calls.Store(0)
+	failFirst.Store(100)
+	if _, err := c.ToolsList(ctx); err == nil || calls.Load() != 3 {
+		t.Fatalf("ToolsList: %v after %d calls", err, calls.Load())
+	}
+}
+
+func fakeIDToken(exp time.Time) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"RS256"}`)) + "." + enc([]byte(fmt.Sprintf(`{"aud":"x","exp":%d}`, exp.Unix()))) + ".sig"
+}
+
+func TestOIDCTokenSource(t *testing.T) {
+	var mints atomic.Int32
+	meta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Query().Get("audience") != "https://svc.example" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mints.Add(1)
+		fmt.Fprint(w, fakeIDToken(time.Now().Add(time.Hour)))
+	}))
+	defer meta.Close()
+
+	tok := fakeIDToken(time.Now().Add(time.Hour))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || len(r.Header.Get("Authorization")) != len("Bearer ")+len(tok) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		NewServer(ServerOptions{}).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(meta.URL, "http://"))
+	c, err := NewClientForServer(store.MCPServer{Name: "svc", BaseURL: ts.URL, AuthType: "oidc", Audience: "https://svc.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := c.ToolsList(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if mints.Load() != 1 {
+		t.Fatalf("minted %d tokens, want 1 (cached)", mints.Load())
+	}
+}
+
+func TestOIDCTokenMintRetry(t *testing.T) {
+	var status atomic.Int32
+	var mints atomic.Int32
+	meta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mints.Add(1) == 1 || status.Load() == http.StatusForbidden {
+			http.Error(w, "metadata", int(status.Load()))
+			return
+		}
+		fmt.Fprint(w, fakeIDToken(time.Now().Add(time.Hour)))
+	}))
+	defer meta.Close()
+	ts := httptest.NewServer(NewServer(ServerOptions{}))
+	defer ts.Close()
+	host := strings.TrimPrefix(meta.URL, "http://")
+
+	// A transient metadata server failure goes through the retry path.
+	status.Store(http.StatusServiceUnavailable)
+	c := testClient(ts.URL)
+	c.Auth = BearerAuth{Source: &OIDCTokenSource{Audience: ts.URL, MetadataHost: host}}
+	if _, err := c.ToolsList(context.Background()); err != nil || mints.Load() != 2 {
+		t.Fatalf("transient mint failure: %v after %d mints", err, mints.Load())
+	}
+
+	// A refused request (no identity for this audience) is not retried.
+	status.Store(http.StatusForbidden)
+	mints.Store(0)
+	c = testClient(ts.URL)
+	c.Auth = BearerAuth{Source: &OIDCTokenSource{Audience: ts.URL, MetadataHost: host}}
+	if _, err := c.ToolsList(context.Background()); err == nil || !strings.Contains(err.Error(), "http 403") || mints.Load() != 1 {
+		t.Fatalf("refused mint: %v after %d mints", err, mints.Load())
+	}
+}
+
+func TestAuthForServer(t *testing.T) {
+	for _, tc := range []struct {
+		srv     store.MCPServer
+		wantErr bool
+	}{
+		{store.MCPServer{AuthType: "none"}, false},
+		{store.MCPServer{AuthType: "bearer", SecretRef: "env:X"}, false},
+		{store.MCPServer{AuthType: "bearer"}, true},
+		{store.MCPServer{AuthType: "oidc", BaseURL: "https://svc"}, false},
+		{store.MCPServer{AuthType: "basic"}, true},
+	} {
+		if _, err := AuthForServer(tc.srv); (err != nil) != tc.wantErr {
+			t.Errorf("%+v: err = %v", tc.srv, err)
+		}
+	}
+
+	// A missing secret fails fast instead of being retried.
+	c := testClient("http://127.0.0.1:0")
+	c.Auth = BearerAuth{Source: SecretToken{Ref: "env:XCF_TEST_UNSET_TOKEN"}}
+	if _, err := c.ToolsList(context.Background()); err == nil || !strings.Contains(err.Error(), "secret is empty") {
+		t.Fatalf("missing secret: %v", err)
+	}
+}
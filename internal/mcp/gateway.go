@@ -0,0 +1,299 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+// Gateway federates the registered external MCP servers (xcf.mcp_servers).
+//
+// tools/list is answered from xcf.mcp_tools_cache (kept fresh by
+// `mcp servers refresh-tools`), with each tool exposed as "<server>.<tool>"
+// and filtered through the server's allow/deny patterns. tools/call on such
+// a name is proxied to the owning server. Each server has a circuit breaker
+// so a dead backend fails fast instead of holding callers for the full
+// timeout.
+type Gateway struct {
+	store store.Store
+	opts  GatewayOptions
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	servers  map[string]*gatewayServer // by server name
+}
+
+// GatewayOptions tunes a Gateway; zero values take the defaults.
+type GatewayOptions struct {
+	// CacheTTL is how long the registry snapshot is reused (default 30s).
+	CacheTTL time.Duration
+	// CallTimeout bounds one proxied tools/call (default 60s).
+	CallTimeout time.Duration
+	// FailureThreshold consecutive backend failures open the breaker
+	// (default 5); it half-opens after BreakerCooldown (default 30s).
+	FailureThreshold int
+	BreakerCooldown  time.Duration
+}
+
+type gatewayServer struct {
+	srv     store.MCPServer
+	tools   map[string]Tool // upstream name -> tool, after policy
+	breaker *breaker
+
+	mu          sync.Mutex
+	client      *Client
+	initialized bool
+}
+
+var errToolDenied = errors.New("tool not allowed by gateway policy")
+
+func NewGateway(st store.Store, opts GatewayOptions) *Gateway {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = 30 * time.Second
+	}
+	if opts.CallTimeout <= 0 {
+		opts.CallTimeout = 60 * time.Second
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = 30 * time.Second
+	}
+	return &Gateway{store: st, opts: opts, servers: map[string]*gatewayServer{}}
+}
+
+// matchTool reports whether an upstream tool name matches any pattern.
+func matchTool(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toolAllowed applies a server's allow/deny patterns to an upstream name.
+func toolAllowed(srv store.MCPServer, name string) bool {
+	if matchTool(srv.DenyTools, name) {
+		return false
+	}
+	return len(srv.AllowTools) == 0 || matchTool(srv.AllowTools, name)
+}
+
+// snapshot returns the current servers, reloading the registry when the
+// cached copy is older than CacheTTL. On a reload error the previous
+// snapshot is kept.
+func (g *Gateway) snapshot(ctx context.Context) map[string]*gatewayServer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Since(g.loadedAt) < g.opts.CacheTTL {
+		return g.servers
+	}
+	servers, err := g.load(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mcp gateway: load registry:", err)
+		return g.servers
+	}
+	g.servers, g.loadedAt = servers, time.Now()
+	return servers
+}
+
+// load reads the registry. Breakers and clients of servers whose connection
+// settings did not change carry over. Caller must hold g.mu.
+func (g *Gateway) load(ctx context.Context) (map[string]*gatewayServer, error) {
+	srvs, err := g.store.ListMCPServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caches, err := g.store.ListMCPToolsCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cached := map[string]json.RawMessage{}
+	for _, c := range caches {
+		cached[c.ServerID] = c.Tools
+	}
+	out := map[string]*gatewayServer{}
+	for _, srv := range srvs {
+		if !srv.Enabled {
+			continue
+		}
+		var tools []Tool
+		if raw := cached[srv.ServerID]; len(raw) > 0 {
+			if err := json.Unmarshal(raw, &tools); err != nil {
+				fmt.Fprintf(os.Stderr, "mcp gateway: %s: bad tools cache: %v\n", srv.Name, err)
+			}
+		}
+		gs := &gatewayServer{srv: srv, tools: map[string]Tool{}}
+		if prev, ok := g.servers[srv.Name]; ok && sameEndpoint(prev.srv, srv) {
+			prev.mu.Lock()
+			gs.breaker, gs.client, gs.initialized = prev.breaker, prev.client, prev.initialized
+			prev.mu.Unlock()
+		} else {
+			gs.breaker = newBreaker(g.opts.FailureThreshold, g.opts.BreakerCooldown)
+		}
+		for _, t := range tools {
+			if t.Name != "" && toolAllowed(srv, t.Name) {
+				gs.tools[t.Name] = t
+			}
+		}
+		out[srv.Name] = gs
+	}
+	return out, nil
+}
+
+func sameEndpoint(a, b store.MCPServer) bool {
+	return a.ServerID == b.ServerID && a.BaseURL == b.BaseURL && a.AuthType == b.AuthType &&
+		a.Audience == b.Audience && a.SecretRef == b.SecretRef
+}
+
+// Tools lists the federated tools as "<server>.<tool>", sorted by name.
+func (g *Gateway) Tools(ctx context.Context) []Tool {
+	var out []Tool
+	for name, gs := range g.snapshot(ctx) {
+		for _, t := range gs.tools {
+			t.Name = name + "." + t.Name
+			if t.Description != "" {
+				t.Description = "[" + name + "] " + t.Description
+			} else {
+				t.Description = "[" + name + "]"
+			}
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// resolve splits a namespaced tool name into its server and upstream tool.
+// Server names may contain dots, so the longest matching server wins.
+func (g *Gateway) resolve(ctx context.Context, name string) (*gatewayServer, string, bool) {
+	var best *gatewayServer
+	var tool string
+	for srvName, gs := range g.snapshot(ctx) {
+		rest, ok := strings.CutPrefix(name, srvName+".")
+		if !ok || rest == "" {
+			continue
+		}
+		if best == nil || len(srvName) > len(best.srv.Name) {
+			best, tool = gs, rest
+		}
+	}
+	return best, tool, best != nil
+}
+
+// listed reports whether name is a federated tool in the cached tools list.
+func (g *Gateway) listed(ctx context.Context, name string) bool {
+	gs, tool, ok := g.resolve(ctx, name)
+	if !ok {
+		return false
+	}
+	_, ok = gs.tools[tool]
+	return ok
+}
+
+// applyTool reports whether name is a federated tool its server marked as
+// an apply tool (store.MCPServer.ApplyTools).
+func (g *Gateway) applyTool(ctx context.Context, name string) bool {
+	gs, tool, ok := g.resolve(ctx, name)
+	return ok && matchTool(gs.srv.ApplyTools, tool)
+}
+
+// CallTool proxies a namespaced tools/call. handled is false when name does
+// not belong to any registered server. JSON-RPC errors from the backend are
+// returned as *RPCError; transport failures and an open breaker as plain
+// errors (reported to the caller as tool errors).
+func (g *Gateway) CallTool(ctx context.Context, name string, args json.RawMessage) (res CallToolResult, handled bool, err error) {
+	gs, tool, ok := g.resolve(ctx, name)
+	if !ok {
+		return res, false, nil
+	}
+	if _, listed := gs.tools[tool]; !listed && !toolAllowed(gs.srv, tool) {
+		return res, true, fmt.Errorf("%w: %s", errToolDenied, name)
+	}
+	if !gs.breaker.allow() {
+		return res, true, fmt.Errorf("mcp server %s unavailable (circuit open after repeated failures)", gs.srv.Name)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, g.opts.CallTimeout)
+	defer cancel()
+	res, err = gs.call(cctx, tool, args)
+
+	// Only backend failures count against the breaker: protocol errors (bad
+	// arguments, unknown tool) and tool-level errors mean it is alive.
+	var rpc *RPCError
+	healthy := err == nil || errors.As(err, &rpc) || ctx.Err() != nil
+	switch gs.breaker.done(healthy) {
+	case breakerOpen:
+		fmt.Fprintf(os.Stderr, "mcp gateway: %s: circuit open: %v\n", gs.srv.Name, err)
+		g.recordHealth(gs.srv, err)
+	case breakerClosed:
+		fmt.Fprintf(os.Stderr, "mcp gateway: %s: circuit closed\n", gs.srv.Name)
+		g.recordHealth(gs.srv, nil)
+	}
+	if err != nil && !errors.As(err, &rpc) {
+		err = fmt.Errorf("mcp server %s: %w", gs.srv.Name, err)
+	}
+	return res, true, err
+}
+
+func (g *Gateway) recordHealth(srv store.MCPServer, checkErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.store.RecordMCPServerHealth(ctx, srv.ServerID, checkErr); err != nil {
+		fmt.Fprintf(os.Stderr, "mcp gateway: %s: record health: %v\n", srv.Name, err)
+	}
+}
+
+// call initializes the session on first use, then calls the tool.
+//
+// A Client's session fields are only written by Initialize, so a client is
+// never re-initialized once shared: a new session gets a fresh client, built
+// and initialized under gs.mu before any call can see it, while in-flight
+// calls finish on the old one.
+func (gs *gatewayServer) call(ctx context.Context, tool string, args json.RawMessage) (CallToolResult, error) {
+	gs.mu.Lock()
+	if gs.client == nil || !gs.initialized {
+		c, err := NewClientForServer(gs.srv)
+		if err != nil {
+			gs.mu.Unlock()
+			return CallToolResult{}, err
+		}
+		c.HTTP.Timeout = 0 // bounded by ctx
+		if _, err := c.Initialize(ctx, Implementation{Name: "xcloudflow-gateway", Version: "0.1"}); err != nil {
+			gs.mu.Unlock()
+			return CallToolResult{}, err
+		}
+		gs.client, gs.initialized = c, true
+	}
+	c := gs.client
+	gs.mu.Unlock()
+
+	var a any
+	if len(args) > 0 {
+		a = args
+	}
+	res, err := c.CallTool(ctx, tool, a)
+	var he *HTTPError
+	if errors.As(err, &he) && he.StatusCode == http.StatusNotFound && c.SessionID != "" {
+		// The backend dropped our session; handshake again next time,
+		// unless a concurrent call already did.
+		gs.mu.Lock()
+		if gs.client == c {
+			gs.initialized = false
+		}
+		gs.mu.Unlock()
+	}
+	return res, err
+}
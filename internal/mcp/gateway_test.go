@@ -0,0 +1,211 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+func TestGatewayFederatesTools(t *testing.T) {
+	ctx := context.Background()
+	backend := httptest.NewServer(NewServer(ServerOptions{}))
+	defer backend.Close()
+
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.UpsertMCPServer(ctx, store.MCPServer{
+		Name: "ops", BaseURL: backend.URL, Enabled: true, DenyTools: []string{"stackflow.plan.*"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.UpsertMCPServer(ctx, store.MCPServer{Name: "off", BaseURL: backend.URL, Enabled: false}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshTools(ctx, st, RefreshOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(ServerOptions{Store: st, Gateway: NewGateway(st, GatewayOptions{})})
+
+	var list struct {
+		Tools []Tool `json:"tools"`
+	}
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, &list); e != nil {
+		t.Fatal(e)
+	}
+	names := map[string]bool{}
+	for _, tool := range list.Tools {
+		names[tool.Name] = true
+	}
+	if !names["stackflow.validate"] || !names["ops.stackflow.validate"] || !names["ops.runs.watch"] {
+		t.Fatalf("missing local or federated tools: %v", names)
+	}
+	if names["ops.stackflow.plan.dns"] || names["off.stackflow.validate"] {
+		t.Fatalf("denied or disabled tools listed: %v", names)
+	}
+
+	var res CallToolResult
+	body := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"ops.stackflow.validate","arguments":{"config_yaml":"kind: x"}}}`
+	if e := rpcResult(t, srv, body, &res); e != nil || !res.IsError || !strings.Contains(res.Content[0].Text, "kind") {
+		t.Fatalf("proxied tool error should pass through as isError: %+v %+v", res, e)
+	}
+
+	// Backend protocol errors keep their code.
+	body = `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"ops.stackflow.validate","arguments":{"bogus":1}}}`
+	if e := rpcResult(t, srv, body, &res); e == nil || e.Code != codeInvalidParams {
+		t.Fatalf("backend invalid params: %+v", e)
+	}
+
+	body = `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"ops.stackflow.plan.dns","arguments":{"config_yaml":"x"}}}`
+	if e := rpcResult(t, srv, body, &res); e == nil || e.Code != codeInvalidParams || !strings.Contains(e.Message, "not allowed") {
+		t.Fatalf("denied tool: %+v", e)
+	}
+}
+
+func TestGatewayCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	var hits int
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer dead.Close()
+
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := st.UpsertMCPServer(ctx, store.MCPServer{Name: "dead", BaseURL: dead.URL, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools, _ := json.Marshal([]Tool{{Name: "ping"}})
+	if err := st.UpdateMCPToolsCache(ctx, id, tools, ""); err != nil {
+		t.Fatal(err)
+	}
+	gw := NewGateway(st, GatewayOptions{FailureThreshold: 2, BreakerCooldown: time.Hour})
+
+	for i := range 2 {
+		_, handled, err := gw.CallTool(ctx, "dead.ping", nil)
+		if !handled || err == nil || strings.Contains(err.Error(), "circuit open") {
+			t.Fatalf("call %d: handled=%v err=%v", i, handled, err)
+		}
+	}
+	before := hits
+	_, _, err = gw.CallTool(ctx, "dead.ping", nil)
+	if err == nil || !strings.Contains(err.Error(), "circuit open") || hits != before {
+		t.Fatalf("open breaker should fail fast: %v (hits %d -> %d)", err, before, hits)
+	}
+	srvs, _ := st.ListMCPServers(ctx)
+	if srvs[0].Health != store.MCPHealthError {
+		t.Fatalf("health = %q, want error", srvs[0].Health)
+	}
+
+	if _, handled, _ := gw.CallTool(ctx, "other.ping", nil); handled {
+		t.Fatal("unknown server prefix should not be handled")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	if !b.allow() || b.done(false) != breakerOpen || b.allow() {
+		t.Fatal("one failure should open the breaker")
+	}
+	now = now.Add(time.Minute)
+	if b.state() != breakerHalfOpen || !b.allow() || b.allow() {
+		t.Fatal("after cooldown exactly one trial call is allowed")
+	}
+	if b.done(false) != "" || b.allow() {
+		t.Fatal("failed trial re-opens the breaker")
+	}
+	now = now.Add(time.Minute)
+	if !b.allow() || b.done(true) != breakerClosed || b.state() != breakerClosed || !b.allow() {
+		t.Fatal("successful trial closes the breaker")
+	}
+}
+
+// TestGatewaySessionReinit has the backend expire its session every few
+// calls while calls run concurrently; run with -race.
+func TestGatewaySessionReinit(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var session, calls int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case "initialize":
+			session++
+			w.Header().Set("Mcp-Session-Id", fmt.Sprint("s", session))
+			writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Result: InitializeResult{ProtocolVersion: LatestProtocolVersion}})
+		case "notifications/initialized":
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			if r.Header.Get("Mcp-Session-Id") != fmt.Sprint("s", session) {
+				http.Error(w, "unknown session", http.StatusNotFound)
+				return
+			}
+			if calls++; calls%5 == 0 {
+				session++ // drop the session
+			}
+			writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Result: CallToolResult{Content: []Content{}}})
+		}
+	}))
+	defer backend.Close()
+
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := st.UpsertMCPServer(ctx, store.MCPServer{Name: "flaky", BaseURL: backend.URL, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools, _ := json.Marshal([]Tool{{Name: "ping"}})
+	if err := st.UpdateMCPToolsCache(ctx, id, tools, ""); err != nil {
+		t.Fatal(err)
+	}
+	gw := NewGateway(st, GatewayOptions{FailureThreshold: 1000})
+
+	var ok atomic.Int64
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if _, _, err := gw.CallTool(ctx, "flaky.ping", nil); err == nil {
+					ok.Add(1)
+				} else if !strings.Contains(err.Error(), "404") {
+					t.Errorf("call: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if ok.Load() == 0 || session < 2 {
+		t.Fatalf("ok calls %d, sessions %d", ok.Load(), session)
+	}
+}
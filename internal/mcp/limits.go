@@ -0,0 +1,271 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"xcloudflow/internal/authn"
+)
+
+// Limits bounds what a single server accepts. Zero values take the
+// defaults; a negative concurrency or rate disables that limit.
+//
+// Concurrency and rate limits apply to tools/call (local and federated),
+// globally and per caller. A caller is the authenticated subject, else the
+// client address (HTTP) or the stdio peer. Refused calls get a JSON-RPC
+// error right away instead of queueing.
+//
+// The client address is the TCP peer unless TrustedProxyHops is set. Behind a
+// load balancer or Cloud Run's front end the peer is the proxy, so every
+// unauthenticated client shares one per-caller bucket; set TrustedProxyHops
+// to take the address from X-Forwarded-For instead, or require auth.
+type Limits struct {
+	// MaxRequestBytes caps an HTTP body or stdio line (default 4 MiB).
+	MaxRequestBytes int64
+	// ToolTimeout bounds a tool call unless the tool sets its own
+	// ToolSpec.Timeout (default 60s).
+	ToolTimeout time.Duration
+
+	MaxConcurrent          int // in-flight tool calls (default 64)
+	MaxConcurrentPerCaller int // per caller (default 8)
+
+	// Token buckets: Rate calls/s refilled up to Burst.
+	Rate        float64 // default 50/s
+	Burst       int     // default 2*Rate
+	CallerRate  float64 // default 10/s
+	CallerBurst int     // default 2*CallerRate
+
+	// TrustedProxyHops is the number of proxies in front of the server that
+	// append to X-Forwarded-For (Cloud Run: 1, behind an external HTTPS load
+	// balancer: 2). The client address is the entry that many places from
+	// the right; entries further left are client-supplied and ignored. Zero
+	// uses the TCP peer address.
+	TrustedProxyHops int
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxRequestBytes <= 0 {
+		l.MaxRequestBytes = 4 << 20
+	}
+	if l.ToolTimeout <= 0 {
+		l.ToolTimeout = 60 * time.Second
+	}
+	if l.MaxConcurrent == 0 {
+		l.MaxConcurrent = 64
+	}
+	if l.MaxConcurrentPerCaller == 0 {
+		l.MaxConcurrentPerCaller = 8
+	}
+	if l.Rate == 0 {
+		l.Rate = 50
+	}
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(2 * l.Rate))
+	}
+	if l.CallerRate == 0 {
+		l.CallerRate = 10
+	}
+	if l.CallerBurst <= 0 {
+		l.CallerBurst = int(math.Ceil(2 * l.CallerRate))
+	}
+	return l
+}
+
+// bucket is a token bucket; a nil bucket never limits.
+type bucket struct {
+	rate, burst, tokens float64
+	last                time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	if rate < 0 {
+		return nil
+	}
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait is how long until a token is available (0 if one is now).
+func (b *bucket) wait(now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+type callerState struct {
+	active   int
+	bucket   *bucket
+	lastSeen time.Time
+}
+
+// limiter enforces the concurrency and rate parts of Limits.
+type limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu      sync.Mutex
+	active  int
+	global  *bucket
+	callers map[string]*callerState
+}
+
+// callerIdle is how long an idle caller's state is kept.
+const callerIdle = 10 * time.Minute
+
+func newLimiter(l Limits) *limiter {
+	lim := &limiter{limits: l, now: time.Now, callers: map[string]*callerState{}}
+	lim.global = newBucket(l.Rate, l.Burst, lim.now())
+	return lim
+}
+
+// acquire admits one call by caller. On success the returned release must
+// be called when the call ends.
+func (l *limiter) acquire(caller string) (release func(), rerr *rpcErr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	cs := l.callers[caller]
+	if cs == nil {
+		if len(l.callers) >= 1024 {
+			l.sweepLocked(now)
+		}
+		cs = &callerState{bucket: newBucket(l.limits.CallerRate, l.limits.CallerBurst, now)}
+		l.callers[caller] = cs
+	}
+	cs.lastSeen = now
+
+	if l.limits.MaxConcurrent > 0 && l.active >= l.limits.MaxConcurrent {
+		return nil, &rpcErr{Code: codeOverloaded, Message: "server busy: too many concurrent tool calls"}
+	}
+	if l.limits.MaxConcurrentPerCaller > 0 && cs.active >= l.limits.MaxConcurrentPerCaller {
+		return nil, &rpcErr{Code: codeOverloaded, Message: fmt.Sprintf("too many concurrent tool calls (limit %d per caller)", l.limits.MaxConcurrentPerCaller)}
+	}
+	if wait := max(l.global.wait(now), cs.bucket.wait(now)); wait > 0 {
+		return nil, &rpcErr{
+			Code:    codeRateLimited,
+			Message: "rate limit exceeded",
+			Data:    map[string]any{"retryAfterMs": wait.Milliseconds() + 1},
+		}
+	}
+	l.global.take()
+	cs.bucket.take()
+	l.active++
+	cs.active++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.active--
+			cs.active--
+		})
+	}, nil
+}
+
+// sweepLocked forgets idle callers whose bucket has refilled anyway.
+func (l *limiter) sweepLocked(now time.Time) {
+	for k, cs := range l.callers {
+		if cs.active == 0 && now.Sub(cs.lastSeen) > callerIdle {
+			delete(l.callers, k)
+		}
+	}
+}
+
+type callerKeyType struct{}
+
+var callerKey callerKeyType
+
+// withCaller records the unauthenticated caller (client address, stdio).
+func withCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// callerFrom identifies the caller for per-caller limits.
+func callerFrom(ctx context.Context) string {
+	if id, ok := authn.FromContext(ctx); ok {
+		return "sub:" + id.Subject
+	}
+	if c, ok := ctx.Value(callerKey).(string); ok && c != "" {
+		return c
+	}
+	return "anonymous"
+}
+
+// remoteCaller is the client host of an HTTP request: the X-Forwarded-For
+// entry hops places from the right, else the TCP peer.
+func remoteCaller(r *http.Request, hops int) string {
+	if hops > 0 {
+		var fwd []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, a := range strings.Split(v, ",") {
+				fwd = append(fwd, strings.TrimSpace(a))
+			}
+		}
+		if len(fwd) >= hops && fwd[len(fwd)-hops] != "" {
+			return "addr:" + fwd[len(fwd)-hops]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// HTTPTimeouts configure the *http.Server of an MCP endpoint.
+type HTTPTimeouts struct {
+	// ReadHeader and Read bound reading a request (defaults 10s, 30s).
+	ReadHeader time.Duration
+	Read       time.Duration
+	// Write bounds a response; it must exceed the longest tool timeout
+	// (default 150s). GET notification streams are exempt.
+	Write time.Duration
+	// Idle bounds keep-alive connections between requests (default 120s).
+	Idle time.Duration
+}
+
+// NewHTTPServer returns an *http.Server for h with the given timeouts.
+func NewHTTPServer(addr string, h http.Handler, t HTTPTimeouts) *http.Server {
+	if t.ReadHeader <= 0 {
+		t.ReadHeader = 10 * time.Second
+	}
+	if t.Read <= 0 {
+		t.Read = 30 * time.Second
+	}
+	if t.Write <= 0 {
+		t.Write = 150 * time.Second
+	}
+	if t.Idle <= 0 {
+		t.Idle = 120 * time.Second
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: t.ReadHeader,
+		ReadTimeout:       t.Read,
+		WriteTimeout:      t.Write,
+		IdleTimeout:       t.Idle,
+	}
+}
@@ -0,0 +1,173 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+func TestLimiterRateAndConcurrency(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lim := newLimiter(Limits{MaxConcurrent: 3, MaxConcurrentPerCaller: 2, Rate: -1, CallerRate: 1, CallerBurst: 2}.withDefaults())
+	lim.now = func() time.Time { return now }
+
+	r1, err := lim.acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := lim.acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lim.acquire("a"); err == nil || err.Code != codeOverloaded {
+		t.Fatalf("third concurrent call by a: %+v", err)
+	}
+	r1()
+	r1() // release is idempotent
+	// a's bucket (burst 2) is empty now.
+	if _, err := lim.acquire("a"); err == nil || err.Code != codeRateLimited {
+		t.Fatalf("a over rate: %+v", err)
+	} else if ms := err.Data.(map[string]any)["retryAfterMs"].(int64); ms < 900 || ms > 1001 {
+		t.Fatalf("retryAfterMs = %d", ms)
+	}
+	now = now.Add(time.Second)
+	r3, err := lim.acquire("a")
+	if err != nil {
+		t.Fatalf("after refill: %v", err)
+	}
+
+	// Global concurrency: a holds 2, b gets the last slot.
+	rb, err := lim.acquire("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lim.acquire("c"); err == nil || err.Code != codeOverloaded {
+		t.Fatalf("global limit: %+v", err)
+	}
+	r2()
+	r3()
+	rb()
+	if lim.active != 0 {
+		t.Fatalf("active = %d after releases", lim.active)
+	}
+}
+
+// blockingServer serves a tool that blocks until release is closed.
+func blockingServer(t *testing.T, limits Limits) (*Server, chan struct{}) {
+	t.Helper()
+	srv := NewServer(ServerOptions{Limits: limits})
+	release := make(chan struct{})
+	sc, _ := compileSchema(json.RawMessage(`{"type":"object"}`))
+	srv.tools["test.block"] = &ToolSpec{
+		Tool:   Tool{Name: "test.block"},
+		schema: sc,
+		Handler: func(ctx context.Context, _ store.Store, _ json.RawMessage) (any, error) {
+			select {
+			case <-release:
+				return map[string]any{"ok": true}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+	return srv, release
+}
+
+func TestServerLimits(t *testing.T) {
+	srv, release := blockingServer(t, Limits{MaxRequestBytes: 1024, MaxConcurrentPerCaller: 1, CallerRate: -1, Rate: -1})
+	const block = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test.block"}}`
+
+	code, b := post(t, srv, `{"jsonrpc":"2.0","id":1,"method":"ping","params":{"pad":"`+strings.Repeat("x", 2048)+`"}}`)
+	if code != http.StatusRequestEntityTooLarge || !strings.Contains(string(b), "exceeds 1024 bytes") {
+		t.Fatalf("oversized body: %d %s", code, b)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		post(t, srv, block)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		srv.limiter.mu.Lock()
+		active := srv.limiter.active
+		srv.limiter.mu.Unlock()
+		if active == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("blocking call never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var resp testResp
+	_, b = post(t, srv, block)
+	if err := json.Unmarshal(b, &resp); err != nil || resp.Error == nil || resp.Error.Code != codeOverloaded {
+		t.Fatalf("second concurrent call: %s", b)
+	}
+	// Other methods are not limited.
+	if code, _ := post(t, srv, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); code != http.StatusOK {
+		t.Fatalf("tools/list while busy: %d", code)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestServerToolTimeout(t *testing.T) {
+	srv, _ := blockingServer(t, Limits{ToolTimeout: 20 * time.Millisecond})
+	_, b := post(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test.block"}}`)
+	var resp struct {
+		Result CallToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil || !resp.Result.IsError || !strings.Contains(resp.Result.Content[0].Text, "timed out after 20ms") {
+		t.Fatalf("timeout result: %s", b)
+	}
+
+	if d := srv.tools["runs.watch"].Timeout; d < 120*time.Second {
+		t.Fatalf("runs.watch timeout %s is shorter than its maximum wait", d)
+	}
+}
+
+func TestLimitsDefaultBurst(t *testing.T) {
+	l := Limits{Rate: 5, CallerRate: 1.5}.withDefaults()
+	if l.Burst != 10 || l.CallerBurst != 3 {
+		t.Fatalf("derived bursts: %d %d", l.Burst, l.CallerBurst)
+	}
+	if l = (Limits{Burst: 7, CallerBurst: 1}).withDefaults(); l.Burst != 7 || l.CallerBurst != 1 {
+		t.Fatalf("explicit bursts: %d %d", l.Burst, l.CallerBurst)
+	}
+}
+
+func TestRemoteCaller(t *testing.T) {
+	for _, tc := range []struct {
+		fwd  []string
+		hops int
+		want string
+	}{
+		{nil, 0, "addr:10.0.0.1"},
+		{[]string{"203.0.113.9"}, 0, "addr:10.0.0.1"},
+		{[]string{"203.0.113.9"}, 1, "addr:203.0.113.9"},
+		// A client-supplied entry left of the trusted hops is ignored.
+		{[]string{"198.51.100.7, 203.0.113.9"}, 1, "addr:203.0.113.9"},
+		{[]string{"198.51.100.7, 203.0.113.9", "35.191.0.1"}, 2, "addr:203.0.113.9"},
+		// Fewer entries than hops: the request did not come through the proxies.
+		{[]string{"203.0.113.9"}, 2, "addr:10.0.0.1"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		r.RemoteAddr = "10.0.0.1:5555"
+		for _, v := range tc.fwd {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := remoteCaller(r, tc.hops); got != tc.want {
+			t.Errorf("%q hops %d: got %s, want %s", tc.fwd, tc.hops, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package mcp
+
+import (
+	"context"
+	"time"
+
+	"xcloudflow/internal/metrics"
+)
+
+// toolMetrics counts tools/call by tool and status, where status is the
+// audit outcome (ok, error, rejected, forbidden, throttled, cancelled).
+type toolMetrics struct {
+	calls    *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newToolMetrics(reg *metrics.Registry) *toolMetrics {
+	if reg == nil {
+		return nil
+	}
+	return &toolMetrics{
+		calls: reg.Counter("xcf_mcp_tool_calls_total",
+			"MCP tools/call requests by tool and status.", "tool", "status"),
+		duration: reg.Histogram("xcf_mcp_tool_call_duration_seconds",
+			"MCP tools/call latency by tool and status.", metrics.DefBuckets, "tool", "status"),
+	}
+}
+
+// observe records one finished tools/call. Names that are neither local
+// nor listed by the gateway are counted as "unknown" so callers cannot
+// grow the label set.
+func (s *Server) observe(ctx context.Context, tool string, start time.Time, res any, rerr *rpcErr) {
+	if s.metrics == nil {
+		return
+	}
+	if _, ok := s.tools[tool]; !ok && (s.gateway == nil || !s.gateway.listed(ctx, tool)) {
+		tool = "unknown"
+	}
+	status, _ := callOutcome(ctx, res, rerr)
+	s.metrics.calls.Inc(tool, status)
+	s.metrics.duration.Observe(time.Since(start).Seconds(), tool, status)
+}
@@ -0,0 +1,39 @@
+package mcp
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xcloudflow/internal/metrics"
+)
+
+func TestServerToolMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	srv := NewServer(ServerOptions{Metrics: reg})
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"config_yaml":"kind: x"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"bogus":1}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"no.such.tool"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"another.missing"}}`,
+	} {
+		post(t, srv, body)
+	}
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	for _, want := range []string{
+		`xcf_mcp_tool_calls_total{tool="stackflow.validate",status="error"} 1`,
+		`xcf_mcp_tool_calls_total{tool="stackflow.validate",status="rejected"} 1`,
+		`xcf_mcp_tool_calls_total{tool="unknown",status="rejected"} 2`,
+		`xcf_mcp_tool_call_duration_seconds_count{tool="stackflow.validate",status="error"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "no.such.tool") {
+		t.Errorf("unknown tool name leaked into labels:\n%s", out)
+	}
+}
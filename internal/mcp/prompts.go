@@ -0,0 +1,103 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"xcloudflow/internal/store"
+)
+
+// Prompts: every skill becomes a prompt named after it, backed by the copy
+// that wins resolution across sources (store.ResolveSkills).
+
+var errUnknownPrompt = errors.New("unknown prompt")
+
+var promptArguments = []PromptArgument{
+	{Name: "task", Description: "What you are trying to do; appended after the runbook."},
+}
+
+type skillPrompt struct {
+	Prompt
+	doc store.SkillDoc
+}
+
+func (s *Server) skillPrompts(ctx context.Context) ([]skillPrompt, error) {
+	if s.store == nil {
+		return nil, nil
+	}
+	resolved, err := store.ResolveSkills(ctx, s.store)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]skillPrompt, 0, len(resolved))
+	for _, r := range resolved {
+		d := r.Doc
+		desc := truncate(skillMeta(d).Description, 200)
+		if desc == "" {
+			desc = skillSummary(d.Content)
+		}
+		out = append(out, skillPrompt{
+			Prompt: Prompt{Name: r.Name, Description: desc, Arguments: promptArguments},
+			doc:    d,
+		})
+	}
+	return out, nil
+}
+
+func (s *Server) getPrompt(ctx context.Context, name string, args map[string]string) (GetPromptResult, error) {
+	prompts, err := s.skillPrompts(ctx)
+	if err != nil {
+		return GetPromptResult{}, err
+	}
+	for _, p := range prompts {
+		if p.Name != name {
+			continue
+		}
+		text := p.doc.Content
+		if task := strings.TrimSpace(args["task"]); task != "" {
+			text = strings.TrimRight(text, "\n") + "\n\n---\n\nTask: " + task
+		}
+		return GetPromptResult{
+			Description: p.Description,
+			Messages:    []PromptMessage{{Role: "user", Content: Content{Type: "text", Text: text}}},
+		}, nil
+	}
+	return GetPromptResult{}, fmt.Errorf("%w: %s", errUnknownPrompt, name)
+}
+
+// skillSummary is the first prose line of a SKILL.md: a frontmatter
+// "description:" if present, otherwise the first line that is not a heading.
+func skillSummary(content string) string {
+	lines := strings.Split(content, "\n")
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			l := strings.TrimSpace(lines[i])
+			if l == "---" {
+				lines = lines[i+1:]
+				break
+			}
+			if v, ok := strings.CutPrefix(l, "description:"); ok {
+				if v = strings.Trim(strings.TrimSpace(v), `"'`); v != "" {
+					return truncate(v, 200)
+				}
+			}
+		}
+	}
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "#") && l != "---" {
+			return truncate(l, 200)
+		}
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
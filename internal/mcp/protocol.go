@@ -0,0 +1,172 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// MCP protocol revisions this package speaks, newest first.
+const LatestProtocolVersion = "2025-06-18"
+
+var supportedProtocolVersions = []string{LatestProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// negotiateProtocolVersion echoes the client's version when supported and
+// otherwise offers the latest one; the client decides whether to continue.
+func negotiateProtocolVersion(requested string) string {
+	if slices.Contains(supportedProtocolVersions, requested) {
+		return requested
+	}
+	return LatestProtocolVersion
+}
+
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type InitializeParams struct {
+	ProtocolVersion string          `json:"protocolVersion"`
+	Capabilities    json.RawMessage `json:"capabilities,omitempty"`
+	ClientInfo      Implementation  `json:"clientInfo"`
+	Meta            requestMeta     `json:"_meta"`
+}
+
+// requestMeta is the params._meta object of a request.
+type requestMeta struct {
+	ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+}
+
+// UnmarshalJSON ignores unknown _meta keys even under strict param decoding.
+func (m *requestMeta) UnmarshalJSON(b []byte) error {
+	type plain requestMeta
+	return json.Unmarshal(b, (*plain)(m))
+}
+
+// listParams are the params of the */list requests. Lists are never
+// paginated (no nextCursor is returned), so any cursor is invalid.
+type listParams struct {
+	Cursor string      `json:"cursor,omitempty"`
+	Meta   requestMeta `json:"_meta"`
+}
+
+type ToolsCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe"`
+	ListChanged bool `json:"listChanged"`
+}
+
+type PromptsCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+type ServerCapabilities struct {
+	Tools     *ToolsCapability     `json:"tools,omitempty"`
+	Resources *ResourcesCapability `json:"resources,omitempty"`
+	Prompts   *PromptsCapability   `json:"prompts,omitempty"`
+}
+
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// Content is a tools/call content block. Only text is produced today.
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// CallToolResult is the tools/call result. Tool failures are reported here
+// with IsError (so the model can see them), not as JSON-RPC errors.
+type CallToolResult struct {
+	Content           []Content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError"`
+}
+
+// newToolResult wraps a tool's output (or error) in the MCP result shape.
+// The JSON text block mirrors structuredContent for clients that only read
+// content[].
+func newToolResult(out any, err error) CallToolResult {
+	if err != nil {
+		return CallToolResult{
+			Content: []Content{{Type: "text", Text: err.Error()}},
+			IsError: true,
+		}
+	}
+	b, merr := json.Marshal(out)
+	if merr != nil {
+		return newToolResult(nil, fmt.Errorf("encode result: %w", merr))
+	}
+	return CallToolResult{
+		Content:           []Content{{Type: "text", Text: string(b)}},
+		StructuredContent: out,
+	}
+}
+
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is a text resource body (resources/read).
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+
+	// MCP: resources/read of an unknown URI.
+	codeResourceNotFound = -32002
+	// The authenticated caller lacks the scope for the request.
+	codeForbidden = -32003
+	// tools/call refused by the rate limiter (data.retryAfterMs) or the
+	// concurrency limiter; see Limits.
+	codeRateLimited = -32004
+	codeOverloaded  = -32005
+)
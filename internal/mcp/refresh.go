@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+// RefreshOptions controls RefreshTools.
+type RefreshOptions struct {
+	Timeout     time.Duration // per server (default 10s)
+	Concurrency int           // servers polled in parallel (default 8)
+	Force       bool          // ignore cached etags
+}
+
+// RefreshResult is the outcome for one server.
+type RefreshResult struct {
+	Server string `json:"server"`
+	Status string `json:"status"` // updated | unchanged | error
+	Tools  int    `json:"tools,omitempty"`
+	ETag   string `json:"etag,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RefreshTools polls tools/list on every enabled server concurrently,
+// rewrites xcf.mcp_tools_cache only for changed lists (unchanged ones just
+// get a new fetched_at) and records per-server health. A failing server
+// does not stop the others.
+func RefreshTools(ctx context.Context, st store.Store, opts RefreshOptions) ([]RefreshResult, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+	srvs, err := st.ListMCPServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caches, err := st.ListMCPToolsCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	etags := map[string]string{}
+	for _, c := range caches {
+		etags[c.ServerID] = c.ETag
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, opts.Concurrency)
+		out []RefreshResult
+		mu  sync.Mutex
+	)
+	for _, srv := range srvs {
+		if !srv.Enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(srv store.MCPServer) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := refreshOne(ctx, st, srv, etags[srv.ServerID], opts)
+			mu.Lock()
+			out = append(out, res)
+			mu.Unlock()
+		}(srv)
+	}
+	wg.Wait()
+	sort.Slice(out, func(i, j int) bool { return out[i].Server < out[j].Server })
+	return out, nil
+}
+
+func refreshOne(ctx context.Context, st store.Store, srv store.MCPServer, etag string, opts RefreshOptions) RefreshResult {
+	res := RefreshResult{Server: srv.Name}
+	if opts.Force {
+		etag = ""
+	}
+	cctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var (
+		tools     []Tool
+		newETag   string
+		unchanged bool
+	)
+	c, err := NewClientForServer(srv)
+	if err == nil {
+		c.HTTP.Timeout = opts.Timeout
+		tools, newETag, unchanged, err = c.ToolsListIfChanged(cctx, etag)
+	}
+	if herr := st.RecordMCPServerHealth(ctx, srv.ServerID, err); herr != nil && err == nil {
+		err = herr
+	}
+	if err != nil {
+		res.Status, res.Error = "error", err.Error()
+		return res
+	}
+	res.ETag = newETag
+	if unchanged {
+		// Bump fetched_at: retention pruning drops caches by age, and a
+		// stable server's list must not expire while it keeps confirming it.
+		if err := st.TouchMCPToolsCache(ctx, srv.ServerID); err != nil {
+			res.Status, res.Error = "error", err.Error()
+			return res
+		}
+		res.Status = "unchanged"
+		return res
+	}
+	tb, _ := json.Marshal(tools)
+	if err := st.UpdateMCPToolsCache(ctx, srv.ServerID, tb, newETag); err != nil {
+		res.Status, res.Error = "error", err.Error()
+		return res
+	}
+	res.Status, res.Tools = "updated", len(tools)
+	return res
+}
@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"xcloudflow/internal/store"
+)
+
+func TestRefreshTools(t *testing.T) {
+	ctx := context.Background()
+	backend := httptest.NewServer(NewServer(ServerOptions{}))
+	defer backend.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer dead.Close()
+
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opsID, err := st.UpsertMCPServer(ctx, store.MCPServer{Name: "ops", BaseURL: backend.URL, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.UpsertMCPServer(ctx, store.MCPServer{Name: "dead", BaseURL: dead.URL, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	cached := func() store.MCPToolsCache {
+		t.Helper()
+		caches, err := st.ListMCPToolsCache(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range caches {
+			if c.ServerID == opsID {
+				return c
+			}
+		}
+		t.Fatal("no tools cache for ops")
+		return store.MCPToolsCache{}
+	}
+
+	res, err := RefreshTools(ctx, st, RefreshOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].Server != "dead" || res[0].Status != "error" || res[0].Error == "" {
+		t.Fatalf("dead server: %+v", res)
+	}
+	if res[1].Status != "updated" || res[1].Tools == 0 || res[1].ETag == "" {
+		t.Fatalf("first refresh: %+v", res[1])
+	}
+	first := cached()
+
+	res, err = RefreshTools(ctx, st, RefreshOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[1].Status != "unchanged" || res[1].ETag != first.ETag {
+		t.Fatalf("second refresh: %+v", res[1])
+	}
+	// An ETag hit keeps the cached list but renews it for retention.
+	if second := cached(); string(second.Tools) != string(first.Tools) || !second.FetchedAt.After(first.FetchedAt) {
+		t.Fatalf("unchanged refresh: fetched_at %s -> %s", first.FetchedAt, second.FetchedAt)
+	}
+
+	res, err = RefreshTools(ctx, st, RefreshOptions{Force: true})
+	if err != nil || res[1].Status != "updated" {
+		t.Fatalf("forced refresh: %+v, %v", res, err)
+	}
+
+	srvs, _ := st.ListMCPServers(ctx)
+	for _, s := range srvs {
+		want := store.MCPHealthOK
+		if s.Name == "dead" {
+			want = store.MCPHealthError
+		}
+		if s.Health != want || (want == store.MCPHealthOK && s.LastSeenAt == nil) {
+			t.Errorf("%s: health %q, last seen %v", s.Name, s.Health, s.LastSeenAt)
+		}
+	}
+}
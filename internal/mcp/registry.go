@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+// Tool registry.
+//
+// Each tool lives in its own tool_*.go file and registers itself from init()
+// with RegisterTool. The server validates tools/call arguments against the
+// tool's InputSchema before the handler runs, so handlers can decode straight
+// into their input struct.
+
+// ToolHandler runs one tool call. args is a JSON object that already
+// satisfies the tool's InputSchema. st is nil unless the tool set NeedsStore.
+type ToolHandler func(ctx context.Context, st store.Store, args json.RawMessage) (any, error)
+
+// ToolSpec is a registered tool: its advertised description and its handler.
+type ToolSpec struct {
+	Tool
+	// NeedsStore makes calls fail with a tool error when the server runs
+	// without DATABASE_URL.
+	NeedsStore bool
+	// Scope is what an authenticated caller needs to call the tool
+	// (default authn.RequiredScope of the name: "*.apply" tools need
+	// authn.ScopeApply, the rest authn.ScopeRead).
+	Scope string
+	// Timeout bounds one call (default Limits.ToolTimeout). Tools that wait
+	// on purpose, like runs.watch, declare how long they may take.
+	Timeout time.Duration
+	Handler ToolHandler
+
+	schema *schema
+}
+
+var (
+	errUnknownTool     = errors.New("unknown tool")
+	errInvalidArgument = errors.New("invalid arguments")
+	errForbidden       = errors.New("forbidden")
+	errToolTimeout     = errors.New("tool timeout")
+)
+
+// toolRegistry stores registered tools by name.
+var toolRegistry = make(map[string]*ToolSpec)
+
+// RegisterTool adds a tool. It panics on a duplicate name, a missing handler
+// or an input schema it cannot enforce; registration happens from init().
+func RegisterTool(spec ToolSpec) {
+	if spec.Name == "" || spec.Handler == nil {
+		panic("mcp: RegisterTool: name and handler are required")
+	}
+	if _, dup := toolRegistry[spec.Name]; dup {
+		panic("mcp: RegisterTool: duplicate tool " + spec.Name)
+	}
+	if len(spec.InputSchema) == 0 {
+		spec.InputSchema = json.RawMessage(`{"type":"object"}`)
+	}
+	sc, err := compileSchema(spec.InputSchema)
+	if err != nil {
+		panic(fmt.Sprintf("mcp: RegisterTool %s: input schema: %v", spec.Name, err))
+	}
+	spec.schema = sc
+	if spec.Scope == "" {
+		spec.Scope = authn.RequiredScope(spec.Name)
+	}
+	toolRegistry[spec.Name] = &spec
+}
+
+// registeredTools returns a snapshot of the registry.
+func registeredTools() map[string]*ToolSpec {
+	out := make(map[string]*ToolSpec, len(toolRegistry))
+	for name, spec := range toolRegistry {
+		out[name] = spec
+	}
+	return out
+}
+
+// toolList is the tools/list payload, sorted by name.
+func toolList(specs map[string]*ToolSpec) []Tool {
+	tools := make([]Tool, 0, len(specs))
+	for _, spec := range specs {
+		tools = append(tools, spec.Tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// listTools is the tools/list payload: local tools, then federated ones
+// whose names do not shadow a local tool. Authenticated callers only see
+// the tools their scopes allow.
+func (s *Server) listTools(ctx context.Context) []Tool {
+	tools := []Tool{}
+	for _, t := range toolList(s.tools) {
+		if s.authorize(ctx, t.Name) == nil {
+			tools = append(tools, t)
+		}
+	}
+	if s.gateway == nil {
+		return tools
+	}
+	for _, t := range s.gateway.Tools(ctx) {
+		if _, local := s.tools[t.Name]; !local && s.authorize(ctx, t.Name) == nil {
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
+
+// authorize checks the caller's scopes against a tool. Requests without an
+// identity (no inbound auth configured, stdio) are not restricted.
+func (s *Server) authorize(ctx context.Context, name string) error {
+	id, ok := authn.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if scope := s.requiredScope(ctx, name); !id.HasScope(scope) {
+		return fmt.Errorf("%w: %s requires scope %s", errForbidden, name, scope)
+	}
+	return nil
+}
+
+// requiredScope is the scope a tool needs: a local tool's declared Scope,
+// authn.ScopeApply for apply tools, authn.ScopeRead otherwise.
+func (s *Server) requiredScope(ctx context.Context, name string) string {
+	if spec, local := s.tools[name]; local {
+		return spec.Scope
+	}
+	if s.isApplyTool(ctx, name) {
+		return authn.ScopeApply
+	}
+	return authn.ScopeRead
+}
+
+// isApplyTool reports whether name changes infrastructure and so runs only
+// for an approved plan: "*.apply" tools, and federated tools matching their
+// server's ApplyTools patterns.
+func (s *Server) isApplyTool(ctx context.Context, name string) bool {
+	if authn.RequiredScope(name) == authn.ScopeApply {
+		return true
+	}
+	_, local := s.tools[name]
+	return !local && s.gateway != nil && s.gateway.applyTool(ctx, name)
+}
+
+// callTool validates args and runs the named tool. Unknown tools and schema
+// violations wrap errUnknownTool/errInvalidArgument (protocol errors); any
+// other error is the tool's own failure.
+func (s *Server) callTool(ctx context.Context, name string, args json.RawMessage) (any, error) {
+	spec, ok := s.tools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownTool, name)
+	}
+	args = bytes.TrimSpace(args)
+	if len(args) == 0 || bytes.Equal(args, []byte("null")) {
+		args = json.RawMessage(`{}`)
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArgument, err)
+	}
+	if errs := spec.schema.validate(v); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %s", errInvalidArgument, strings.Join(errs, "; "))
+	}
+	if spec.NeedsStore && s.store == nil {
+		return nil, fmt.Errorf("%s requires a store (DATABASE_URL)", name)
+	}
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = s.limits.ToolTimeout
+	}
+	tctx, cancel := context.WithTimeoutCause(ctx, timeout, errToolTimeout)
+	defer cancel()
+	out, err := spec.Handler(tctx, s.store, args)
+	if err != nil && errors.Is(context.Cause(tctx), errToolTimeout) {
+		return nil, fmt.Errorf("%s timed out after %s", name, timeout)
+	}
+	return out, err
+}
+
+// decodeArgs unmarshals validated arguments into the handler's input struct.
+func decodeArgs(args json.RawMessage, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+// Resources expose store state read-only:
+//
+//	xcf://runs/<run_id>               run record (application/json)
+//	xcf://runs/<run_id>/artifacts     artifact references of a run
+//	xcf://skills/<source>/<path>      cached skill doc (text/markdown)
+//
+// resources/list returns recent runs and the effective doc of each skill
+// (store.ResolveSkills); shadowed copies and artifacts are reachable by URI
+// through resources/templates/list. Only run resources can be
+// subscribed to (changes come from store.Watch).
+
+const (
+	runURIPrefix   = "xcf://runs/"
+	skillURIPrefix = "xcf://skills/"
+
+	// listedRuns caps how many recent runs resources/list returns.
+	listedRuns = 50
+)
+
+// runView is the JSON shape of a run resource.
+type runView struct {
+	RunID       string          `json:"run_id"`
+	Stack       string          `json:"stack"`
+	Env         string          `json:"env"`
+	Phase       string          `json:"phase"`
+	Status      string          `json:"status"`
+	Actor       string          `json:"actor,omitempty"`
+	ConfigRef   string          `json:"config_ref,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	HeartbeatAt *time.Time      `json:"heartbeat_at,omitempty"`
+	Inputs      json.RawMessage `json:"inputs,omitempty"`
+	Plan        json.RawMessage `json:"plan,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+}
+
+func newRunView(r store.Run) runView {
+	return runView{
+		RunID: r.RunID, Stack: r.Stack, Env: r.Env, Phase: r.Phase, Status: r.Status,
+		Actor: r.Actor, ConfigRef: r.ConfigRef,
+		StartedAt: r.StartedAt, FinishedAt: r.FinishedAt, HeartbeatAt: r.HeartbeatAt,
+		Inputs: r.InputsJSON, Plan: r.PlanJSON, Result: r.ResultJSON,
+	}
+}
+
+type artifactView struct {
+	ArtifactID string          `json:"artifact_id"`
+	Kind       string          `json:"kind"`
+	URI        string          `json:"uri"`
+	Checksum   string          `json:"checksum,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+}
+
+func newArtifactViews(arts []store.RunArtifact) []artifactView {
+	views := []artifactView{}
+	for _, a := range arts {
+		views = append(views, artifactView{
+			ArtifactID: a.ArtifactID, Kind: a.Kind, URI: a.URI, Checksum: a.Checksum,
+			CreatedAt: a.CreatedAt, Metadata: a.MetadataJSON,
+		})
+	}
+	return views
+}
+
+func runURI(runID string) string { return runURIPrefix + runID }
+
+func skillURI(d store.SkillDoc) string { return skillURIPrefix + d.SourceName + "/" + d.Path }
+
+var resourceTemplates = []ResourceTemplate{
+	{URITemplate: runURIPrefix + "{run_id}", Name: "run", Description: "A StackFlow run: status, inputs, plan and result.", MimeType: "application/json"},
+	{URITemplate: runURIPrefix + "{run_id}/artifacts", Name: "run-artifacts", Description: "Artifact references (kind, uri, checksum) of a run.", MimeType: "application/json"},
+	{URITemplate: skillURIPrefix + "{source}/{path}", Name: "skill-doc", Description: "A cached skill document (runbook).", MimeType: "text/markdown"},
+}
+
+func (s *Server) listResources(ctx context.Context) ([]Resource, error) {
+	out := []Resource{}
+	if s.store == nil {
+		return out, nil
+	}
+	runs, err := s.store.ListRuns(ctx, store.RunFilter{Limit: listedRuns})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range runs {
+		out = append(out, Resource{
+			URI:         runURI(r.RunID),
+			Name:        fmt.Sprintf("run %s/%s %s", r.Stack, r.Env, r.Phase),
+			Description: fmt.Sprintf("%s, started %s", r.Status, r.StartedAt.UTC().Format(time.RFC3339)),
+			MimeType:    "application/json",
+		})
+	}
+	resolved, err := store.ResolveSkills(ctx, s.store)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resolved {
+		d := r.Doc
+		out = append(out, Resource{
+			URI:         skillURI(d),
+			Name:        "skill " + d.Name,
+			Description: "Skill doc " + d.Path + " from source " + d.SourceName,
+			MimeType:    "text/markdown",
+		})
+	}
+	return out, nil
+}
+
+var errUnknownResource = errors.New("resource not found")
+
+func (s *Server) readResource(ctx context.Context, uri string) (ResourceContents, error) {
+	if s.store == nil {
+		return ResourceContents{}, fmt.Errorf("%w: %s (no store configured)", errUnknownResource, uri)
+	}
+	notFound := func(err error) error {
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("%w: %s", errUnknownResource, uri)
+		}
+		return err
+	}
+	switch {
+	case strings.HasPrefix(uri, runURIPrefix):
+		rest := strings.TrimPrefix(uri, runURIPrefix)
+		runID, sub, _ := strings.Cut(rest, "/")
+		r, err := s.store.GetRun(ctx, runID)
+		if err != nil {
+			return ResourceContents{}, notFound(err)
+		}
+		var v any
+		switch sub {
+		case "":
+			v = newRunView(r)
+		case "artifacts":
+			arts, err := s.store.ListRunArtifacts(ctx, runID)
+			if err != nil {
+				return ResourceContents{}, err
+			}
+			v = map[string]any{"run_id": runID, "artifacts": newArtifactViews(arts)}
+		default:
+			return ResourceContents{}, fmt.Errorf("%w: %s", errUnknownResource, uri)
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return ResourceContents{}, err
+		}
+		return ResourceContents{URI: uri, MimeType: "application/json", Text: string(b)}, nil
+
+	case strings.HasPrefix(uri, skillURIPrefix):
+		source, path, ok := strings.Cut(strings.TrimPrefix(uri, skillURIPrefix), "/")
+		if !ok || path == "" {
+			return ResourceContents{}, fmt.Errorf("%w: %s", errUnknownResource, uri)
+		}
+		srcs, err := s.store.ListSkillSources(ctx)
+		if err != nil {
+			return ResourceContents{}, err
+		}
+		for _, src := range srcs {
+			if src.Name != source {
+				continue
+			}
+			d, err := s.store.GetSkillDoc(ctx, src.SourceID, path)
+			if err != nil {
+				return ResourceContents{}, notFound(err)
+			}
+			return ResourceContents{URI: uri, MimeType: "text/markdown", Text: d.Content}, nil
+		}
+	}
+	return ResourceContents{}, fmt.Errorf("%w: %s", errUnknownResource, uri)
+}
+
+// subscribe registers uri for the caller's session. Updates are pushed as
+// notifications/resources/updated over the session's stream (stdio, or an
+// HTTP GET event stream).
+func (s *Server) subscribe(ctx context.Context, uri string) error {
+	if s.store == nil {
+		return fmt.Errorf("subscriptions require a store (DATABASE_URL)")
+	}
+	runID, sub, _ := strings.Cut(strings.TrimPrefix(uri, runURIPrefix), "/")
+	if !strings.HasPrefix(uri, runURIPrefix) || runID == "" || sub != "" {
+		return fmt.Errorf("only run resources (%s<run_id>) support subscriptions", runURIPrefix)
+	}
+	session := sessionFrom(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs == nil {
+		s.subs = map[string]map[string]bool{}
+	}
+	if s.subs[session] == nil {
+		s.subs[session] = map[string]bool{}
+	}
+	s.subs[session][uri] = true
+	if s.stopWatch == nil {
+		wctx, cancel := context.WithCancel(context.Background())
+		s.stopWatch = cancel
+		go s.watchSubscriptions(wctx)
+	}
+	return nil
+}
+
+func (s *Server) unsubscribe(ctx context.Context, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := sessionFrom(ctx)
+	delete(s.subs[session], uri)
+	if len(s.subs[session]) == 0 {
+		delete(s.subs, session)
+	}
+	s.stopWatchIfIdleLocked()
+}
+
+// stopWatchIfIdleLocked stops the change watcher once nobody is subscribed.
+// Caller must hold s.mu.
+func (s *Server) stopWatchIfIdleLocked() {
+	if len(s.subs) == 0 && s.stopWatch != nil {
+		s.stopWatch()
+		s.stopWatch = nil
+	}
+}
+
+// attachStream makes sender the push channel of session, replacing any
+// previous one. The returned func detaches it again; detaching the stdio
+// session also drops its subscriptions, since nobody can receive them.
+func (s *Server) attachStream(session string, sender messageSender, dropSubs bool) func() {
+	s.mu.Lock()
+	if s.streams == nil {
+		s.streams = map[string]messageSender{}
+	}
+	s.streams[session] = sender
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.streams[session] == sender {
+			delete(s.streams, session)
+		}
+		if dropSubs {
+			delete(s.subs, session)
+			s.stopWatchIfIdleLocked()
+		}
+	}
+}
+
+func (s *Server) watchSubscriptions(ctx context.Context) {
+	for c := range store.Watch(ctx, s.store, s.pollEvery) {
+		if c.Kind != "run" || c.RunID == "" {
+			continue
+		}
+		uri := runURI(c.RunID)
+		var targets []messageSender
+		s.mu.Lock()
+		for session, uris := range s.subs {
+			if sender, ok := s.streams[session]; ok && uris[uri] {
+				targets = append(targets, sender)
+			}
+		}
+		s.mu.Unlock()
+		for _, sender := range targets {
+			sender.send(map[string]any{
+				"jsonrpc": "2.0",
+				"method":  "notifications/resources/updated",
+				"params":  map[string]any{"uri": uri},
+			})
+		}
+	}
+}
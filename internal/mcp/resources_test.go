@@ -0,0 +1,225 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+func seededServer(t *testing.T) (*Server, *store.File, string) {
+	t.Helper()
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	ctx := context.Background()
+	runID, err := st.CreateRun(ctx, store.Run{Stack: "demo", Env: "prod", Phase: "plan", Status: store.RunRunning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.AddRunArtifact(ctx, store.RunArtifact{RunID: runID, Kind: "plan", URI: "gs://bucket/plan.json"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"team-a", "team-b"} {
+		srcID, err := st.AddSkillSource(ctx, store.SkillSource{Name: name, Type: "local", URI: "/tmp/" + name, Enabled: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := "---\nname: dns\ndescription: Fix DNS for " + name + "\n---\n# DNS\n\nSteps.\n"
+		if err := st.UpsertSkillDoc(ctx, store.SkillDoc{SourceID: srcID, Path: "dns/SKILL.md", SHA256: "x", Content: doc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srcID, _ := st.AddSkillSource(ctx, store.SkillSource{Name: "team-a", Type: "local", URI: "/tmp/team-a", Enabled: true})
+	if err := st.UpsertSkillDoc(ctx, store.SkillDoc{SourceID: srcID, Path: "rollback/SKILL.md", SHA256: "y", Content: "# Rollback\n\nRoll back a deploy.\n"}); err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(ServerOptions{Store: st}), st, runID
+}
+
+func rpcResult(t *testing.T, srv *Server, body string, out any) *rpcErr {
+	t.Helper()
+	_, b := post(t, srv, body)
+	var resp testResp
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		t.Fatalf("decode result %s: %v", resp.Result, err)
+	}
+	return nil
+}
+
+func TestResources(t *testing.T) {
+	srv, _, runID := seededServer(t)
+
+	var list struct {
+		Resources []Resource `json:"resources"`
+	}
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`, &list); e != nil {
+		t.Fatal(e)
+	}
+	uris := map[string]bool{}
+	for _, r := range list.Resources {
+		uris[r.URI] = true
+	}
+	for _, want := range []string{"xcf://runs/" + runID, "xcf://skills/team-a/dns/SKILL.md", "xcf://skills/team-a/rollback/SKILL.md"} {
+		if !uris[want] {
+			t.Fatalf("resources/list missing %s: %+v", want, list.Resources)
+		}
+	}
+	if uris["xcf://skills/team-b/dns/SKILL.md"] {
+		t.Fatalf("resources/list lists a shadowed skill: %+v", list.Resources)
+	}
+
+	read := func(uri string) (ResourceContents, *rpcErr) {
+		var res struct {
+			Contents []ResourceContents `json:"contents"`
+		}
+		e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"`+uri+`"}}`, &res)
+		if e != nil {
+			return ResourceContents{}, e
+		}
+		if len(res.Contents) != 1 {
+			t.Fatalf("%s: %d contents", uri, len(res.Contents))
+		}
+		return res.Contents[0], nil
+	}
+
+	c, e := read("xcf://runs/" + runID)
+	if e != nil || !strings.Contains(c.Text, `"status": "running"`) || c.MimeType != "application/json" {
+		t.Fatalf("run: %+v %+v", c, e)
+	}
+	c, e = read("xcf://runs/" + runID + "/artifacts")
+	if e != nil || !strings.Contains(c.Text, "gs://bucket/plan.json") {
+		t.Fatalf("artifacts: %+v %+v", c, e)
+	}
+	var res struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":3,"method":"resources/read","params":{"uri":"xcf://runs/`+runID+`","_meta":{"progressToken":"p"}}}`, &res); e != nil {
+		t.Fatalf("read with _meta: %+v", e)
+	}
+	var empty struct{}
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":4,"method":"resources/unsubscribe","params":{"uri":"xcf://runs/`+runID+`","_meta":{}}}`, &empty); e != nil {
+		t.Fatalf("unsubscribe with _meta: %+v", e)
+	}
+	c, e = read("xcf://skills/team-b/dns/SKILL.md")
+	if e != nil || !strings.Contains(c.Text, "Fix DNS for team-b") {
+		t.Fatalf("skill: %+v %+v", c, e)
+	}
+	for _, uri := range []string{"xcf://runs/nope", "xcf://skills/team-a/missing.md", "xcf://other/x"} {
+		if _, e := read(uri); e == nil || e.Code != codeResourceNotFound {
+			t.Fatalf("%s: error %+v, want %d", uri, e, codeResourceNotFound)
+		}
+	}
+}
+
+func TestPrompts(t *testing.T) {
+	srv, st, _ := seededServer(t)
+
+	var list struct {
+		Prompts []Prompt `json:"prompts"`
+	}
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":1,"method":"prompts/list"}`, &list); e != nil {
+		t.Fatal(e)
+	}
+	got := map[string]string{}
+	for _, p := range list.Prompts {
+		got[p.Name] = p.Description
+	}
+	want := map[string]string{
+		"dns":      "Fix DNS for team-a", // equal priorities: team-a sorts first
+		"rollback": "Roll back a deploy.",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("prompts = %v", got)
+	}
+	for name, desc := range want {
+		if got[name] != desc {
+			t.Fatalf("prompt %q description = %q, want %q", name, got[name], desc)
+		}
+	}
+
+	var res GetPromptResult
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":2,"method":"prompts/get","params":{"name":"rollback","arguments":{"task":"undo v42"}}}`, &res); e != nil {
+		t.Fatal(e)
+	}
+	if len(res.Messages) != 1 || res.Messages[0].Role != "user" ||
+		!strings.HasPrefix(res.Messages[0].Content.Text, "# Rollback") ||
+		!strings.HasSuffix(res.Messages[0].Content.Text, "Task: undo v42") {
+		t.Fatalf("prompts/get = %+v", res)
+	}
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":3,"method":"prompts/get","params":{"name":"team-b/dns"}}`, &res); e == nil || e.Code != codeInvalidParams {
+		t.Fatalf("source-qualified name: %+v", e)
+	}
+
+	// A pin changes which copy backs the prompt.
+	srcs, _ := st.ListSkillSources(context.Background())
+	if _, err := st.PinSkill(context.Background(), store.SkillPin{Skill: "dns", SourceID: srcs[1].SourceID}); err != nil {
+		t.Fatal(err)
+	}
+	if e := rpcResult(t, srv, `{"jsonrpc":"2.0","id":4,"method":"prompts/get","params":{"name":"dns"}}`, &res); e != nil ||
+		!strings.Contains(res.Messages[0].Content.Text, "Fix DNS for team-b") {
+		t.Fatalf("pinned prompt = %+v %+v", res, e)
+	}
+}
+
+func TestResourceSubscribeStdio(t *testing.T) {
+	srv, st, runID := seededServer(t)
+	srv.pollEvery = 20 * time.Millisecond
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- srv.ServeStdio(context.Background(), inR, outW); outW.Close() }()
+	lines := bufio.NewScanner(outR)
+
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"xcf://skills/team-a/dns/SKILL.md"}}`+"\n")
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"code":-32602`) {
+		t.Fatalf("subscribe to skill doc: %s", lines.Text())
+	}
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"xcf://runs/`+runID+`"}}`+"\n")
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"result":{}`) {
+		t.Fatalf("subscribe: %s", lines.Text())
+	}
+
+	// Let the poller take its seeding snapshot before the change.
+	time.Sleep(100 * time.Millisecond)
+	if err := st.FinishRun(context.Background(), runID, store.RunOK, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !lines.Scan() {
+		t.Fatal("no notification")
+	}
+	var n struct {
+		Method string `json:"method"`
+		Params struct {
+			URI string `json:"uri"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(lines.Bytes(), &n); err != nil || n.Method != "notifications/resources/updated" || n.Params.URI != "xcf://runs/"+runID {
+		t.Fatalf("notification = %s", lines.Text())
+	}
+
+	inW.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	srv.mu.Lock()
+	idle := len(srv.subs) == 0 && srv.stopWatch == nil
+	srv.mu.Unlock()
+	if !idle {
+		t.Fatal("stdio subscriptions not dropped at EOF")
+	}
+}
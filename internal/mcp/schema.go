@@ -0,0 +1,224 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// schema is the subset of JSON Schema that tool input schemas use:
+// type, properties, required, additionalProperties (boolean), items, enum,
+// minimum/maximum, minLength/maxLength and minItems/maxItems. Unknown keywords
+// (description, default, ...) are accepted and ignored.
+type schema struct {
+	Type                 schemaType         `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []json.RawMessage  `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+}
+
+// schemaType is "type": a single name or a list of names.
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = schemaType{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = many
+	return nil
+}
+
+var schemaTypes = []string{"object", "array", "string", "integer", "number", "boolean", "null"}
+
+// compileSchema parses raw and checks that it only uses known type names.
+func compileSchema(raw json.RawMessage) (*schema, error) {
+	var s schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	if err := s.check(""); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *schema) check(path string) error {
+	for _, t := range s.Type {
+		if !slices.Contains(schemaTypes, t) {
+			return fmt.Errorf("%s: unknown type %q", pathOrRoot(path), t)
+		}
+	}
+	for name, p := range s.Properties {
+		if p == nil {
+			return fmt.Errorf("%s: property %q has no schema", pathOrRoot(path), name)
+		}
+		if err := p.check(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.check(path + "[]")
+	}
+	return nil
+}
+
+// validate checks v (decoded with UseNumber) and returns one message per
+// violation, sorted, with JSON-path-like locations.
+func (s *schema) validate(v any) []string {
+	var errs []string
+	s.walk("", v, &errs)
+	sort.Strings(errs)
+	return errs
+}
+
+func (s *schema) walk(path string, v any, errs *[]string) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, pathOrRoot(path)+": "+fmt.Sprintf(format, args...))
+	}
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return isType(v, t) }) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), typeName(v))
+		return
+	}
+	if len(s.Enum) > 0 {
+		b, _ := json.Marshal(v)
+		if !slices.ContainsFunc(s.Enum, func(e json.RawMessage) bool { return jsonEqual(e, b) }) {
+			fail("must be one of %s", joinRaw(s.Enum))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for name, pv := range v {
+			if p, ok := s.Properties[name]; ok {
+				p.walk(path+"."+name, pv, errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("unknown property %q", name)
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, iv := range v {
+				s.Items.walk(fmt.Sprintf("%s[%d]", path, i), iv, errs)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+	}
+}
+
+func isType(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "arguments"
+	}
+	return "arguments" + path
+}
+
+func jsonEqual(a, b []byte) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	xb, _ := json.Marshal(x)
+	yb, _ := json.Marshal(y)
+	return bytes.Equal(xb, yb)
+}
+
+func joinRaw(vals []json.RawMessage) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = string(v)
+	}
+	return strings.Join(parts, ", ")
+}
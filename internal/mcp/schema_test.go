@@ -0,0 +1,67 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	sc, err := compileSchema(json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"name":  {"type": "string", "minLength": 1, "maxLength": 5},
+			"count": {"type": "integer", "minimum": 1, "maximum": 10},
+			"mode":  {"type": "string", "enum": ["a", "b"]},
+			"tags":  {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"ratio": {"type": ["number", "null"]}
+		},
+		"required": ["name"],
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		args string
+		want string // substring of the joined errors; "" = valid
+	}{
+		{`{"name":"x"}`, ""},
+		{`{"name":"x","count":3,"mode":"b","tags":["p","q"],"ratio":null}`, ""},
+		{`{"name":"x","ratio":0.5}`, ""},
+		{`{}`, `arguments: missing required property "name"`},
+		{`{"name":""}`, "arguments.name: must be at least 1 characters"},
+		{`{"name":"toolong"}`, "arguments.name: must be at most 5 characters"},
+		{`{"name":"x","count":1.5}`, "arguments.count: expected integer, got number"},
+		{`{"name":"x","count":0}`, "arguments.count: must be >= 1"},
+		{`{"name":"x","mode":"c"}`, `arguments.mode: must be one of "a", "b"`},
+		{`{"name":"x","tags":["p",1]}`, "arguments.tags[1]: expected string, got number"},
+		{`{"name":"x","tags":["p","q","r"]}`, "arguments.tags: must have at most 2 items"},
+		{`{"name":"x","extra":true}`, `arguments: unknown property "extra"`},
+		{`[]`, "arguments: expected object, got array"},
+	}
+	for _, tc := range cases {
+		dec := json.NewDecoder(bytes.NewReader([]byte(tc.args)))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Join(sc.validate(v), "; ")
+		if tc.want == "" && got != "" || !strings.Contains(got, tc.want) {
+			t.Errorf("%s: errors %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestRegisteredToolSchemasCompile(t *testing.T) {
+	for name, spec := range registeredTools() {
+		if spec.schema == nil || spec.Handler == nil {
+			t.Errorf("%s: incomplete registration", name)
+		}
+	}
+	if _, err := compileSchema(json.RawMessage(`{"type":"strnig"}`)); err == nil {
+		t.Error("unknown type should not compile")
+	}
+}
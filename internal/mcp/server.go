@@ -1,27 +1,76 @@
 package mcp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/metrics"
 	"xcloudflow/internal/store"
 )
 
-// Minimal JSON-RPC 2.0 handler that supports:
-// - initialize
+// Minimal MCP server over JSON-RPC 2.0 (HTTP POST) that supports:
+// - initialize (protocol version negotiation) / notifications/initialized
+// - ping
 // - tools/list
-// - tools/call
+// - tools/call (MCP CallToolResult: content[], structuredContent, isError);
+//   arguments are checked against the tool's inputSchema (see registry.go)
+//   and every call is audited when a store is configured (see audit.go)
+// - resources/list, resources/templates/list, resources/read,
+//   resources/subscribe, resources/unsubscribe (see resources.go)
+// - prompts/list, prompts/get (see prompts.go)
 //
-// This is intentionally small: enough to act as an MCP-like server on Cloud Run.
+// JSON-RPC batches are accepted; notifications (no id) are answered with
+// 202 and no body. Clients accepting text/event-stream get tools/call answered
+// over SSE with progress notifications (see stream.go).
+//
+// With ServerOptions.Auth set, every HTTP request must carry a bearer token
+// the verifier accepts (401 otherwise); tools/call then checks the caller's
+// scopes against the tool (see authorize) and resources/prompts need
+// authn.ScopeRead. Stdio is a local process boundary and is not authenticated.
+//
+// This is intentionally small: enough to act as an MCP server on Cloud Run.
 
 type ServerOptions struct {
-	Store *store.Store
+	Store store.Store
+	// Gateway, when set, adds the federated tools of registered external
+	// servers to tools/list and proxies tools/call for them.
+	Gateway *Gateway
+	// Auth, when set, authenticates HTTP callers; see package authn.
+	Auth authn.Verifier
+	// Redactor scrubs tool arguments before they are audited (default:
+	// DefaultRedactPatterns). Auditing is on whenever Store is set.
+	Redactor *Redactor
+	// Limits bounds request size, tool run time, concurrency and rate.
+	Limits Limits
+	// Metrics, when set, receives tool call counts and latencies.
+	Metrics *metrics.Registry
 }
 
 type Server struct {
-	store *store.Store
-	tools []Tool
+	store    store.Store
+	tools    map[string]*ToolSpec
+	gateway  *Gateway
+	auth     authn.Verifier
+	redactor *Redactor
+	limits   Limits
+	limiter  *limiter
+	metrics  *toolMetrics
+
+	mu        sync.Mutex
+	inflight  map[string]*inflightReq    // see track
+	subs      map[string]map[string]bool // session -> subscribed URIs
+	streams   map[string]messageSender   // session -> push stream
+	stopWatch context.CancelFunc         // set while subs is non-empty
+	pollEvery time.Duration              // store.Watch fallback interval
 }
 
 type Tool struct {
@@ -30,29 +79,50 @@ type Tool struct {
 	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
 }
 
+// NewServer serves every tool registered with RegisterTool.
 func NewServer(opts ServerOptions) *Server {
-	tools := []Tool{
-		{
-			Name:        "stackflow.validate",
-			Description: "Validate StackFlow config (schema + constraints).",
-			InputSchema: json.RawMessage(`{"type":"object","properties":{"config_yaml":{"type":"string"},"env":{"type":"string"}},"required":["config_yaml"]}`),
-		},
-		{
-			Name:        "stackflow.plan.dns",
-			Description: "Generate DNS plan from StackFlow config.",
-			InputSchema: json.RawMessage(`{"type":"object","properties":{"config_yaml":{"type":"string"},"env":{"type":"string"}},"required":["config_yaml"]}`),
-		},
+	if opts.Redactor == nil {
+		opts.Redactor, _ = NewRedactor(nil)
+	}
+	limits := opts.Limits.withDefaults()
+	return &Server{
+		store:     opts.Store,
+		tools:     registeredTools(),
+		gateway:   opts.Gateway,
+		auth:      opts.Auth,
+		redactor:  opts.Redactor,
+		limits:    limits,
+		limiter:   newLimiter(limits),
+		metrics:   newToolMetrics(opts.Metrics),
+		pollEvery: 5 * time.Second,
 	}
-	return &Server{store: opts.Store, tools: tools}
 }
 
 type rpcReq struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      any    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// rpcMessage is an inbound request or notification. ID stays raw so an
+// absent id (notification) can be told apart from an explicit null.
+type rpcMessage struct {
 	JSONRPC string          `json:"jsonrpc"`
-	ID      any             `json:"id"`
+	ID      json.RawMessage `json:"id,omitempty"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
 }
 
+func (m rpcMessage) isNotification() bool { return len(m.ID) == 0 }
+
+func (m rpcMessage) responseID() any {
+	if len(m.ID) == 0 {
+		return nil
+	}
+	return m.ID
+}
+
 type rpcResp struct {
 	JSONRPC string  `json:"jsonrpc"`
 	ID      any     `json:"id"`
@@ -63,68 +133,406 @@ type rpcResp struct {
 type rpcErr struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type parsedMessage struct {
+	req  rpcMessage
+	resp *rpcResp // set when the message was invalid
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.auth != nil {
+		id, err := s.authenticate(r)
+		if err != nil {
+			challenge := `Bearer realm="xcloudflow"`
+			if !errors.Is(err, authn.ErrNoToken) {
+				challenge += `, error="invalid_token"`
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(authn.WithIdentity(r.Context(), id))
+	}
+	r = r.WithContext(withCaller(r.Context(), remoteCaller(r, s.limits.TrustedProxyHops)))
+	if r.Method == http.MethodGet && acceptsEventStream(r) {
+		s.serveNotifications(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req rpcReq
-	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&req); err != nil {
-		writeJSON(w, rpcResp{JSONRPC: "2.0", ID: nil, Error: &rpcErr{Code: -32700, Message: "invalid JSON"}})
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limits.MaxRequestBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		_ = json.NewEncoder(w).Encode(errResp(nil, codeInvalidRequest, fmt.Sprintf("request exceeds %d bytes", tooLarge.Limit)))
+		return
+	}
+	if err != nil {
+		writeJSON(w, errResp(nil, codeParseError, "read body: "+err.Error()))
+		return
+	}
+	msgs, batch, perr := parseBody(body)
+	if perr != nil {
+		writeJSON(w, perr)
+		return
+	}
+	streamable := false
+	for _, m := range msgs {
+		if m.resp == nil && m.req.Method == "tools/call" && !m.req.isNotification() {
+			streamable = true
+		}
+	}
+	ctx := withSession(r.Context(), r.Header.Get("Mcp-Session-Id"))
+
+	if streamable && acceptsEventStream(r) {
+		s.serveSSE(ctx, w, msgs)
 		return
 	}
-	if req.JSONRPC == "" {
-		req.JSONRPC = "2.0"
+
+	if !batch && msgs[0].resp == nil && msgs[0].req.Method == "tools/list" {
+		etag := toolsETag(s.listTools(ctx))
+		w.Header().Set("ETag", etag)
+		if !msgs[0].req.isNotification() && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
 
+	out := s.respond(ctx, msgs)
+	switch {
+	case len(out) == 0:
+		// Notifications get no response body.
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeJSON(w, out)
+	default:
+		writeJSON(w, out[0])
+	}
+}
+
+func (s *Server) authenticate(r *http.Request) (authn.Identity, error) {
+	tok, err := authn.BearerToken(r)
+	if err != nil {
+		return authn.Identity{}, err
+	}
+	return s.auth.Verify(r.Context(), tok)
+}
+
+// parseBody splits a payload into messages. A non-nil error response means
+// the payload as a whole was unusable (parse error, empty batch).
+func parseBody(body []byte) (msgs []parsedMessage, batch bool, perr *rpcResp) {
+	body = bytes.TrimSpace(body)
+
+	// Batch: an array of requests/notifications; one array of responses back.
+	var raws []json.RawMessage
+	batch = len(body) > 0 && body[0] == '['
+	if batch {
+		if err := json.Unmarshal(body, &raws); err != nil {
+			return nil, batch, errResp(nil, codeParseError, "invalid JSON")
+		}
+		if len(raws) == 0 {
+			return nil, batch, errResp(nil, codeInvalidRequest, "empty batch")
+		}
+	} else {
+		if !json.Valid(body) {
+			return nil, batch, errResp(nil, codeParseError, "invalid JSON")
+		}
+		raws = []json.RawMessage{body}
+	}
+	for _, raw := range raws {
+		req, resp := parseRequest(raw)
+		msgs = append(msgs, parsedMessage{req: req, resp: resp})
+	}
+	return msgs, batch, nil
+}
+
+// respond dispatches msgs in order and collects the responses to send
+// (none for notifications).
+func (s *Server) respond(ctx context.Context, msgs []parsedMessage) []*rpcResp {
+	var out []*rpcResp
+	for _, m := range msgs {
+		resp := m.resp
+		if resp == nil {
+			resp = s.dispatch(ctx, m.req)
+		}
+		if resp != nil {
+			out = append(out, resp)
+		}
+	}
+	return out
+}
+
+// parseRequest validates one JSON-RPC message. It returns an error response
+// for invalid requests; invalid messages are always answered (with a null id
+// when the id cannot be trusted), even if they look like notifications.
+func parseRequest(raw json.RawMessage) (rpcMessage, *rpcResp) {
+	var req rpcMessage
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return req, errResp(nil, codeInvalidRequest, "invalid request: "+err.Error())
+	}
+	if len(req.ID) > 0 {
+		switch req.ID[0] {
+		case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		default:
+			return req, errResp(nil, codeInvalidRequest, "invalid request: id must be a string, number or null")
+		}
+	}
+	if req.JSONRPC != "2.0" {
+		return req, errResp(req.responseID(), codeInvalidRequest, `invalid request: jsonrpc must be "2.0"`)
+	}
+	if req.Method == "" {
+		return req, errResp(req.responseID(), codeInvalidRequest, "invalid request: missing method")
+	}
+	if len(req.Params) > 0 && req.Params[0] != '{' && req.Params[0] != '[' {
+		return req, errResp(req.responseID(), codeInvalidRequest, "invalid request: params must be an object or array")
+	}
+	return req, nil
+}
+
+// dispatch runs one request. It returns nil for notifications, which must
+// never be answered (not even with an error).
+func (s *Server) dispatch(ctx context.Context, req rpcMessage) *rpcResp {
+	if req.isNotification() {
+		_, _ = s.handle(ctx, req)
+		return nil
+	}
+	ctx, done := s.track(ctx, req.ID)
+	defer done()
+	result, rerr := s.handle(ctx, req)
+	if errors.Is(context.Cause(ctx), errCancelledByClient) {
+		// Cancelled requests are not answered.
+		return nil
+	}
+	if rerr != nil {
+		return &rpcResp{JSONRPC: "2.0", ID: req.responseID(), Error: rerr}
+	}
+	return &rpcResp{JSONRPC: "2.0", ID: req.responseID(), Result: result}
+}
+
+func (s *Server) handle(ctx context.Context, req rpcMessage) (any, *rpcErr) {
+	if strings.HasSuffix(req.Method, "/list") {
+		var p listParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.Cursor != "" {
+			return nil, &rpcErr{Code: codeInvalidParams, Message: "invalid params: unknown cursor"}
+		}
+	}
 	switch req.Method {
 	case "initialize":
-		writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{
-			"server": map[string]any{
-				"name":    "xcloudflow",
-				"version": "0.1",
-			},
-			"capabilities": map[string]any{
-				"tools": true,
-			},
-			"time": time.Now().UTC().Format(time.RFC3339),
-		}})
-		return
+		var p InitializeParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		caps := ServerCapabilities{Tools: &ToolsCapability{ListChanged: false}}
+		if s.store != nil {
+			caps.Resources = &ResourcesCapability{Subscribe: true}
+			caps.Prompts = &PromptsCapability{}
+		}
+		return InitializeResult{
+			ProtocolVersion: negotiateProtocolVersion(p.ProtocolVersion),
+			Capabilities:    caps,
+			ServerInfo:      Implementation{Name: "xcloudflow", Version: "0.1"},
+			Instructions:    "StackFlow control plane: validate and plan stacks, search skills, watch runs. Runs and skill docs are also resources; SKILL.md runbooks are prompts.",
+		}, nil
+
+	case "notifications/initialized":
+		// The server is stateless over HTTP, so requests are served before
+		// initialized arrives too.
+		return nil, nil
+
+	case "notifications/cancelled":
+		var p struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason,omitempty"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err == nil && len(p.RequestID) > 0 {
+			s.cancelRequest(ctx, p.RequestID)
+		}
+		return nil, nil
+
+	case "ping":
+		return struct{}{}, nil
 
 	case "tools/list":
-		writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{"tools": s.tools}})
-		return
+		return map[string]any{"tools": s.listTools(ctx)}, nil
 
 	case "tools/call":
 		var p struct {
 			Name      string          `json:"name"`
 			Arguments json.RawMessage `json:"arguments"`
+			Meta      requestMeta     `json:"_meta"`
 		}
-		if err := json.Unmarshal(req.Params, &p); err != nil || p.Name == "" {
-			writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Error: &rpcErr{Code: -32602, Message: "invalid params"}})
-			return
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.Name == "" {
+			return nil, &rpcErr{Code: codeInvalidParams, Message: "invalid params: missing name"}
 		}
+		start := time.Now()
+		res, rerr := s.toolsCall(withProgress(ctx, p.Meta.ProgressToken), p.Name, p.Arguments)
+		s.audit(ctx, p.Name, p.Arguments, start, res, rerr)
+		s.observe(ctx, p.Name, start, res, rerr)
+		return res, rerr
 
-		res, err := s.callTool(r.Context(), p.Name, p.Arguments)
+	case "resources/list":
+		if rerr := requireRead(ctx); rerr != nil {
+			return nil, rerr
+		}
+		res, err := s.listResources(ctx)
 		if err != nil {
-			writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Error: &rpcErr{Code: -32000, Message: err.Error()}})
-			return
+			return nil, &rpcErr{Code: codeInternalError, Message: err.Error()}
 		}
-		writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Result: res})
-		return
+		return map[string]any{"resources": res}, nil
+
+	case "resources/templates/list":
+		if rerr := requireRead(ctx); rerr != nil {
+			return nil, rerr
+		}
+		return map[string]any{"resourceTemplates": resourceTemplates}, nil
+
+	case "resources/read", "resources/subscribe", "resources/unsubscribe":
+		var p struct {
+			URI  string      `json:"uri"`
+			Meta requestMeta `json:"_meta"`
+		}
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.URI == "" {
+			return nil, &rpcErr{Code: codeInvalidParams, Message: "invalid params: missing uri"}
+		}
+		if rerr := requireRead(ctx); rerr != nil {
+			return nil, rerr
+		}
+		switch req.Method {
+		case "resources/read":
+			c, err := s.readResource(ctx, p.URI)
+			if errors.Is(err, errUnknownResource) {
+				return nil, &rpcErr{Code: codeResourceNotFound, Message: err.Error()}
+			}
+			if err != nil {
+				return nil, &rpcErr{Code: codeInternalError, Message: err.Error()}
+			}
+			return map[string]any{"contents": []ResourceContents{c}}, nil
+		case "resources/subscribe":
+			if err := s.subscribe(ctx, p.URI); err != nil {
+				return nil, &rpcErr{Code: codeInvalidParams, Message: err.Error()}
+			}
+		default:
+			s.unsubscribe(ctx, p.URI)
+		}
+		return struct{}{}, nil
+
+	case "prompts/list":
+		if rerr := requireRead(ctx); rerr != nil {
+			return nil, rerr
+		}
+		prompts, err := s.skillPrompts(ctx)
+		if err != nil {
+			return nil, &rpcErr{Code: codeInternalError, Message: err.Error()}
+		}
+		out := make([]Prompt, 0, len(prompts))
+		for _, p := range prompts {
+			out = append(out, p.Prompt)
+		}
+		return map[string]any{"prompts": out}, nil
+
+	case "prompts/get":
+		var p struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+			Meta      requestMeta       `json:"_meta"`
+		}
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if rerr := requireRead(ctx); rerr != nil {
+			return nil, rerr
+		}
+		res, err := s.getPrompt(ctx, p.Name, p.Arguments)
+		if errors.Is(err, errUnknownPrompt) {
+			return nil, &rpcErr{Code: codeInvalidParams, Message: err.Error()}
+		}
+		if err != nil {
+			return nil, &rpcErr{Code: codeInternalError, Message: err.Error()}
+		}
+		return res, nil
+
 	default:
-		writeJSON(w, rpcResp{JSONRPC: "2.0", ID: req.ID, Error: &rpcErr{Code: -32601, Message: "method not found"}})
-		return
+		return nil, &rpcErr{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
 	}
 }
 
+// toolsCall runs a local tool, or a federated one through the gateway.
+// Apply tools additionally need an approved plan (see checkApproval).
+func (s *Server) toolsCall(ctx context.Context, name string, args json.RawMessage) (any, *rpcErr) {
+	if err := s.authorize(ctx, name); err != nil {
+		return nil, &rpcErr{Code: codeForbidden, Message: err.Error()}
+	}
+	release, rerr := s.limiter.acquire(callerFrom(ctx))
+	if rerr != nil {
+		return nil, rerr
+	}
+	defer release()
+	if rerr := s.checkApproval(ctx, name, args); rerr != nil {
+		return nil, rerr
+	}
+	res, err := s.callTool(ctx, name, args)
+	if errors.Is(err, errUnknownTool) && s.gateway != nil {
+		if out, handled, gerr := s.gateway.CallTool(ctx, name, args); handled {
+			var rpc *RPCError
+			switch {
+			case errors.As(gerr, &rpc):
+				return nil, &rpcErr{Code: rpc.Code, Message: rpc.Message}
+			case errors.Is(gerr, errToolDenied):
+				return nil, &rpcErr{Code: codeInvalidParams, Message: gerr.Error()}
+			case gerr != nil:
+				return newToolResult(nil, gerr), nil
+			}
+			// The backend's result is passed through untouched.
+			return out, nil
+		}
+	}
+	if errors.Is(err, errUnknownTool) || errors.Is(err, errInvalidArgument) {
+		return nil, &rpcErr{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return newToolResult(res, err), nil
+}
+
+// requireRead refuses authenticated callers without authn.ScopeRead.
+func requireRead(ctx context.Context) *rpcErr {
+	if id, ok := authn.FromContext(ctx); ok && !id.HasScope(authn.ScopeRead) {
+		return &rpcErr{Code: codeForbidden, Message: "forbidden: requires scope " + authn.ScopeRead}
+	}
+	return nil
+}
+
+// decodeParams strictly decodes params into v; failures are -32602.
+func decodeParams(params json.RawMessage, v any) *rpcErr {
+	if len(params) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &rpcErr{Code: codeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+func errResp(id any, code int, msg string) *rpcResp {
+	return &rpcResp{JSONRPC: "2.0", ID: id, Error: &rpcErr{Code: code, Message: msg}}
+}
+
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(v)
 }
-
@@ -0,0 +1,248 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+type testResp struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *rpcErr         `json:"error"`
+}
+
+func post(t *testing.T, srv http.Handler, body string) (int, []byte) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body)))
+	b, _ := io.ReadAll(rec.Body)
+	return rec.Code, b
+}
+
+func TestServerSingleRequests(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	cases := []struct {
+		name     string
+		body     string
+		wantID   string
+		wantCode int // 0 = success
+	}{
+		{"ping", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, `1`, 0},
+		{"string id", `{"jsonrpc":"2.0","id":"abc","method":"tools/list"}`, `"abc"`, 0},
+		{"null id", `{"jsonrpc":"2.0","id":null,"method":"ping"}`, `null`, 0},
+		{"parse error", `{"jsonrpc":"2.0",`, `null`, codeParseError},
+		{"not an object", `42`, `null`, codeInvalidRequest},
+		{"missing jsonrpc", `{"id":1,"method":"ping"}`, `1`, codeInvalidRequest},
+		{"wrong jsonrpc", `{"jsonrpc":"1.0","id":1,"method":"ping"}`, `1`, codeInvalidRequest},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, `1`, codeInvalidRequest},
+		{"bad id type", `{"jsonrpc":"2.0","id":{"x":1},"method":"ping"}`, `null`, codeInvalidRequest},
+		{"scalar params", `{"jsonrpc":"2.0","id":1,"method":"ping","params":3}`, `1`, codeInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"nope"}`, `1`, codeMethodNotFound},
+		{"call params wrong type", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":5}}`, `1`, codeInvalidParams},
+		{"call unknown field", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"x","bogus":1}}`, `1`, codeInvalidParams},
+		{"call missing name", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{}}`, `1`, codeInvalidParams},
+		{"call unknown tool", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"nope"}}`, `1`, codeInvalidParams},
+		{"call missing required arg", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{}}}`, `1`, codeInvalidParams},
+		{"call arg wrong type", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"config_yaml":7}}}`, `1`, codeInvalidParams},
+		{"call unknown arg", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"config_yaml":"x","bogus":1}}}`, `1`, codeInvalidParams},
+		{"call arg out of range", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"runs.watch","arguments":{"timeout_seconds":500}}}`, `1`, codeInvalidParams},
+		{"call arguments not object", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"runs.watch","arguments":[1]}}`, `1`, codeInvalidParams},
+		{"initialize bad params", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":1}}`, `1`, codeInvalidParams},
+		{"initialize meta", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"t","version":"1"},"_meta":{"x":1}}}`, `1`, 0},
+		{"list meta and empty cursor", `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{"cursor":"","_meta":{"progressToken":"p"}}}`, `1`, 0},
+		{"list unknown cursor", `{"jsonrpc":"2.0","id":1,"method":"prompts/list","params":{"cursor":"page2"}}`, `1`, codeInvalidParams},
+		{"list unknown field", `{"jsonrpc":"2.0","id":1,"method":"resources/list","params":{"bogus":1}}`, `1`, codeInvalidParams},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, b := post(t, srv, tc.body)
+			if code != http.StatusOK {
+				t.Fatalf("http status %d", code)
+			}
+			var resp testResp
+			if err := json.Unmarshal(b, &resp); err != nil {
+				t.Fatalf("decode %s: %v", b, err)
+			}
+			if resp.JSONRPC != "2.0" {
+				t.Fatalf("jsonrpc = %q", resp.JSONRPC)
+			}
+			if string(resp.ID) != tc.wantID {
+				t.Fatalf("id = %s, want %s", resp.ID, tc.wantID)
+			}
+			switch {
+			case tc.wantCode == 0 && resp.Error != nil:
+				t.Fatalf("unexpected error %+v", resp.Error)
+			case tc.wantCode != 0 && (resp.Error == nil || resp.Error.Code != tc.wantCode):
+				t.Fatalf("error = %+v, want code %d (body %s)", resp.Error, tc.wantCode, b)
+			}
+		})
+	}
+}
+
+func TestServerNotificationsGetNoBody(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","method":"ping"}`,
+		`{"jsonrpc":"2.0","method":"does/not/exist"}`,
+		`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"nope"}}`,
+	} {
+		code, b := post(t, srv, body)
+		if code != http.StatusAccepted || len(b) != 0 {
+			t.Fatalf("%s: got %d %q, want 202 and empty body", body, code, b)
+		}
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+
+	code, b := post(t, srv, `[
+		{"jsonrpc":"2.0","id":1,"method":"ping"},
+		{"jsonrpc":"2.0","method":"notifications/initialized"},
+		{"jsonrpc":"2.0","id":2,"method":"nope"},
+		1
+	]`)
+	if code != http.StatusOK {
+		t.Fatalf("http status %d", code)
+	}
+	var resps []testResp
+	if err := json.Unmarshal(b, &resps); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	if len(resps) != 3 {
+		t.Fatalf("got %d responses, want 3: %s", len(resps), b)
+	}
+	if string(resps[0].ID) != "1" || resps[0].Error != nil {
+		t.Fatalf("resp[0] = %+v", resps[0])
+	}
+	if string(resps[1].ID) != "2" || resps[1].Error == nil || resps[1].Error.Code != codeMethodNotFound {
+		t.Fatalf("resp[1] = %+v", resps[1])
+	}
+	if string(resps[2].ID) != "null" || resps[2].Error == nil || resps[2].Error.Code != codeInvalidRequest {
+		t.Fatalf("resp[2] = %+v", resps[2])
+	}
+
+	code, b = post(t, srv, `[{"jsonrpc":"2.0","method":"notifications/initialized"}]`)
+	if code != http.StatusAccepted || len(b) != 0 {
+		t.Fatalf("all-notification batch: got %d %q", code, b)
+	}
+
+	_, b = post(t, srv, `[]`)
+	var resp testResp
+	if err := json.Unmarshal(b, &resp); err != nil || resp.Error == nil || resp.Error.Code != codeInvalidRequest {
+		t.Fatalf("empty batch: %s", b)
+	}
+
+	_, b = post(t, srv, `[{"jsonrpc":"2.0","id":1,"method":"ping"},`)
+	if err := json.Unmarshal(b, &resp); err != nil || resp.Error == nil || resp.Error.Code != codeParseError {
+		t.Fatalf("broken batch: %s", b)
+	}
+}
+
+func TestServerToolsCallResultShape(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	cfg := `kind: StackFlow
+metadata: {name: demo}
+global: {domain: example.com, dns_provider: cloudflare, cloud: gcp}
+targets:
+  - id: web
+    type: cloudrun
+    domains: [www.example.com]
+`
+	args, _ := json.Marshal(map[string]any{"config_yaml": cfg})
+	_, b := post(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.validate","arguments":`+string(args)+`}}`)
+
+	var resp struct {
+		Result CallToolResult `json:"result"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	if resp.Result.IsError || len(resp.Result.Content) != 1 || resp.Result.Content[0].Type != "text" {
+		t.Fatalf("unexpected result: %s", b)
+	}
+	sc, ok := resp.Result.StructuredContent.(map[string]any)
+	if !ok || sc["stack"] != "demo" {
+		t.Fatalf("structuredContent = %#v", resp.Result.StructuredContent)
+	}
+
+	_, b = post(t, srv, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"config_yaml":"kind: x"}}}`)
+	resp.Result = CallToolResult{}
+	if err := json.Unmarshal(b, &resp); err != nil || !resp.Result.IsError {
+		t.Fatalf("tool failure should set isError: %s", b)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	toks, err := authn.ParseTokens("reader alice\napplier ci xcf:read xcf:apply\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(ServerOptions{Auth: toks})
+	var applied string
+	sc, _ := compileSchema(json.RawMessage(`{"type":"object"}`))
+	srv.tools["demo.deploy"] = &ToolSpec{
+		Tool:  Tool{Name: "demo.deploy"},
+		Scope: authn.ScopeApply,
+		Handler: func(ctx context.Context, _ store.Store, _ json.RawMessage) (any, error) {
+			applied = authn.Actor(ctx)
+			return map[string]any{"ok": true}, nil
+		},
+		schema: sc,
+	}
+
+	call := func(token, body string) (int, http.Header, testResp) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		var resp testResp
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+		}
+		return rec.Code, rec.Header(), resp
+	}
+	const ping = `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	const deploy = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"demo.deploy"}}`
+
+	if code, hdr, _ := call("", ping); code != http.StatusUnauthorized || !strings.HasPrefix(hdr.Get("WWW-Authenticate"), "Bearer") {
+		t.Fatalf("no token: %d %v", code, hdr)
+	}
+	if code, hdr, _ := call("wrong", ping); code != http.StatusUnauthorized || !strings.Contains(hdr.Get("WWW-Authenticate"), "invalid_token") {
+		t.Fatalf("bad token: %d %v", code, hdr)
+	}
+
+	_, _, resp := call("reader", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if resp.Error != nil || strings.Contains(string(resp.Result), "demo.deploy") || !strings.Contains(string(resp.Result), "stackflow.validate") {
+		t.Fatalf("reader tools/list should hide apply-scoped tools: %s", resp.Result)
+	}
+	_, _, resp = call("reader", deploy)
+	if resp.Error == nil || resp.Error.Code != codeForbidden || applied != "" {
+		t.Fatalf("reader calling apply-scoped tool: %+v", resp)
+	}
+	_, _, resp = call("applier", deploy)
+	if resp.Error != nil || applied != "ci" {
+		t.Fatalf("applier: %+v, actor %q", resp, applied)
+	}
+
+	// Without Auth configured nothing is restricted.
+	open := NewServer(ServerOptions{})
+	if code, _ := post(t, open, ping); code != http.StatusOK {
+		t.Fatalf("open server: %d", code)
+	}
+}
@@ -0,0 +1,119 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// stdio transport.
+//
+// Messages are newline-delimited JSON-RPC (single messages or batches, one
+// per line, no embedded newlines). Responses and notifications/progress are
+// written to out, one line each. Requests run concurrently so that
+// notifications/cancelled can reach an in-flight tools/call; notifications
+// are handled inline, in order. Lines are capped at Limits.MaxRequestBytes.
+//
+// stdout belongs to the protocol: anything meant for humans goes to stderr.
+
+// lineWriter writes one JSON value per line.
+type lineWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+func (lw *lineWriter) send(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if lw.err != nil {
+		return
+	}
+	_, lw.err = lw.w.Write(append(b, '\n'))
+}
+
+// ServeStdio serves JSON-RPC over in/out until in reaches EOF or ctx is done.
+// In-flight requests are allowed to finish after EOF.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	lw := &lineWriter{w: out}
+	ctx = context.WithValue(ctx, streamKey, messageSender(lw))
+	ctx = withCaller(ctx, "stdio")
+	detach := s.attachStream(sessionFrom(ctx), lw, true)
+	defer detach()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		sc := bufio.NewScanner(in)
+		sc.Buffer(make([]byte, 0, 64<<10), int(s.limits.MaxRequestBytes))
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			select {
+			case lines <- bytes.Clone(line):
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- sc.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if errors.Is(err, bufio.ErrTooLong) {
+				lw.send(errResp(nil, codeInvalidRequest, fmt.Sprintf("message exceeds %d bytes", s.limits.MaxRequestBytes)))
+			}
+			return err
+		case line := <-lines:
+			msgs, batch, perr := parseBody(line)
+			if perr != nil {
+				lw.send(perr)
+				continue
+			}
+			if !hasRequest(msgs) {
+				s.respond(ctx, msgs)
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resps := s.respond(ctx, msgs)
+				switch {
+				case len(resps) == 0:
+				case batch:
+					lw.send(resps)
+				default:
+					lw.send(resps[0])
+				}
+			}()
+		}
+	}
+}
+
+// hasRequest reports whether msgs need a response (any request, or any
+// invalid message).
+func hasRequest(msgs []parsedMessage) bool {
+	for _, m := range msgs {
+		if m.resp != nil || !m.req.isNotification() {
+			return true
+		}
+	}
+	return false
+}
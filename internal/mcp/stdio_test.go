@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+func TestServeStdio(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","clientInfo":{"name":"t","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`[{"jsonrpc":"2.0","id":3,"method":"ping"},{"jsonrpc":"2.0","id":4,"method":"nope"}]`,
+		`{"jsonrpc":"2.0",`,
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if err := srv.ServeStdio(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	byID := map[string]testResp{}
+	var batches, parseErrors int
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.HasPrefix(line, "[") {
+			var resps []testResp
+			if err := json.Unmarshal([]byte(line), &resps); err != nil || len(resps) != 2 {
+				t.Fatalf("batch line %s: %v", line, err)
+			}
+			batches++
+			for _, r := range resps {
+				byID[string(r.ID)] = r
+			}
+			continue
+		}
+		var r testResp
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %s: %v", line, err)
+		}
+		if r.Error != nil && r.Error.Code == codeParseError {
+			parseErrors++
+			continue
+		}
+		byID[string(r.ID)] = r
+	}
+	if batches != 1 || parseErrors != 1 {
+		t.Fatalf("batches=%d parseErrors=%d\n%s", batches, parseErrors, out.String())
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if r, ok := byID[id]; !ok || r.Error != nil {
+			t.Fatalf("id %s: %+v (ok=%v)", id, r, ok)
+		}
+	}
+	if r := byID["4"]; r.Error == nil || r.Error.Code != codeMethodNotFound {
+		t.Fatalf("id 4: %+v", r)
+	}
+}
+
+func TestServeStdioProgressAndCancel(t *testing.T) {
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	srv := NewServer(ServerOptions{Store: st})
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- srv.ServeStdio(context.Background(), inR, outW); outW.Close() }()
+	lines := bufio.NewScanner(outR)
+
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.plan.dns","arguments":{"config_yaml":"kind: StackFlow\nmetadata: {name: demo}\nglobal: {domain: example.com, dns_provider: cloudflare, cloud: gcp}\ntargets: []\n"},"_meta":{"progressToken":"p1"}}}`+"\n")
+	var progress int
+	for lines.Scan() {
+		var m struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.Unmarshal(lines.Bytes(), &m); err != nil {
+			t.Fatalf("line %s: %v", lines.Text(), err)
+		}
+		if m.Method == "notifications/progress" {
+			progress++
+			continue
+		}
+		if string(m.ID) != "1" {
+			t.Fatalf("unexpected line %s", lines.Text())
+		}
+		break
+	}
+	if progress == 0 {
+		t.Fatal("no progress notifications before the result")
+	}
+
+	// A long-poll cancelled by the client must not produce a response.
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"runs.watch","arguments":{"timeout_seconds":30}}}`+"\n")
+	time.Sleep(100 * time.Millisecond)
+	io.WriteString(inW, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":2}}`+"\n")
+	inW.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ServeStdio did not return after cancel + EOF")
+	}
+	if lines.Scan() {
+		t.Fatalf("cancelled request produced output: %s", lines.Text())
+	}
+}
@@ -0,0 +1,208 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Streamable HTTP transport.
+//
+// A POST whose Accept header includes text/event-stream and which carries a
+// tools/call request is answered with an SSE stream: notifications/progress
+// for requests that set params._meta.progressToken, then the response(s).
+// Everything else keeps the plain application/json request/response shape.
+//
+// notifications/cancelled (sent in a separate POST, matched by request id,
+// Mcp-Session-Id and the caller, so one client cannot cancel another's
+// requests) cancels the handler's context; cancelled requests get no
+// response.
+
+var errCancelledByClient = errors.New("request cancelled by client")
+
+type ctxKey int
+
+const (
+	sessionKey ctxKey = iota
+	streamKey
+	progressKey
+)
+
+func withSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey, session)
+}
+
+func sessionFrom(ctx context.Context) string {
+	s, _ := ctx.Value(sessionKey).(string)
+	return s
+}
+
+// ProgressFunc reports progress of a long-running tool call. progress must
+// increase between calls; total is 0 when unknown.
+type ProgressFunc func(progress, total float64, message string)
+
+// ReportProgress sends notifications/progress for the current tool call when
+// the client asked for it (progressToken over an SSE stream); otherwise it is
+// a no-op. Tool handlers may call it freely.
+func ReportProgress(ctx context.Context, progress, total float64, message string) {
+	if fn, ok := ctx.Value(progressKey).(ProgressFunc); ok {
+		fn(progress, total, message)
+	}
+}
+
+// messageSender pushes server-initiated messages (progress notifications)
+// to the client ahead of the response: an SSE stream or the stdio pipe.
+type messageSender interface {
+	send(v any)
+}
+
+// withProgress wires ReportProgress to the stream in ctx, if any.
+func withProgress(ctx context.Context, token json.RawMessage) context.Context {
+	sw, ok := ctx.Value(streamKey).(messageSender)
+	if !ok || len(token) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey, ProgressFunc(func(progress, total float64, message string) {
+		params := map[string]any{"progressToken": token, "progress": progress}
+		if total > 0 {
+			params["total"] = total
+		}
+		if message != "" {
+			params["message"] = message
+		}
+		sw.send(map[string]any{"jsonrpc": "2.0", "method": "notifications/progress", "params": params})
+	}))
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept") {
+		if strings.Contains(v, "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// sseWriter serialises JSON-RPC messages as SSE "message" events.
+type sseWriter struct {
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	closed bool
+}
+
+func (sw *sseWriter) send(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.closed {
+		return
+	}
+	fmt.Fprintf(sw.w, "event: message\ndata: %s\n\n", b)
+	if fl, ok := sw.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// close stops further writes; the handler that owns w is returning.
+func (sw *sseWriter) close() {
+	sw.mu.Lock()
+	sw.closed = true
+	sw.mu.Unlock()
+}
+
+// serveSSE answers msgs over an event stream.
+func (s *Server) serveSSE(ctx context.Context, w http.ResponseWriter, msgs []parsedMessage) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if fl, ok := w.(http.Flusher); ok {
+		// Open the stream right away; the first event may take minutes.
+		fl.Flush()
+	}
+	sw := &sseWriter{w: w}
+	defer sw.close()
+	ctx = context.WithValue(ctx, streamKey, messageSender(sw))
+	for _, m := range msgs {
+		resp := m.resp
+		if resp == nil {
+			resp = s.dispatch(ctx, m.req)
+		}
+		if resp != nil {
+			sw.send(resp)
+		}
+	}
+}
+
+// serveNotifications holds a GET event stream open for server-initiated
+// messages of the caller's Mcp-Session-Id (resource update notifications).
+func (s *Server) serveNotifications(w http.ResponseWriter, r *http.Request) {
+	// The stream lives as long as the client stays; the server's
+	// WriteTimeout is meant for request/response exchanges.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if fl, ok := w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	sw := &sseWriter{w: w}
+	detach := s.attachStream(r.Header.Get("Mcp-Session-Id"), sw, false)
+	<-r.Context().Done()
+	detach()
+	sw.close()
+}
+
+// inflightKey identifies a request for notifications/cancelled. The caller
+// (authenticated subject, else client address) is part of it: the session
+// id and request id are chosen by the client and prove nothing.
+func inflightKey(ctx context.Context, id json.RawMessage) string {
+	return callerFrom(ctx) + "\x00" + sessionFrom(ctx) + "\x00" + string(bytes.TrimSpace(id))
+}
+
+// inflightReq is an entry of Server.inflight. Entries are compared by
+// pointer, so a request only ever removes its own.
+type inflightReq struct {
+	cancel context.CancelCauseFunc
+}
+
+// track registers a cancellable context for an in-flight request. A client
+// reusing the id of a request still in flight takes over the entry; the
+// earlier request can then no longer be cancelled.
+func (s *Server) track(ctx context.Context, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := inflightKey(ctx, id)
+	req := &inflightReq{cancel: cancel}
+	s.mu.Lock()
+	if s.inflight == nil {
+		s.inflight = map[string]*inflightReq{}
+	}
+	s.inflight[key] = req
+	s.mu.Unlock()
+	return ctx, func() {
+		s.mu.Lock()
+		if s.inflight[key] == req {
+			delete(s.inflight, key)
+		}
+		s.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancelRequest handles notifications/cancelled.
+func (s *Server) cancelRequest(ctx context.Context, id json.RawMessage) {
+	s.mu.Lock()
+	req, ok := s.inflight[inflightKey(ctx, id)]
+	s.mu.Unlock()
+	if ok {
+		req.cancel(errCancelledByClient)
+	}
+}
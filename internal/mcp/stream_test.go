@@ -0,0 +1,158 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+// readSSE collects the data payloads of an event stream until it closes.
+func readSSE(t *testing.T, res *http.Response) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			t.Fatalf("decode event %q: %v", data, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func ssePost(t *testing.T, url, session, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if session != "" {
+		req.Header.Set("Mcp-Session-Id", session)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	return res
+}
+
+func TestStreamProgressThenResult(t *testing.T) {
+	ts := httptest.NewServer(NewServer(ServerOptions{}))
+	defer ts.Close()
+
+	cfg := "kind: StackFlow\nmetadata: {name: demo}\nglobal: {domain: example.com, dns_provider: cloudflare, cloud: gcp}\ntargets: [{id: web, type: cloudrun, domains: [www.example.com]}]\n"
+	args, _ := json.Marshal(map[string]any{"config_yaml": cfg})
+	res := ssePost(t, ts.URL, "", `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"stackflow.plan.dns","arguments":`+string(args)+`,"_meta":{"progressToken":"tok"}}}`)
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	events := readSSE(t, res)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 2 progress + 1 response: %v", len(events), events)
+	}
+	for i, ev := range events[:2] {
+		params, _ := ev["params"].(map[string]any)
+		if ev["method"] != "notifications/progress" || params["progressToken"] != "tok" || params["progress"] != float64(i+1) {
+			t.Fatalf("event %d = %v", i, ev)
+		}
+	}
+	if events[2]["id"] != float64(7) || events[2]["result"] == nil {
+		t.Fatalf("last event = %v", events[2])
+	}
+}
+
+func TestStreamPlainJSONWithoutEventStreamAccept(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"stackflow.validate","arguments":{"config_yaml":"kind: x"},"_meta":{"progressToken":1}}}`)))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("content-type = %q", ct)
+	}
+}
+
+func TestStreamCancelledRequestGetsNoResponse(t *testing.T) {
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	ts := httptest.NewServer(NewServer(ServerOptions{Store: st}))
+	defer ts.Close()
+
+	// The watch request blocks in a goroutine; only the test goroutine may
+	// call t.Fatal, so it just forwards the raw stream body.
+	res := ssePost(t, ts.URL, "s1", `{"jsonrpc":"2.0","id":"w1","method":"tools/call","params":{"name":"runs.watch","arguments":{"timeout_seconds":30}}}`)
+	defer res.Body.Close()
+	done := make(chan string, 1)
+	go func() {
+		b, _ := io.ReadAll(res.Body)
+		done <- string(b)
+	}()
+
+	// Retry until the watch is registered as in flight.
+	deadline := time.After(5 * time.Second)
+	for {
+		res := ssePost(t, ts.URL, "s1", `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"w1","reason":"test"}}`)
+		res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			t.Fatalf("cancel status %d", res.StatusCode)
+		}
+		select {
+		case body := <-done:
+			if strings.Contains(body, "data:") {
+				t.Fatalf("cancelled request produced events: %q", body)
+			}
+			return
+		case <-deadline:
+			t.Fatal("watch was not cancelled")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestCancelIsBoundToCaller(t *testing.T) {
+	srv := NewServer(ServerOptions{})
+	as := func(sub string) context.Context {
+		return authn.WithIdentity(withSession(context.Background(), ""), authn.Identity{Subject: sub})
+	}
+	id := json.RawMessage(`1`)
+
+	ctx, done := srv.track(as("alice"), id)
+	defer done()
+	srv.cancelRequest(as("mallory"), id)
+	if ctx.Err() != nil {
+		t.Fatal("another caller cancelled the request")
+	}
+	srv.cancelRequest(as("alice"), id)
+	if !errors.Is(context.Cause(ctx), errCancelledByClient) {
+		t.Fatalf("own cancel: %v", context.Cause(ctx))
+	}
+
+	// A finished request must not drop the entry of a newer one with the
+	// same id.
+	_, done1 := srv.track(as("bob"), id)
+	ctx2, done2 := srv.track(as("bob"), id)
+	defer done2()
+	done1()
+	srv.cancelRequest(as("bob"), id)
+	if !errors.Is(context.Cause(ctx2), errCancelledByClient) {
+		t.Fatalf("newer request not cancellable: %v", context.Cause(ctx2))
+	}
+}
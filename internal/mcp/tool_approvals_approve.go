@@ -0,0 +1,26 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+func approvalsApprove(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	return decideApproval(ctx, st, args, store.ApprovalApproved)
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "approvals.approve",
+			Description: "Approve a pending plan approval, optionally until expires_in_seconds; requesters cannot approve their own plans.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"approval_id":{"type":"string","minLength":1},"reason":{"type":"string"},"expires_in_seconds":{"type":"integer","minimum":1}},"required":["approval_id"],"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Scope:      authn.ScopeApply,
+		Handler:    approvalsApprove,
+	})
+}
@@ -0,0 +1,42 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/store"
+)
+
+func approvalsList(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Stack  string `json:"stack"`
+		Env    string `json:"env"`
+		Status string `json:"status"`
+		Limit  int    `json:"limit"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	approvals, err := st.ListApprovals(ctx, store.ApprovalFilter{Stack: in.Stack, Env: in.Env, Status: in.Status, Limit: in.Limit})
+	if err != nil {
+		return nil, err
+	}
+	out := []store.Approval{}
+	for _, a := range approvals {
+		a.PlanJSON = nil
+		out = append(out, a)
+	}
+	return map[string]any{"approvals": out}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "approvals.list",
+			Description: "List plan approvals newest first, filtered by stack, env and status (pending|approved|rejected).",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"stack":{"type":"string"},"env":{"type":"string"},"status":{"type":"string","enum":["pending","approved","rejected"]},"limit":{"type":"integer","minimum":1,"maximum":200}},"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    approvalsList,
+	})
+}
@@ -0,0 +1,26 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+func approvalsReject(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	return decideApproval(ctx, st, args, store.ApprovalRejected)
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "approvals.reject",
+			Description: "Reject a pending plan approval, or revoke an approved one.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"approval_id":{"type":"string","minLength":1},"reason":{"type":"string"}},"required":["approval_id"],"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Scope:      authn.ScopeApply,
+		Handler:    approvalsReject,
+	})
+}
@@ -0,0 +1,42 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/authn"
+	"xcloudflow/internal/store"
+)
+
+func approvalsRequest(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Stack string          `json:"stack"`
+		Env   string          `json:"env"`
+		Plan  json.RawMessage `json:"plan"`
+		RunID string          `json:"run_id"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	a, err := st.RequestApproval(ctx, store.Approval{
+		Stack: in.Stack, Env: in.Env, PlanJSON: in.Plan, RunID: in.RunID, RequestedBy: authn.Actor(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.PlanJSON = nil
+	return map[string]any{"approval": a}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "approvals.request",
+			Description: "Submit a plan for approval; returns the pending approval and the plan's content hash that apply will be checked against.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"stack":{"type":"string","minLength":1},"env":{"type":"string","minLength":1},"plan":{},"run_id":{"type":"string"}},"required":["stack","env","plan"],"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Scope:      authn.ScopeApply,
+		Handler:    approvalsRequest,
+	})
+}
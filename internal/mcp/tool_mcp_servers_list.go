@@ -0,0 +1,67 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+// mcpServerView is a registered external MCP server. SecretRef is left out:
+// callers need the endpoint and its health, not where its token lives.
+type mcpServerView struct {
+	Name          string     `json:"name"`
+	BaseURL       string     `json:"base_url"`
+	Kind          string     `json:"kind"`
+	AuthType      string     `json:"auth_type"`
+	Enabled       bool       `json:"enabled"`
+	AllowTools    []string   `json:"allow_tools,omitempty"`
+	DenyTools     []string   `json:"deny_tools,omitempty"`
+	ApplyTools    []string   `json:"apply_tools,omitempty"`
+	Health        string     `json:"health"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastSeenAt    *time.Time `json:"last_seen_at,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	Tools         int        `json:"tools"`
+}
+
+func mcpServersList(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	srvs, err := st.ListMCPServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caches, err := st.ListMCPToolsCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	toolCount := map[string]int{}
+	for _, c := range caches {
+		var tools []json.RawMessage
+		if json.Unmarshal(c.Tools, &tools) == nil {
+			toolCount[c.ServerID] = len(tools)
+		}
+	}
+	views := []mcpServerView{}
+	for _, s := range srvs {
+		views = append(views, mcpServerView{
+			Name: s.Name, BaseURL: s.BaseURL, Kind: s.Kind, AuthType: s.AuthType, Enabled: s.Enabled,
+			AllowTools: s.AllowTools, DenyTools: s.DenyTools, ApplyTools: s.ApplyTools,
+			Health: s.Health, LastError: s.LastError, LastSeenAt: s.LastSeenAt, LastCheckedAt: s.LastCheckedAt,
+			Tools: toolCount[s.ServerID],
+		})
+	}
+	return map[string]any{"servers": views}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "mcp.servers.list",
+			Description: "List registered external MCP servers with their health and number of cached tools.",
+			InputSchema: json.RawMessage(`{"type":"object","additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    mcpServersList,
+	})
+}
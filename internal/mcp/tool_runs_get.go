@@ -0,0 +1,49 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"xcloudflow/internal/store"
+)
+
+func runsGet(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		RunID string `json:"run_id"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	r, err := st.GetRun(ctx, in.RunID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("run %s not found", in.RunID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return runWithArtifacts(ctx, st, r)
+}
+
+// runWithArtifacts is the full view of one run, as returned by runs.get and
+// runs.latest.
+func runWithArtifacts(ctx context.Context, st store.Store, r store.Run) (any, error) {
+	arts, err := st.ListRunArtifacts(ctx, r.RunID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"run": newRunView(r), "artifacts": newArtifactViews(arts)}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "runs.get",
+			Description: "Get one run with its inputs, plan, result and artifact references.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"run_id":{"type":"string","minLength":1}},"required":["run_id"],"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    runsGet,
+	})
+}
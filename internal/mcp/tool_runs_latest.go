@@ -0,0 +1,48 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"xcloudflow/internal/store"
+)
+
+func runsLatest(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Stack  string `json:"stack"`
+		Env    string `json:"env"`
+		Phase  string `json:"phase"`
+		Status string `json:"status"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	runs, err := st.ListRuns(ctx, store.RunFilter{Stack: in.Stack, Env: in.Env, Phase: in.Phase, Status: in.Status, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		where := []string{"stack " + in.Stack}
+		for _, f := range [][2]string{{"env", in.Env}, {"phase", in.Phase}, {"status", in.Status}} {
+			if f[1] != "" {
+				where = append(where, f[0]+" "+f[1])
+			}
+		}
+		return nil, fmt.Errorf("no run for %s", strings.Join(where, ", "))
+	}
+	return runWithArtifacts(ctx, st, runs[0])
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "runs.latest",
+			Description: "Get the most recent run of a stack, optionally narrowed by env, phase and status (e.g. the last prod plan and what it produced).",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"stack":{"type":"string","minLength":1},"env":{"type":"string"},"phase":{"type":"string"},"status":{"type":"string"}},"required":["stack"],"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    runsLatest,
+	})
+}
@@ -0,0 +1,45 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/store"
+)
+
+func runsList(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Stack  string `json:"stack"`
+		Env    string `json:"env"`
+		Phase  string `json:"phase"`
+		Status string `json:"status"`
+		Limit  int    `json:"limit"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	runs, err := st.ListRuns(ctx, store.RunFilter{Stack: in.Stack, Env: in.Env, Phase: in.Phase, Status: in.Status, Limit: in.Limit})
+	if err != nil {
+		return nil, err
+	}
+	// Summaries only; inputs, plan and result can be large (see runs.get).
+	views := []runView{}
+	for _, r := range runs {
+		v := newRunView(r)
+		v.Inputs, v.Plan, v.Result = nil, nil, nil
+		views = append(views, v)
+	}
+	return map[string]any{"runs": views}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "runs.list",
+			Description: "List runs newest first, filtered by stack, env, phase and status (summaries without inputs/plan/result).",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"stack":{"type":"string"},"env":{"type":"string"},"phase":{"type":"string"},"status":{"type":"string"},"limit":{"type":"integer","minimum":1,"maximum":200}},"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    runsList,
+	})
+}
@@ -0,0 +1,68 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"xcloudflow/internal/store"
+)
+
+func runsWatch(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Stack          string `json:"stack"`
+		Env            string `json:"env"`
+		TimeoutSeconds int    `json:"timeout_seconds"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	if in.TimeoutSeconds == 0 {
+		in.TimeoutSeconds = 25
+	}
+	wctx, cancel := context.WithTimeout(ctx, time.Duration(in.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	match := func(c store.Change) bool {
+		return c.Kind != "run" || ((in.Stack == "" || c.Stack == in.Stack) && (in.Env == "" || c.Env == in.Env))
+	}
+	// Block until the first matching change, then return it together
+	// with whatever else is already buffered.
+	changes := []store.Change{}
+	ch := store.Watch(wctx, st, 2*time.Second)
+wait:
+	for c := range ch {
+		if !match(c) {
+			continue
+		}
+		changes = append(changes, c)
+		for {
+			select {
+			case c, ok := <-ch:
+				if !ok {
+					break wait
+				}
+				if match(c) {
+					changes = append(changes, c)
+				}
+			default:
+				break wait
+			}
+		}
+	}
+	return map[string]any{"changes": changes}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "runs.watch",
+			Description: "Long-poll for run/agent event changes (requires a store).",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"stack":{"type":"string"},"env":{"type":"string"},"timeout_seconds":{"type":"integer","minimum":1,"maximum":120}},"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		// Covers the maximum timeout_seconds plus the final store read.
+		Timeout: 130 * time.Second,
+		Handler: runsWatch,
+	})
+}
@@ -0,0 +1,68 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"xcloudflow/internal/store"
+)
+
+func skillsGet(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Name   string `json:"name"`
+		Source string `json:"source"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	if in.Source == "" {
+		resolved, err := store.ResolveSkills(ctx, st)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resolved {
+			if r.Name == in.Name {
+				return map[string]any{"skill": newResolvedSkillView(r), "content": r.Doc.Content}, nil
+			}
+		}
+	}
+	// An explicit source, or a doc path rather than a skill name.
+	docs, err := st.ListSkillDocs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found []store.SkillDoc
+	for _, d := range docs {
+		if (d.Name == in.Name || d.Path == in.Name) && (in.Source == "" || d.SourceName == in.Source) {
+			found = append(found, d)
+		}
+	}
+	switch len(found) {
+	case 0:
+		if in.Source != "" {
+			return nil, fmt.Errorf("skill %s not found in source %s", in.Name, in.Source)
+		}
+		return nil, fmt.Errorf("skill %s not found", in.Name)
+	case 1:
+		return map[string]any{"skill": newSkillView(found[0]), "content": found[0].Content}, nil
+	}
+	var sources []string
+	for _, d := range found {
+		sources = append(sources, d.SourceName)
+	}
+	return nil, fmt.Errorf("skill %s exists in sources %s; pass source", in.Name, strings.Join(sources, ", "))
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "skills.get",
+			Description: "Get a skill by name: the copy that wins resolution (pins, then source priority), or the one from source when given. Other cached docs can be read by path.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"name":{"type":"string","minLength":1},"source":{"type":"string"}},"required":["name"],"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    skillsGet,
+	})
+}
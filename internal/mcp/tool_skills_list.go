@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"xcloudflow/internal/skills"
+	"xcloudflow/internal/store"
+)
+
+type skillView struct {
+	Name      string      `json:"name"`
+	Source    string      `json:"source"`
+	Path      string      `json:"path"`
+	SHA256    string      `json:"sha256"`
+	Commit    string      `json:"commit,omitempty"`
+	FetchedAt time.Time   `json:"fetched_at"`
+	URI       string      `json:"uri"`
+	Meta      skills.Meta `json:"meta"`
+	// Pinned and Reason are set for resolved skills (store.ResolveSkills).
+	Pinned bool   `json:"pinned,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func newSkillView(d store.SkillDoc) skillView {
+	return skillView{Name: d.Name, Source: d.SourceName, Path: d.Path, SHA256: d.SHA256, Commit: d.Commit, FetchedAt: d.FetchedAt, URI: skillURI(d), Meta: skillMeta(d)}
+}
+
+func newResolvedSkillView(r store.ResolvedSkill) skillView {
+	v := newSkillView(r.Doc)
+	v.Pinned, v.Reason = r.Pinned, r.Reason
+	return v
+}
+
+// skillMeta decodes the cached frontmatter; docs cached before it was
+// recorded (or with unreadable meta) have none.
+func skillMeta(d store.SkillDoc) skills.Meta {
+	var m skills.Meta
+	if len(d.Meta) > 0 {
+		_ = json.Unmarshal(d.Meta, &m)
+	}
+	return m
+}
+
+func skillsList(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Source string `json:"source"`
+		Tag    string `json:"tag"`
+		Phase  string `json:"phase"`
+		All    bool   `json:"all"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	views := []skillView{}
+	if in.All || in.Source != "" {
+		docs, err := st.ListSkillDocs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range docs {
+			if in.Source != "" && d.SourceName != in.Source {
+				continue
+			}
+			if v := newSkillView(d); v.Meta.Matches(in.Tag, in.Phase) {
+				views = append(views, v)
+			}
+		}
+		return map[string]any{"skills": views}, nil
+	}
+	resolved, err := store.ResolveSkills(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resolved {
+		if v := newResolvedSkillView(r); v.Meta.Matches(in.Tag, in.Phase) {
+			views = append(views, v)
+		}
+	}
+	return map[string]any{"skills": views}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "skills.list",
+			Description: "List skills (runbooks) with their frontmatter metadata, without their content (see skills.get). Each skill is listed once, from the source that wins resolution (pins, then source priority); source lists that source's docs and all lists every cached copy. phase keeps the skills whose applies_to.phases lists it; tag filters by tag.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"source":{"type":"string"},"tag":{"type":"string"},"phase":{"type":"string"},"all":{"type":"boolean"}},"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    skillsList,
+	})
+}
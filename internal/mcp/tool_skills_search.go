@@ -0,0 +1,38 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/store"
+)
+
+func skillsSearch(ctx context.Context, st store.Store, args json.RawMessage) (any, error) {
+	var in struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	hits, err := st.SearchSkills(ctx, in.Query, in.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if hits == nil {
+		hits = []store.SkillHit{}
+	}
+	return map[string]any{"hits": hits}, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "skills.search",
+			Description: "Full-text search over cached skill docs (runbooks); returns ranked snippets.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","minLength":1},"limit":{"type":"integer","minimum":1,"maximum":50}},"required":["query"],"additionalProperties":false}`),
+		},
+		NeedsStore: true,
+		Handler:    skillsSearch,
+	})
+}
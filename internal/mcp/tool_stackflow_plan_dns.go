@@ -0,0 +1,38 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/stackflow"
+	"xcloudflow/internal/store"
+)
+
+func stackflowPlanDNS(ctx context.Context, _ store.Store, args json.RawMessage) (any, error) {
+	var in stackflowInput
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	cfg, err := stackflow.LoadYAML([]byte(in.ConfigYAML))
+	if err != nil {
+		return nil, err
+	}
+	ReportProgress(ctx, 1, 2, "config parsed")
+	out, err := stackflow.DNSPlan(cfg, in.Env)
+	if err != nil {
+		return nil, err
+	}
+	ReportProgress(ctx, 2, 2, "dns plan ready")
+	return out, nil
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "stackflow.plan.dns",
+			Description: "Generate DNS plan from StackFlow config.",
+			InputSchema: json.RawMessage(stackflowInputSchema),
+		},
+		Handler: stackflowPlanDNS,
+	})
+}
@@ -0,0 +1,43 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"xcloudflow/internal/stackflow"
+	"xcloudflow/internal/store"
+)
+
+// stackflowInput is shared by the stackflow.* tools.
+type stackflowInput struct {
+	ConfigYAML string `json:"config_yaml"`
+	Env        string `json:"env"`
+}
+
+const stackflowInputSchema = `{"type":"object","properties":{"config_yaml":{"type":"string","minLength":1},"env":{"type":"string"}},"required":["config_yaml"],"additionalProperties":false}`
+
+func stackflowValidate(ctx context.Context, _ store.Store, args json.RawMessage) (any, error) {
+	var in stackflowInput
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	cfg, err := stackflow.LoadYAML([]byte(in.ConfigYAML))
+	if err != nil {
+		return nil, err
+	}
+	if in.Env != "" {
+		cfg = stackflow.ApplyEnvOverrides(cfg, in.Env)
+	}
+	return stackflow.Validate(cfg)
+}
+
+func init() {
+	RegisterTool(ToolSpec{
+		Tool: Tool{
+			Name:        "stackflow.validate",
+			Description: "Validate StackFlow config (schema + constraints).",
+			InputSchema: json.RawMessage(stackflowInputSchema),
+		},
+		Handler: stackflowValidate,
+	})
+}
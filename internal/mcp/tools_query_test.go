@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"xcloudflow/internal/store"
+)
+
+// callStructured calls a tool and returns its structuredContent, or the
+// error text when the tool failed.
+func callStructured(t *testing.T, srv *Server, name, args string) (map[string]any, string) {
+	t.Helper()
+	var res CallToolResult
+	if rerr := rpcResult(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+name+`","arguments":`+args+`}}`, &res); rerr != nil {
+		t.Fatalf("%s: %+v", name, rerr)
+	}
+	if res.IsError {
+		return nil, res.Content[0].Text
+	}
+	b, _ := json.Marshal(res.StructuredContent)
+	var out map[string]any
+	json.Unmarshal(b, &out)
+	return out, ""
+}
+
+func TestStoreQueryTools(t *testing.T) {
+	srv, st, runID := seededServer(t)
+	ctx := context.Background()
+	if err := st.FinishRun(ctx, runID, store.RunOK, []byte(`{"records":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.CreateRun(ctx, store.Run{Stack: "demo", Env: "dev", Phase: "plan", Status: store.RunRunning}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.UpsertMCPServer(ctx, store.MCPServer{Name: "dns", BaseURL: "http://dns.internal/mcp", SecretRef: "env:DNS_TOKEN", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := callStructured(t, srv, "runs.list", `{"stack":"demo"}`)
+	runs := out["runs"].([]any)
+	if len(runs) != 2 || runs[0].(map[string]any)["env"] != "dev" {
+		t.Fatalf("runs.list: %v", out)
+	}
+	if _, ok := runs[1].(map[string]any)["result"]; ok {
+		t.Fatalf("runs.list should not include results: %v", runs[1])
+	}
+
+	out, _ = callStructured(t, srv, "runs.latest", `{"stack":"demo","env":"prod","phase":"plan"}`)
+	run := out["run"].(map[string]any)
+	if run["run_id"] != runID || run["result"].(map[string]any)["records"] != float64(3) || len(out["artifacts"].([]any)) != 1 {
+		t.Fatalf("runs.latest: %v", out)
+	}
+	if _, msg := callStructured(t, srv, "runs.latest", `{"stack":"demo","env":"stage"}`); msg != "no run for stack demo, env stage" {
+		t.Fatalf("runs.latest miss: %q", msg)
+	}
+	if out, _ = callStructured(t, srv, "runs.get", `{"run_id":"`+runID+`"}`); out["run"].(map[string]any)["status"] != store.RunOK {
+		t.Fatalf("runs.get: %v", out)
+	}
+	if _, msg := callStructured(t, srv, "runs.get", `{"run_id":"nope"}`); !strings.Contains(msg, "not found") {
+		t.Fatalf("runs.get missing: %q", msg)
+	}
+
+	out, _ = callStructured(t, srv, "mcp.servers.list", `{}`)
+	if srvs := out["servers"].([]any); len(srvs) != 1 || srvs[0].(map[string]any)["name"] != "dns" {
+		t.Fatalf("mcp.servers.list: %v", out)
+	}
+	if b, _ := json.Marshal(out); strings.Contains(string(b), "DNS_TOKEN") {
+		t.Fatalf("mcp.servers.list leaks secret ref: %s", b)
+	}
+
+	out, _ = callStructured(t, srv, "skills.list", `{"source":"team-a"}`)
+	if len(out["skills"].([]any)) != 2 {
+		t.Fatalf("skills.list: %v", out)
+	}
+	srcID, _ := st.AddSkillSource(ctx, store.SkillSource{Name: "team-a", Type: "local", URI: "/tmp/team-a", Enabled: true})
+	if err := st.UpsertSkillDoc(ctx, store.SkillDoc{SourceID: srcID, Path: "rollback/SKILL.md", SHA256: "z", Content: "# Rollback\n",
+		Meta: json.RawMessage(`{"tags":["deploy"],"applies_to":{"phases":["apply"]}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = callStructured(t, srv, "skills.list", `{"phase":"APPLY"}`)
+	if sk := out["skills"].([]any); len(sk) != 1 || sk[0].(map[string]any)["name"] != "rollback" {
+		t.Fatalf("skills.list phase: %v", out)
+	}
+	if out, _ = callStructured(t, srv, "skills.list", `{"tag":"deploy","phase":"plan"}`); len(out["skills"].([]any)) != 0 {
+		t.Fatalf("skills.list tag+phase: %v", out)
+	}
+	out, _ = callStructured(t, srv, "skills.get", `{"name":"dns","source":"team-b"}`)
+	if !strings.Contains(out["content"].(string), "Fix DNS for team-b") {
+		t.Fatalf("skills.get: %v", out)
+	}
+
+	// Without a source, skills.get and skills.list return the resolved copy.
+	out, _ = callStructured(t, srv, "skills.get", `{"name":"dns"}`)
+	if sk := out["skill"].(map[string]any); sk["source"] != "team-a" || !strings.Contains(sk["reason"].(string), "tie with team-b") {
+		t.Fatalf("resolved skills.get: %v", out)
+	}
+	var teamB string
+	srcs, _ := st.ListSkillSources(ctx)
+	for _, src := range srcs {
+		if src.Name == "team-b" {
+			teamB = src.SourceID
+		}
+	}
+	if _, err := st.PinSkill(ctx, store.SkillPin{Skill: "dns", SourceID: teamB}); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = callStructured(t, srv, "skills.get", `{"name":"dns"}`)
+	if sk := out["skill"].(map[string]any); sk["source"] != "team-b" || sk["pinned"] != true || !strings.Contains(out["content"].(string), "team-b") {
+		t.Fatalf("pinned skills.get: %v", out)
+	}
+	out, _ = callStructured(t, srv, "skills.list", `{}`)
+	if sk := out["skills"].([]any); len(sk) != 2 || sk[0].(map[string]any)["source"] != "team-b" {
+		t.Fatalf("resolved skills.list: %v", out)
+	}
+	if out, _ = callStructured(t, srv, "skills.list", `{"all":true}`); len(out["skills"].([]any)) != 3 {
+		t.Fatalf("skills.list all: %v", out)
+	}
+}
+
+func TestSkillsSearchTool(t *testing.T) {
+	srv, _, _ := seededServer(t)
+
+	out, _ := callStructured(t, srv, "skills.search", `{"query":"dns -team-b"}`)
+	hits := out["hits"].([]any)
+	if len(hits) != 1 {
+		t.Fatalf("skills.search: %v", out)
+	}
+	if h := hits[0].(map[string]any); h["name"] != "dns" || h["source"] != "team-a" || !strings.Contains(h["snippet"].(string), "**DNS**") {
+		t.Fatalf("skills.search hit: %v", h)
+	}
+	if out, _ = callStructured(t, srv, "skills.search", `{"query":"steps or deploy","limit":2}`); len(out["hits"].([]any)) != 2 {
+		t.Fatalf("skills.search limit: %v", out)
+	}
+	if out, _ = callStructured(t, srv, "skills.search", `{"query":"nosuchword"}`); out["hits"] == nil || len(out["hits"].([]any)) != 0 {
+		t.Fatalf("skills.search miss: %v", out)
+	}
+	var res CallToolResult
+	if rerr := rpcResult(t, srv, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"skills.search","arguments":{"query":""}}}`, &res); rerr == nil || rerr.Code != -32602 {
+		t.Fatalf("skills.search empty query: %+v", rerr)
+	}
+}
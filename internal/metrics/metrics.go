@@ -0,0 +1,285 @@
+// Package metrics is a small Prometheus text-format (0.0.4) registry.
+//
+// It covers what the control plane exports: counter and histogram vectors
+// updated in-process, and collectors that produce gauges at scrape time
+// (DB pool stats, run counts). No client library is needed to scrape it.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are latency buckets in seconds, from 5ms to 2 minutes.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	families   []family
+	collectors []CollectFunc
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// CollectFunc emits scrape-time samples.
+type CollectFunc func(ctx context.Context, e *Emitter)
+
+func NewRegistry() *Registry { return &Registry{} }
+
+// Counter registers a counter vector with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, labels}, values: map[string]*counterValue{}}
+	r.add(c)
+	return c
+}
+
+// Histogram registers a histogram vector; buckets are upper bounds in
+// increasing order (+Inf is implicit).
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{desc: desc{name, help, labels}, buckets: buckets, values: map[string]*histValue{}}
+	r.add(h)
+	return h
+}
+
+// Collect registers fn to run on every scrape.
+func (r *Registry) Collect(fn CollectFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+func (r *Registry) add(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// ServeHTTP writes all metrics in the text exposition format. Collectors
+// share a 5s budget bounded by the request.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	collectors := append([]CollectFunc(nil), r.collectors...)
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	for _, f := range families {
+		f.write(bw)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	defer cancel()
+	e := &Emitter{}
+	for _, fn := range collectors {
+		fn(ctx, e)
+	}
+	e.write(bw)
+}
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, typ)
+}
+
+// key joins label values; \xff cannot appear in valid UTF-8.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s: got %d label values, want %d", d.name, len(values), len(d.labels)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (d desc) labelPairs(key string, extra ...string) string {
+	var values []string
+	if len(d.labels) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+	var parts []string
+	for i, l := range d.labels {
+		parts = append(parts, l+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// CounterVec is a monotonically increasing counter per label set.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct{ v float64 }
+
+// Add increases the counter for the label values by v (v >= 0).
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter decreased")
+	}
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv := c.values[k]
+	if cv == nil {
+		cv = &counterValue{}
+		c.values[k] = cv
+	}
+	cv.v += v
+}
+
+// Inc adds 1.
+func (c *CounterVec) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(k), formatFloat(c.values[k].v))
+	}
+}
+
+// HistogramVec is a cumulative histogram per label set.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histValue
+}
+
+type histValue struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe records v for the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv := h.values[k]
+	if hv == nil {
+		hv = &histValue{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, k := range sortedKeys(h.values) {
+		hv := h.values[k]
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", formatFloat(ub)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(k), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(k), hv.count)
+	}
+}
+
+// Emitter collects scrape-time samples. Samples of one metric are grouped
+// under a single HELP/TYPE header in first-seen order.
+type Emitter struct {
+	order  []string
+	byName map[string]*emitted
+}
+
+type emitted struct {
+	typ, help string
+	lines     []string
+}
+
+// Gauge emits one gauge sample. labels are name/value pairs.
+func (e *Emitter) Gauge(name, help string, v float64, labels ...string) {
+	e.emit(name, help, "gauge", v, labels)
+}
+
+// CounterValue emits a counter maintained elsewhere (e.g. a pool's
+// cumulative acquire count).
+func (e *Emitter) CounterValue(name, help string, v float64, labels ...string) {
+	e.emit(name, help, "counter", v, labels)
+}
+
+func (e *Emitter) emit(name, help, typ string, v float64, labels []string) {
+	if e.byName == nil {
+		e.byName = map[string]*emitted{}
+	}
+	em := e.byName[name]
+	if em == nil {
+		em = &emitted{typ: typ, help: help}
+		e.byName[name] = em
+		e.order = append(e.order, name)
+	}
+	em.lines = append(em.lines, name+desc{name: name}.labelPairs("", labels...)+" "+formatFloat(v))
+}
+
+func (e *Emitter) write(w *bufio.Writer) {
+	for _, name := range e.order {
+		em := e.byName[name]
+		desc{name: name, help: em.help}.header(w, em.typ)
+		for _, l := range em.lines {
+			fmt.Fprintln(w, l)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
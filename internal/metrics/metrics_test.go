@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type %q", ct)
+	}
+	b, _ := io.ReadAll(rec.Body)
+	return string(b)
+}
+
+func TestRegistryTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	calls := reg.Counter("calls_total", "Calls.", "tool")
+	lat := reg.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "tool")
+	reg.Collect(func(ctx context.Context, e *Emitter) {
+		e.Gauge("runs", "Runs by status.", 2, "status", "ok")
+		e.Gauge("runs", "Runs by status.", 1, "status", `fa"il`)
+	})
+
+	calls.Inc("b")
+	calls.Add(2, "a")
+	lat.Observe(0.05, "a")
+	lat.Observe(0.5, "a")
+	lat.Observe(3, "a")
+
+	want := `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total{tool="a"} 2
+calls_total{tool="b"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{tool="a",le="0.1"} 1
+latency_seconds_bucket{tool="a",le="1"} 2
+latency_seconds_bucket{tool="a",le="+Inf"} 3
+latency_seconds_sum{tool="a"} 3.55
+latency_seconds_count{tool="a"} 3
+# HELP runs Runs by status.
+# TYPE runs gauge
+runs{status="ok"} 2
+runs{status="fa\"il"} 1
+`
+	if got := scrape(t, reg); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	NewRegistry().Counter("c", "C.", "a", "b").Inc("only-one")
+}
@@ -0,0 +1,44 @@
+// Package secrets resolves secret references.
+//
+// XCloudFlow never stores credentials itself; it stores where to find them.
+// On Cloud Run, Secret Manager secrets are exposed as env vars or mounted
+// files, which is what the supported schemes cover:
+//
+//	env:NAME     value of environment variable NAME
+//	file:PATH    contents of PATH, surrounding whitespace trimmed
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrEmpty = errors.New("secret is empty")
+
+// Resolve returns the secret that ref points at.
+func Resolve(ref string) (string, error) {
+	scheme, arg, ok := strings.Cut(ref, ":")
+	if !ok || arg == "" {
+		return "", fmt.Errorf("secret ref %q: want env:NAME or file:PATH", ref)
+	}
+	var v string
+	switch scheme {
+	case "env":
+		v = os.Getenv(arg)
+	case "file":
+		b, err := os.ReadFile(arg)
+		if err != nil {
+			return "", fmt.Errorf("secret ref %q: %w", ref, err)
+		}
+		v = string(b)
+	default:
+		return "", fmt.Errorf("secret ref %q: unsupported scheme %q", ref, scheme)
+	}
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return "", fmt.Errorf("secret ref %q: %w", ref, ErrEmpty)
+	}
+	return v, nil
+}
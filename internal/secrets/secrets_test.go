@@ -0,0 +1,29 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("XCF_TEST_SECRET", " tok \n")
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for ref, want := range map[string]string{"env:XCF_TEST_SECRET": "tok", "file:" + path: "from-file"} {
+		if got, err := Resolve(ref); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+	if _, err := Resolve("env:XCF_TEST_SECRET_UNSET"); !errors.Is(err, ErrEmpty) {
+		t.Errorf("unset env: %v", err)
+	}
+	for _, ref := range []string{"", "plain", "env:", "vault:x", "file:" + path + ".missing"} {
+		if _, err := Resolve(ref); err == nil {
+			t.Errorf("Resolve(%q): want error", ref)
+		}
+	}
+}
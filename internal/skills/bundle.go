@@ -0,0 +1,279 @@
+package skills
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BundleOptions bound what FetchBundle accepts. Zero values take defaults.
+type BundleOptions struct {
+	Timeout time.Duration // whole download (default 60s)
+	// MaxDownload caps the archive itself (default 32 MiB).
+	MaxDownload int64
+	// MaxUnpacked caps the total size of all entries once decompressed
+	// (default 64 MiB); this is what stops decompression bombs.
+	MaxUnpacked int64
+	// MaxSkillBytes caps one SKILL.md (default 1 MiB).
+	MaxSkillBytes int64
+	// MaxEntries caps the number of archive entries (default 10000).
+	MaxEntries int
+}
+
+func (o BundleOptions) withDefaults() BundleOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = 60 * time.Second
+	}
+	if o.MaxDownload <= 0 {
+		o.MaxDownload = 32 << 20
+	}
+	if o.MaxUnpacked <= 0 {
+		o.MaxUnpacked = 64 << 20
+	}
+	if o.MaxSkillBytes <= 0 {
+		o.MaxSkillBytes = 1 << 20
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 10000
+	}
+	return o
+}
+
+// ErrUnsafeBundle is returned for archives that exceed a limit or contain
+// entries that could escape the bundle (absolute paths, "..").
+var ErrUnsafeBundle = errors.New("unsafe skills bundle")
+
+// IsBundleURL reports whether rawURL names a .tar.gz, .tgz or .zip bundle.
+func IsBundleURL(rawURL string) bool {
+	p := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		p = u.Path
+	}
+	p = strings.ToLower(p)
+	return strings.HasSuffix(p, ".tar.gz") || strings.HasSuffix(p, ".tgz") || strings.HasSuffix(p, ".zip")
+}
+
+// FetchBundle downloads a skills bundle and returns every <name>/SKILL.md in
+// it, at any depth, sorted by name. Skill.Path is the entry's path inside the
+// archive. Nothing is written to disk.
+func FetchBundle(ctx context.Context, rawURL string, opts BundleOptions) ([]Skill, error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("http %d", resp.StatusCode)
+	}
+	if resp.ContentLength > opts.MaxDownload {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the %d byte download limit", ErrUnsafeBundle, resp.ContentLength, opts.MaxDownload)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, opts.MaxDownload+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > opts.MaxDownload {
+		return nil, fmt.Errorf("%w: exceeds the %d byte download limit", ErrUnsafeBundle, opts.MaxDownload)
+	}
+	return ReadBundle(b, opts)
+}
+
+// ReadBundle extracts the skills of an in-memory .tar.gz or .zip archive
+// (detected from its content).
+func ReadBundle(b []byte, opts BundleOptions) ([]Skill, error) {
+	opts = opts.withDefaults()
+	u := &unpacker{opts: opts, skills: map[string]Skill{}}
+	var err error
+	switch {
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		err = u.tarGz(b)
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+		err = u.zip(b)
+	default:
+		return nil, fmt.Errorf("skills bundle: not a .tar.gz or .zip archive")
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Skill, 0, len(u.skills))
+	for _, s := range u.skills {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+type unpacker struct {
+	opts     BundleOptions
+	entries  int
+	unpacked int64
+	skills   map[string]Skill
+}
+
+func (u *unpacker) tarGz(b []byte) error {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("skills bundle: %w", err)
+	}
+	// Bound the decompressed stream as a whole: tar headers and skipped
+	// entries count too.
+	tr := tar.NewReader(&capReader{r: zr, left: u.opts.MaxUnpacked})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("skills bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			// Directories are implied; links and devices are never followed.
+			if err := u.count(hdr.Name, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := u.entry(hdr.Name, hdr.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (u *unpacker) zip(b []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return fmt.Errorf("skills bundle: %w", err)
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			if err := u.count(f.Name, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		// The declared size is checked up front and enforced while reading,
+		// since a crafted header can understate it.
+		size := int64(f.UncompressedSize64)
+		if f.UncompressedSize64 > uint64(u.opts.MaxUnpacked) {
+			size = u.opts.MaxUnpacked + 1
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("skills bundle: %s: %w", f.Name, err)
+		}
+		err = u.entry(f.Name, size, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count checks the entry name and the running limits.
+func (u *unpacker) count(name string, size int64) error {
+	if err := checkEntryName(name); err != nil {
+		return err
+	}
+	u.entries++
+	if u.entries > u.opts.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrUnsafeBundle, u.opts.MaxEntries)
+	}
+	u.unpacked += size
+	if u.unpacked > u.opts.MaxUnpacked {
+		return fmt.Errorf("%w: unpacks to more than %d bytes", ErrUnsafeBundle, u.opts.MaxUnpacked)
+	}
+	return nil
+}
+
+func (u *unpacker) entry(name string, size int64, r io.Reader) error {
+	if err := u.count(name, size); err != nil {
+		return err
+	}
+	clean := strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, `\`, "/")), "./")
+	dir, base := path.Split(clean)
+	skillName := path.Base(dir)
+	if base != "SKILL.md" || dir == "" || hiddenPath(clean) {
+		return nil
+	}
+	if size > u.opts.MaxSkillBytes {
+		return fmt.Errorf("%w: %s is larger than %d bytes", ErrUnsafeBundle, clean, u.opts.MaxSkillBytes)
+	}
+	b, err := io.ReadAll(io.LimitReader(r, u.opts.MaxSkillBytes+1))
+	if err != nil {
+		return fmt.Errorf("skills bundle: %s: %w", clean, err)
+	}
+	if int64(len(b)) > u.opts.MaxSkillBytes || int64(len(b)) > size {
+		return fmt.Errorf("%w: %s is larger than its header claims", ErrUnsafeBundle, clean)
+	}
+	if prev, dup := u.skills[skillName]; dup {
+		return fmt.Errorf("skills bundle: skill %s appears twice (%s, %s)", skillName, prev.Path, clean)
+	}
+	meta, _ := ParseMeta(string(b))
+	u.skills[skillName] = Skill{Name: skillName, Path: clean, Content: string(b), SHA256: shaHex(b), Meta: meta}
+	return nil
+}
+
+// checkEntryName rejects names that would escape an extraction directory.
+func checkEntryName(name string) error {
+	n := strings.ReplaceAll(name, `\`, "/")
+	if n == "" || strings.HasPrefix(n, "/") || (len(n) >= 2 && n[1] == ':') {
+		return fmt.Errorf("%w: entry %q has an absolute path", ErrUnsafeBundle, name)
+	}
+	for _, part := range strings.Split(n, "/") {
+		if part == ".." {
+			return fmt.Errorf("%w: entry %q escapes the bundle", ErrUnsafeBundle, name)
+		}
+	}
+	return nil
+}
+
+// hiddenPath reports dot-directories and archiver metadata such as
+// __MACOSX/, which are not skills.
+func hiddenPath(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// capReader fails once more than left bytes were read.
+type capReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (c *capReader) Read(p []byte) (int, error) {
+	if c.left < 0 {
+		return 0, fmt.Errorf("%w: decompresses to more than the unpacked limit", ErrUnsafeBundle)
+	}
+	if int64(len(p)) > c.left+1 {
+		p = p[:c.left+1]
+	}
+	n, err := c.r.Read(p)
+	c.left -= int64(n)
+	if c.left < 0 {
+		return n, fmt.Errorf("%w: decompresses to more than the unpacked limit", ErrUnsafeBundle)
+	}
+	return n, err
+}
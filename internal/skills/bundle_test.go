@@ -0,0 +1,146 @@
+package skills
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	name, body string
+	link       bool
+}
+
+func tarGz(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.link {
+			hdr = &tar.Header{Name: e.name, Linkname: e.body, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if !e.link {
+			tw.Write([]byte(e.body))
+		}
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.body))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestReadBundle(t *testing.T) {
+	entries := []entry{
+		{name: "bundle-v1/README.md", body: "not a skill"},
+		{name: "bundle-v1/dns/SKILL.md", body: "# DNS\n"},
+		{name: "bundle-v1/team/rollback/SKILL.md", body: "# Rollback\n"},
+		{name: "SKILL.md", body: "top-level file has no skill name"},
+		{name: "__MACOSX/bundle-v1/dns/SKILL.md", body: "junk"},
+	}
+	for name, archive := range map[string][]byte{
+		"tar.gz": tarGz(t, append(entries, entry{name: "bundle-v1/link/SKILL.md", body: "/etc/passwd", link: true})...),
+		"zip":    zipped(t, entries...),
+	} {
+		got, err := ReadBundle(archive, BundleOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != 2 || got[0].Name != "dns" || got[0].Content != "# DNS\n" || got[0].Path != "bundle-v1/dns/SKILL.md" ||
+			got[1].Name != "rollback" || got[1].SHA256 != shaHex([]byte("# Rollback\n")) {
+			t.Fatalf("%s: %+v", name, got)
+		}
+	}
+}
+
+func TestReadBundleRejectsUnsafeArchives(t *testing.T) {
+	bomb := strings.Repeat("\x00", 4<<20)
+	for name, c := range map[string]struct {
+		archive []byte
+		opts    BundleOptions
+	}{
+		"tar traversal":    {archive: tarGz(t, entry{name: "../evil/SKILL.md", body: "x"})},
+		"zip traversal":    {archive: zipped(t, entry{name: "a/../../evil/SKILL.md", body: "x"})},
+		"absolute":         {archive: tarGz(t, entry{name: "/etc/x/SKILL.md", body: "x"})},
+		"windows absolute": {archive: zipped(t, entry{name: `C:\x\SKILL.md`, body: "x"})},
+		"tar bomb":         {archive: tarGz(t, entry{name: "filler.bin", body: bomb}), opts: BundleOptions{MaxUnpacked: 1 << 20}},
+		"zip bomb":         {archive: zipped(t, entry{name: "filler.bin", body: bomb}), opts: BundleOptions{MaxUnpacked: 1 << 20}},
+		"oversized skill":  {archive: zipped(t, entry{name: "big/SKILL.md", body: strings.Repeat("x", 2048)}), opts: BundleOptions{MaxSkillBytes: 1024}},
+		"too many entries": {archive: zipped(t, entry{name: "a", body: ""}, entry{name: "b", body: ""}, entry{name: "c", body: ""}), opts: BundleOptions{MaxEntries: 2}},
+	} {
+		if _, err := ReadBundle(c.archive, c.opts); !errors.Is(err, ErrUnsafeBundle) {
+			t.Errorf("%s: err = %v, want ErrUnsafeBundle", name, err)
+		}
+	}
+	if _, err := ReadBundle(tarGz(t, entry{name: "a/SKILL.md", body: "1"}, entry{name: "b/a/SKILL.md", body: "2"}), BundleOptions{}); err == nil {
+		t.Error("duplicate skill name accepted")
+	}
+	if _, err := ReadBundle([]byte("# just markdown"), BundleOptions{}); err == nil {
+		t.Error("non-archive accepted")
+	}
+}
+
+func TestFetchBundle(t *testing.T) {
+	archive := zipped(t, entry{name: "dns/SKILL.md", body: "# DNS\n"})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	got, err := FetchBundle(ctx, ts.URL+"/skills.zip", BundleOptions{Timeout: 5 * time.Second})
+	if err != nil || len(got) != 1 || got[0].Name != "dns" {
+		t.Fatalf("fetch: %+v, %v", got, err)
+	}
+	if _, err := FetchBundle(ctx, ts.URL+"/skills.zip", BundleOptions{MaxDownload: 16}); !errors.Is(err, ErrUnsafeBundle) {
+		t.Fatalf("download cap: %v", err)
+	}
+
+	for u, want := range map[string]bool{
+		"https://x/skills.tar.gz":        true,
+		"https://x/skills.TGZ":           true,
+		"https://x/skills.zip?token=abc": true,
+		"https://x/dns/SKILL.md":         false,
+	} {
+		if IsBundleURL(u) != want {
+			t.Errorf("IsBundleURL(%q) != %v", u, want)
+		}
+	}
+}
+
+func TestFetchHTTPNamesSkillAfterDirectory(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# DNS\n"))
+	}))
+	defer ts.Close()
+	s, err := FetchHTTP(ts.URL+"/skills/dns/SKILL.md", 5*time.Second)
+	if err != nil || s.Name != "dns" {
+		t.Fatalf("%+v, %v", s, err)
+	}
+}
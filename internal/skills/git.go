@@ -0,0 +1,145 @@
+package skills
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitCheckout is a source repository checked out at one commit.
+type GitCheckout struct {
+	// Dir is the work tree (BasePath not applied).
+	Dir string
+	// Commit is the full SHA of the checked-out commit.
+	Commit string
+}
+
+// SyncGit makes a shallow checkout of ref (default: the remote HEAD) of the
+// repository at uri under cacheDir, fetching into an existing checkout when
+// there is one. uri is anything git accepts: https URLs, file:// URLs and
+// local paths, including bare repositories.
+//
+// Credentials are left to git (credential helpers, GIT_ASKPASS); prompting is
+// disabled so a missing credential fails instead of hanging.
+func SyncGit(ctx context.Context, uri, ref, cacheDir string) (GitCheckout, error) {
+	if uri == "" {
+		return GitCheckout{}, fmt.Errorf("git: empty uri")
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") {
+		return GitCheckout{}, fmt.Errorf("git: invalid ref %q", ref)
+	}
+	// One checkout per repository URI.
+	sum := sha256.Sum256([]byte(uri))
+	dir := filepath.Join(cacheDir, "git", hex.EncodeToString(sum[:8]))
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return GitCheckout{}, err
+		}
+		if _, err := git(ctx, dir, "init", "-q"); err != nil {
+			return GitCheckout{}, err
+		}
+		if _, err := git(ctx, dir, "remote", "add", "--", "origin", uri); err != nil {
+			return GitCheckout{}, err
+		}
+	} else if _, err := git(ctx, dir, "remote", "set-url", "--", "origin", uri); err != nil {
+		return GitCheckout{}, err
+	}
+	if _, err := git(ctx, dir, "fetch", "-q", "--depth", "1", "--no-tags", "origin", ref); err != nil {
+		return GitCheckout{}, err
+	}
+	if _, err := git(ctx, dir, "checkout", "-q", "--force", "--detach", "FETCH_HEAD"); err != nil {
+		return GitCheckout{}, err
+	}
+	if _, err := git(ctx, dir, "clean", "-q", "-fdx"); err != nil {
+		return GitCheckout{}, err
+	}
+	commit, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return GitCheckout{}, err
+	}
+	return GitCheckout{Dir: dir, Commit: commit}, nil
+}
+
+// Skills reads the skills under <Dir>/<basePath>/*/SKILL.md, with content.
+//
+// Unlike DiscoverLocal it treats the tree as untrusted, like FetchBundle:
+// symlinks are never followed, so a repository cannot have host files
+// (SKILL.md -> ~/.aws/credentials, or a linked skill or base directory)
+// cached and served as skills. Links are skipped; a base path that resolves
+// outside the checkout is an error.
+func (co GitCheckout) Skills(basePath string) ([]Skill, error) {
+	root, err := filepath.EvalSymlinks(co.Dir)
+	if err != nil {
+		return nil, err
+	}
+	dir := SubDir(root, basePath)
+	if !resolvesWithin(root, dir) {
+		return nil, fmt.Errorf("git: base path %q resolves outside the checkout", basePath)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Skill
+	for _, e := range entries {
+		// DirEntry types come from lstat: a linked directory is not a dir.
+		if !e.IsDir() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name(), "SKILL.md")
+		if fi, err := os.Lstat(p); err != nil || !fi.Mode().IsRegular() || !resolvesWithin(root, p) {
+			continue
+		}
+		sk, err := ReadSkill(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sk)
+	}
+	return out, nil
+}
+
+// resolvesWithin reports whether p, with every symlink resolved, is root or
+// below it. root must already be resolved.
+func resolvesWithin(root, p string) bool {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SubDir joins a source's BasePath to dir without letting it escape dir.
+func SubDir(dir, basePath string) string {
+	if basePath == "" {
+		return dir
+	}
+	return filepath.Join(dir, filepath.Clean(string(filepath.Separator)+basePath))
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,229 @@
+package skills
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"path"
+	"strings"
+	"testing"
+
+	"xcloudflow/internal/store"
+)
+
+// gitRepo creates a bare repository and a work tree that pushes to it.
+func gitRepo(t *testing.T) (bare, work string, commit func(files map[string]string, tag string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	bare, work = filepath.Join(root, "skills.git"), filepath.Join(root, "work")
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+			"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com", "GIT_CONFIG_GLOBAL=/dev/null")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run(root, "init", "-q", "--bare", "-b", "main", bare)
+	run(root, "init", "-q", "-b", "main", work)
+	run(work, "remote", "add", "origin", bare)
+	return bare, work, func(files map[string]string, tag string) string {
+		for name, content := range files {
+			p := filepath.Join(work, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		run(work, "add", "-A")
+		run(work, "commit", "-q", "-m", "update")
+		if tag != "" {
+			run(work, "tag", tag)
+		}
+		run(work, "push", "-q", "--tags", "origin", "main")
+		return run(work, "rev-parse", "HEAD")
+	}
+}
+
+func TestSyncGit(t *testing.T) {
+	bare, _, commit := gitRepo(t)
+	v1 := commit(map[string]string{"skills/dns/SKILL.md": "# DNS v1\n", "README.md": "x"}, "v1")
+	v2 := commit(map[string]string{"skills/dns/SKILL.md": "# DNS v2\n", "skills/rollback/SKILL.md": "# Rollback\n"}, "")
+
+	ctx := context.Background()
+	cache := t.TempDir()
+	for _, uri := range []string{bare, "file://" + bare} {
+		co, err := SyncGit(ctx, uri, "", cache)
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		if co.Commit != v2 {
+			t.Fatalf("%s: commit %s, want HEAD %s", uri, co.Commit, v2)
+		}
+		found, err := DiscoverLocal(SubDir(co.Dir, "skills"))
+		if err != nil || len(found) != 2 {
+			t.Fatalf("%s: discovered %+v, %v", uri, found, err)
+		}
+	}
+
+	// Refs: a tag, then a commit SHA, reusing the same cached checkout.
+	co, err := SyncGit(ctx, bare, "v1", cache)
+	if err != nil || co.Commit != v1 {
+		t.Fatalf("tag v1: %+v, %v", co, err)
+	}
+	if found, _ := DiscoverLocal(SubDir(co.Dir, "skills")); len(found) != 1 {
+		t.Fatalf("v1 should only have dns: %+v", found)
+	}
+	if co, err = SyncGit(ctx, bare, v2, cache); err != nil || co.Commit != v2 {
+		t.Fatalf("sha: %+v, %v", co, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(co.Dir, "skills", "dns", "SKILL.md")); string(b) != "# DNS v2\n" {
+		t.Fatalf("content at v2: %q", b)
+	}
+
+	if _, err := SyncGit(ctx, bare, "no-such-branch", cache); err == nil {
+		t.Fatal("unknown ref accepted")
+	}
+	if _, err := SyncGit(ctx, bare, "--upload-pack=evil", cache); err == nil {
+		t.Fatal("option-like ref accepted")
+	}
+	if _, err := SyncGit(ctx, "--upload-pack=touch "+filepath.Join(cache, "pwned"), "", t.TempDir()); err == nil {
+		t.Fatal("option-like uri accepted")
+	}
+	if _, err := os.Stat(filepath.Join(cache, "pwned")); err == nil {
+		t.Fatal("option-like uri was run")
+	}
+}
+
+func TestGitSkillsIgnoreSymlinks(t *testing.T) {
+	bare, work, commit := gitRepo(t)
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "credentials")
+	if err := os.WriteFile(secret, []byte("aws_secret_access_key=x\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(outside, "stolen"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "stolen", "SKILL.md"), []byte("# host file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"skills/evil", "skills"} {
+		if err := os.MkdirAll(filepath.Join(work, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"skills/evil/SKILL.md": secret,
+		"skills/linked":        filepath.Join(outside, "stolen"),
+		"escape":               outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(work, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit(map[string]string{"skills/dns/SKILL.md": "# DNS\n"}, "")
+
+	co, err := SyncGit(context.Background(), bare, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := co.Skills("skills")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "dns" || found[0].Content != "# DNS\n" {
+		t.Fatalf("skills: %+v", found)
+	}
+	if _, err := co.Skills("escape"); err == nil || !strings.Contains(err.Error(), "outside the checkout") {
+		t.Fatalf("symlinked base path: %v", err)
+	}
+}
+
+// TestGitSyncDropsDeletedSkills mirrors `skills sync` for a git source:
+// cache every skill of the checkout, then prune the source's other docs.
+func TestGitSyncDropsDeletedSkills(t *testing.T) {
+	bare, work, commit := gitRepo(t)
+	ctx := context.Background()
+	st, err := store.OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcID, err := st.AddSkillSource(ctx, store.SkillSource{Name: "upstream", Type: "git", URI: bare, BasePath: "skills", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := t.TempDir()
+	sync := func() []store.SkillDoc {
+		t.Helper()
+		co, err := SyncGit(ctx, bare, "", cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, err := co.Skills("skills")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keep []string
+		for _, sk := range found {
+			p := path.Join(sk.Name, "SKILL.md")
+			if err := st.UpsertSkillDoc(ctx, store.SkillDoc{SourceID: srcID, Path: p, SHA256: sk.SHA256, Content: sk.Content, Commit: co.Commit}); err != nil {
+				t.Fatal(err)
+			}
+			keep = append(keep, p)
+		}
+		if _, err := st.PruneSkillDocs(ctx, srcID, keep); err != nil {
+			t.Fatal(err)
+		}
+		docs, err := st.ListSkillDocs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return docs
+	}
+
+	commit(map[string]string{"skills/dns/SKILL.md": "# DNS\n", "skills/rollback/SKILL.md": "# Rollback\n"}, "")
+	if docs := sync(); len(docs) != 2 {
+		t.Fatalf("first sync: %+v", docs)
+	}
+
+	// Delete rollback and rename dns upstream.
+	if err := os.RemoveAll(filepath.Join(work, "skills", "rollback")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(work, "skills", "dns"), filepath.Join(work, "skills", "dns-cutover")); err != nil {
+		t.Fatal(err)
+	}
+	head := commit(nil, "")
+	docs := sync()
+	if len(docs) != 1 || docs[0].Path != "dns-cutover/SKILL.md" || docs[0].Commit != head {
+		t.Fatalf("second sync: %+v", docs)
+	}
+	res, err := store.ResolveSkills(ctx, st)
+	if err != nil || len(res) != 1 || res[0].Name != "dns-cutover" {
+		t.Fatalf("resolved after delete: %+v %v", res, err)
+	}
+}
+
+func TestSubDirStaysInside(t *testing.T) {
+	for base, want := range map[string]string{
+		"":              "/cache/repo",
+		"skills":        "/cache/repo/skills",
+		"../../etc":     "/cache/repo/etc",
+		"/abs/../skill": "/cache/repo/skill",
+	} {
+		if got := SubDir("/cache/repo", base); got != want {
+			t.Errorf("SubDir(%q) = %q, want %q", base, got, want)
+		}
+	}
+}
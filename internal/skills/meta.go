@@ -0,0 +1,132 @@
+package skills
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Meta is the YAML frontmatter of a SKILL.md:
+//
+//	---
+//	name: dns-cutover
+//	description: Move a zone between DNS providers without downtime.
+//	version: 1.2.0
+//	tags: [dns, migration]
+//	applies_to:
+//	  phases: [plan, apply]
+//	  tools: [dns.plan, dns.apply]
+//	---
+//
+// tags, phases and tools also accept a single string. Unknown keys are
+// ignored.
+type Meta struct {
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	AppliesTo   AppliesTo `json:"applies_to"`
+}
+
+// AppliesTo scopes a skill to stackflow phases and MCP tools.
+type AppliesTo struct {
+	Phases []string `json:"phases,omitempty"`
+	Tools  []string `json:"tools,omitempty"`
+}
+
+// ParseMeta parses the frontmatter at the start of a SKILL.md. A document
+// without frontmatter has an empty Meta.
+func ParseMeta(content string) (Meta, error) {
+	fm, ok := frontmatter(content)
+	if !ok {
+		return Meta{}, nil
+	}
+	var raw struct {
+		Name        string     `yaml:"name"`
+		Description string     `yaml:"description"`
+		Version     string     `yaml:"version"`
+		Tags        stringList `yaml:"tags"`
+		AppliesTo   struct {
+			Phases stringList `yaml:"phases"`
+			Tools  stringList `yaml:"tools"`
+		} `yaml:"applies_to"`
+	}
+	if err := yaml.Unmarshal([]byte(fm), &raw); err != nil {
+		return Meta{}, fmt.Errorf("frontmatter: %w", err)
+	}
+	return Meta{
+		Name:        strings.TrimSpace(raw.Name),
+		Description: strings.TrimSpace(raw.Description),
+		Version:     strings.TrimSpace(raw.Version),
+		Tags:        raw.Tags,
+		AppliesTo:   AppliesTo{Phases: raw.AppliesTo.Phases, Tools: raw.AppliesTo.Tools},
+	}, nil
+}
+
+// frontmatter returns the text between a leading "---" line and the next
+// "---" (or "...") line.
+func frontmatter(content string) (string, bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	first, rest, ok := strings.Cut(content, "\n")
+	if !ok || strings.TrimSpace(first) != "---" {
+		return "", false
+	}
+	var b strings.Builder
+	for _, l := range strings.SplitAfter(rest, "\n") {
+		if t := strings.TrimSpace(l); t == "---" || t == "..." {
+			return b.String(), true
+		}
+		b.WriteString(l)
+	}
+	return "", false
+}
+
+// HasTag reports whether the skill is tagged tag (case-insensitive).
+func (m Meta) HasTag(tag string) bool { return containsFold(m.Tags, tag) }
+
+// AppliesToPhase reports whether the skill lists phase under
+// applies_to.phases (case-insensitive). Skills that list no phases are not
+// phase-specific and never match.
+func (m Meta) AppliesToPhase(phase string) bool { return containsFold(m.AppliesTo.Phases, phase) }
+
+// Matches reports whether the skill passes the tag and phase filters; an
+// empty filter matches everything.
+func (m Meta) Matches(tag, phase string) bool {
+	return (tag == "" || m.HasTag(tag)) && (phase == "" || m.AppliesToPhase(phase))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList decodes a YAML sequence of strings or a single string.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(n *yaml.Node) error {
+	var vals []string
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag != "!!null" && strings.TrimSpace(n.Value) != "" {
+			vals = []string{n.Value}
+		}
+	case yaml.SequenceNode:
+		if err := n.Decode(&vals); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("line %d: want a string or a list of strings", n.Line)
+	}
+	*l = nil
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
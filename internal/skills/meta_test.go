@@ -0,0 +1,51 @@
+package skills
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMeta(t *testing.T) {
+	m, err := ParseMeta(`---
+name: dns-cutover
+description: Move a zone between providers.
+version: 1.2
+tags: [dns, Migration]
+applies_to:
+  phases: plan
+  tools:
+    - dns.plan
+    - dns.apply
+owner: team-a
+---
+# DNS cutover
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Meta{
+		Name:        "dns-cutover",
+		Description: "Move a zone between providers.",
+		Version:     "1.2",
+		Tags:        []string{"dns", "Migration"},
+		AppliesTo:   AppliesTo{Phases: []string{"plan"}, Tools: []string{"dns.plan", "dns.apply"}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("got %+v\nwant %+v", m, want)
+	}
+	if !m.Matches("migration", "PLAN") || m.Matches("dns", "apply") || !m.Matches("", "") {
+		t.Fatal("Matches")
+	}
+	if (Meta{}).Matches("", "plan") {
+		t.Fatal("a skill without phases must not match a phase filter")
+	}
+
+	for _, doc := range []string{"# No frontmatter\n", "---\nname: x\n(unterminated)\n", ""} {
+		if m, err := ParseMeta(doc); err != nil || !reflect.DeepEqual(m, Meta{}) {
+			t.Errorf("%q: %+v, %v", doc, m, err)
+		}
+	}
+	if _, err := ParseMeta("---\ntags: {a: b}\n---\n"); err == nil {
+		t.Error("map tags accepted")
+	}
+}
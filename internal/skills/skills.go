@@ -12,11 +12,14 @@ import (
 	"time"
 )
 
+// Skill is one SKILL.md. Meta is its parsed frontmatter; it is left empty
+// when the frontmatter is invalid (ParseMeta reports why).
 type Skill struct {
 	Name    string `json:"name"`
 	Path    string `json:"path"`
 	Content string `json:"content,omitempty"`
 	SHA256  string `json:"sha256,omitempty"`
+	Meta    Meta   `json:"meta"`
 }
 
 // DiscoverLocal finds skills under <dir>/*/SKILL.md.
@@ -35,10 +38,12 @@ func DiscoverLocal(dir string) ([]Skill, error) {
 		if err != nil {
 			continue
 		}
+		meta, _ := ParseMeta(string(b))
 		out = append(out, Skill{
 			Name:   e.Name(),
 			Path:   p,
 			SHA256: shaHex(b),
+			Meta:   meta,
 		})
 	}
 	return out, nil
@@ -50,15 +55,19 @@ func ReadSkill(path string) (Skill, error) {
 	if err != nil {
 		return Skill{}, err
 	}
+	meta, _ := ParseMeta(string(b))
 	return Skill{
 		Name:    filepath.Base(filepath.Dir(path)),
 		Path:    path,
 		Content: string(b),
 		SHA256:  shaHex(b),
+		Meta:    meta,
 	}, nil
 }
 
-// FetchHTTP downloads a SKILL.md (or skills bundle) over HTTP.
+// FetchHTTP downloads a single SKILL.md over HTTP (see FetchBundle for
+// archives). The skill is named after the URL's parent directory when the
+// file is called SKILL.md, else after the file.
 // This is meant for published read-only skills (no secrets).
 func FetchHTTP(url string, timeout time.Duration) (Skill, error) {
 	if timeout <= 0 {
@@ -80,12 +89,18 @@ func FetchHTTP(url string, timeout time.Duration) (Skill, error) {
 	name := url
 	if strings.Contains(url, "/") {
 		name = url[strings.LastIndex(url, "/")+1:]
+		if name == "SKILL.md" {
+			dir := strings.TrimSuffix(url, "/SKILL.md")
+			name = dir[strings.LastIndex(dir, "/")+1:]
+		}
 	}
+	meta, _ := ParseMeta(string(b))
 	return Skill{
 		Name:    name,
 		Path:    url,
 		Content: string(b),
 		SHA256:  shaHex(b),
+		Meta:    meta,
 	}, nil
 }
 
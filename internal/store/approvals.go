@@ -0,0 +1,310 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Approval statuses. pending is decided once; approved may later be
+// rejected, which revokes it.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+var (
+	// ErrNotApproved is returned by CheckApproval when no approved,
+	// unexpired approval matches the plan.
+	ErrNotApproved = errors.New("plan not approved")
+	// ErrInvalidDecision is returned when an approval cannot take the
+	// decision (already decided, self-approval, missing actor).
+	ErrInvalidDecision = errors.New("invalid approval decision")
+)
+
+// PlanHash is the content hash approvals are bound to: sha256 over the
+// canonical JSON encoding of plan (object keys sorted, no insignificant
+// whitespace), so re-serialising a plan does not change its hash.
+func PlanHash(plan []byte) (string, error) {
+	canon, err := canonicalJSON(plan)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canon)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func canonicalJSON(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("plan is not valid JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("plan is not valid JSON: trailing data")
+	}
+	return json.Marshal(v)
+}
+
+// CheckApproval returns the approval that allows applying plan to
+// stack/env, or an error wrapping ErrNotApproved. stack and env must match
+// the approval exactly; an empty env never matches, since ListApprovals
+// treats an empty filter field as a wildcard.
+func CheckApproval(ctx context.Context, st Store, stack, env string, plan []byte) (Approval, error) {
+	if stack == "" || env == "" {
+		return Approval{}, fmt.Errorf("%w: stack and env are required", ErrNotApproved)
+	}
+	hash, err := PlanHash(plan)
+	if err != nil {
+		return Approval{}, err
+	}
+	approvals, err := st.ListApprovals(ctx, ApprovalFilter{Stack: stack, Env: env, Status: ApprovalApproved, PlanHash: hash})
+	if err != nil {
+		return Approval{}, err
+	}
+	now := time.Now()
+	var expired *Approval
+	for i, a := range approvals {
+		if a.Stack != stack || a.Env != env || a.PlanHash != hash {
+			continue
+		}
+		if a.ExpiresAt == nil || now.Before(*a.ExpiresAt) {
+			return a, nil
+		}
+		if expired == nil {
+			expired = &approvals[i]
+		}
+	}
+	if expired != nil {
+		return Approval{}, fmt.Errorf("%w: approval %s of %s expired at %s", ErrNotApproved,
+			expired.ApprovalID, hash, expired.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return Approval{}, fmt.Errorf("%w: no approval of %s for %s/%s", ErrNotApproved, hash, stack, env)
+}
+
+// prepareApproval validates a new approval request and fills its hash.
+func prepareApproval(a Approval) (Approval, error) {
+	if a.Stack == "" || a.Env == "" {
+		return a, fmt.Errorf("approval: stack and env are required")
+	}
+	if len(bytes.TrimSpace(a.PlanJSON)) == 0 {
+		return a, fmt.Errorf("approval: plan is required")
+	}
+	canon, err := canonicalJSON(a.PlanJSON)
+	if err != nil {
+		return a, err
+	}
+	hash, err := PlanHash(canon)
+	if err != nil {
+		return a, err
+	}
+	if a.PlanHash != "" && a.PlanHash != hash {
+		return a, fmt.Errorf("approval: plan hash %s does not match plan (%s)", a.PlanHash, hash)
+	}
+	a.PlanJSON, a.PlanHash = canon, hash
+	if a.ApprovalID == "" {
+		a.ApprovalID = uuid.NewString()
+	}
+	a.Status = ApprovalPending
+	a.RequestedAt = time.Now().UTC()
+	a.DecidedBy, a.DecidedAt, a.Reason, a.ExpiresAt = "", nil, "", nil
+	return a, nil
+}
+
+// checkDecision returns ErrInvalidDecision unless d may be applied to a.
+func checkDecision(a Approval, d ApprovalDecision) error {
+	if d.Actor == "" {
+		return fmt.Errorf("%w: an approver is required", ErrInvalidDecision)
+	}
+	switch {
+	case a.Status == ApprovalPending && (d.Status == ApprovalApproved || d.Status == ApprovalRejected):
+	case a.Status == ApprovalApproved && d.Status == ApprovalRejected:
+	default:
+		return fmt.Errorf("%w: approval %s is %s, cannot become %s", ErrInvalidDecision, a.ApprovalID, a.Status, d.Status)
+	}
+	if d.Status == ApprovalApproved {
+		if a.RequestedBy != "" && a.RequestedBy == d.Actor {
+			return fmt.Errorf("%w: %s cannot approve their own request", ErrInvalidDecision, d.Actor)
+		}
+		if d.ExpiresAt != nil && !d.ExpiresAt.After(time.Now()) {
+			return fmt.Errorf("%w: expiry %s is in the past", ErrInvalidDecision, d.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func applyDecision(a Approval, d ApprovalDecision) Approval {
+	now := time.Now().UTC()
+	a.Status, a.DecidedBy, a.DecidedAt, a.Reason = d.Status, d.Actor, &now, d.Reason
+	if d.Status == ApprovalApproved {
+		a.ExpiresAt = d.ExpiresAt
+	}
+	return a
+}
+
+const approvalColumns = `approval_id::text, stack, env, plan_hash, plan, COALESCE(run_id::text,''), status,
+		COALESCE(requested_by,''), requested_at, COALESCE(decided_by,''), decided_at, COALESCE(reason,''), expires_at`
+
+func scanApproval(row pgx.Row) (Approval, error) {
+	var a Approval
+	err := row.Scan(&a.ApprovalID, &a.Stack, &a.Env, &a.PlanHash, &a.PlanJSON, &a.RunID, &a.Status,
+		&a.RequestedBy, &a.RequestedAt, &a.DecidedBy, &a.DecidedAt, &a.Reason, &a.ExpiresAt)
+	return a, err
+}
+
+func (s *Postgres) RequestApproval(ctx context.Context, a Approval) (Approval, error) {
+	a, err := prepareApproval(a)
+	if err != nil {
+		return Approval{}, err
+	}
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO xcf.approvals (approval_id, stack, env, plan_hash, plan, run_id, status, requested_by, requested_at)
+		VALUES ($1,$2,$3,$4,$5::jsonb,$6,$7,$8,$9)
+	`, a.ApprovalID, a.Stack, a.Env, a.PlanHash, string(a.PlanJSON), nullIfEmpty(a.RunID), a.Status,
+		nullIfEmpty(a.RequestedBy), a.RequestedAt)
+	if err != nil {
+		return Approval{}, err
+	}
+	return a, nil
+}
+
+// DecideApproval locks the approval row, checks the decision and applies it.
+func (s *Postgres) DecideApproval(ctx context.Context, approvalID string, d ApprovalDecision) (Approval, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return Approval{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := scanApproval(tx.QueryRow(ctx, `SELECT `+approvalColumns+` FROM xcf.approvals WHERE approval_id=$1 FOR UPDATE`, approvalID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Approval{}, fmt.Errorf("approval %s: %w", approvalID, ErrNotFound)
+	}
+	if err != nil {
+		return Approval{}, err
+	}
+	if err := checkDecision(a, d); err != nil {
+		return Approval{}, err
+	}
+	a = applyDecision(a, d)
+	if _, err := tx.Exec(ctx, `
+		UPDATE xcf.approvals
+		SET status=$2, decided_by=$3, decided_at=$4, reason=$5, expires_at=$6
+		WHERE approval_id=$1
+	`, approvalID, a.Status, a.DecidedBy, a.DecidedAt, nullIfEmpty(a.Reason), a.ExpiresAt); err != nil {
+		return Approval{}, err
+	}
+	return a, tx.Commit(ctx)
+}
+
+func (s *Postgres) GetApproval(ctx context.Context, approvalID string) (Approval, error) {
+	a, err := scanApproval(s.pool.QueryRow(ctx, `SELECT `+approvalColumns+` FROM xcf.approvals WHERE approval_id=$1`, approvalID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Approval{}, fmt.Errorf("approval %s: %w", approvalID, ErrNotFound)
+	}
+	return a, err
+}
+
+// ListApprovals returns approvals newest first (default limit 50).
+func (s *Postgres) ListApprovals(ctx context.Context, f ApprovalFilter) ([]Approval, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+approvalColumns+`
+		FROM xcf.approvals
+		WHERE ($1='' OR stack=$1) AND ($2='' OR env=$2) AND ($3='' OR status=$3) AND ($4='' OR plan_hash=$4)
+		ORDER BY requested_at DESC
+		LIMIT $5
+	`, f.Stack, f.Env, f.Status, f.PlanHash, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Approval
+	for rows.Next() {
+		a, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (f *File) RequestApproval(ctx context.Context, a Approval) (Approval, error) {
+	a, err := prepareApproval(a)
+	if err != nil {
+		return Approval{}, err
+	}
+	f.lock()
+	defer f.mu.Unlock()
+	f.data.Approvals[a.ApprovalID] = a
+	if err := f.flush(); err != nil {
+		return Approval{}, err
+	}
+	return a, nil
+}
+
+func (f *File) DecideApproval(ctx context.Context, approvalID string, d ApprovalDecision) (Approval, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	a, ok := f.data.Approvals[approvalID]
+	if !ok {
+		return Approval{}, fmt.Errorf("approval %s: %w", approvalID, ErrNotFound)
+	}
+	if err := checkDecision(a, d); err != nil {
+		return Approval{}, err
+	}
+	a = applyDecision(a, d)
+	f.data.Approvals[approvalID] = a
+	if err := f.flush(); err != nil {
+		return Approval{}, err
+	}
+	return a, nil
+}
+
+func (f *File) GetApproval(ctx context.Context, approvalID string) (Approval, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	a, ok := f.data.Approvals[approvalID]
+	if !ok {
+		return Approval{}, fmt.Errorf("approval %s: %w", approvalID, ErrNotFound)
+	}
+	return a, nil
+}
+
+func (f *File) ListApprovals(ctx context.Context, filter ApprovalFilter) ([]Approval, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	var out []Approval
+	for _, a := range f.data.Approvals {
+		if (filter.Stack != "" && a.Stack != filter.Stack) ||
+			(filter.Env != "" && a.Env != filter.Env) ||
+			(filter.Status != "" && a.Status != filter.Status) ||
+			(filter.PlanHash != "" && a.PlanHash != filter.PlanHash) {
+			continue
+		}
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RequestedAt.After(out[j].RequestedAt) })
+	if len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (s *Postgres) AddRunArtifact(ctx context.Context, a RunArtifact) (string, error) {
+	if a.ArtifactID == "" {
+		a.ArtifactID = uuid.NewString()
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO xcf.run_artifacts (artifact_id, run_id, kind, uri, checksum, metadata)
+		VALUES ($1,$2,$3,$4,$5,$6::jsonb)
+	`, a.ArtifactID, a.RunID, a.Kind, a.URI, nullIfEmpty(a.Checksum), jsonOrEmpty(a.MetadataJSON))
+	if err != nil {
+		return "", err
+	}
+	return a.ArtifactID, nil
+}
+
+// ListRunArtifacts returns the artifacts of runID, oldest first.
+func (s *Postgres) ListRunArtifacts(ctx context.Context, runID string) ([]RunArtifact, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT artifact_id, run_id, kind, uri, COALESCE(checksum,''), created_at, metadata
+		FROM xcf.run_artifacts
+		WHERE run_id=$1
+		ORDER BY created_at, artifact_id
+	`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []RunArtifact
+	for rows.Next() {
+		var a RunArtifact
+		if err := rows.Scan(&a.ArtifactID, &a.RunID, &a.Kind, &a.URI, &a.Checksum, &a.CreatedAt, &a.MetadataJSON); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (f *File) AddRunArtifact(ctx context.Context, a RunArtifact) (string, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	if _, ok := f.data.Runs[a.RunID]; !ok {
+		return "", fmt.Errorf("run %s: %w", a.RunID, ErrNotFound)
+	}
+	if a.ArtifactID == "" {
+		a.ArtifactID = uuid.NewString()
+	}
+	a.CreatedAt = time.Now().UTC()
+	a.MetadataJSON = json.RawMessage(jsonOrEmpty(a.MetadataJSON))
+	f.data.RunArtifacts[a.ArtifactID] = a
+	if err := f.flush(); err != nil {
+		return "", err
+	}
+	return a.ArtifactID, nil
+}
+
+func (f *File) ListRunArtifacts(ctx context.Context, runID string) ([]RunArtifact, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	var out []RunArtifact
+	for _, a := range f.data.RunArtifacts {
+		if a.RunID == runID {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ArtifactID < out[j].ArtifactID
+	})
+	return out, nil
+}
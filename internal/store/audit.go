@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (s *Postgres) RecordAudit(ctx context.Context, e AuditEvent) error {
+	if e.AuditID == "" {
+		e.AuditID = uuid.NewString()
+	}
+	if e.TS.IsZero() {
+		e.TS = time.Now()
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO xcf.mcp_audit (audit_id, ts, actor, session_id, tool, arguments, duration_ms, outcome, error)
+		VALUES ($1,$2,$3,$4,$5,$6::jsonb,$7,$8,$9)
+	`, e.AuditID, e.TS, nullIfEmpty(e.Actor), nullIfEmpty(e.SessionID), e.Tool, jsonOrEmpty(e.ArgumentsJSON),
+		e.DurationMS, e.Outcome, nullIfEmpty(e.Error))
+	return err
+}
+
+// ListAudit returns audit events newest first (default limit 50).
+func (s *Postgres) ListAudit(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT audit_id, ts, COALESCE(actor,''), COALESCE(session_id,''), tool, arguments,
+		       duration_ms, outcome, COALESCE(error,'')
+		FROM xcf.mcp_audit
+		WHERE ($1='' OR actor=$1) AND ($2='' OR tool=$2) AND ($3='' OR outcome=$3)
+		  AND ($4::timestamptz IS NULL OR ts >= $4)
+		ORDER BY ts DESC
+		LIMIT $5
+	`, f.Actor, f.Tool, f.Outcome, nullIfZeroTime(f.Since), f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.AuditID, &e.TS, &e.Actor, &e.SessionID, &e.Tool, &e.ArgumentsJSON,
+			&e.DurationMS, &e.Outcome, &e.Error); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func nullIfZeroTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func (f *File) RecordAudit(ctx context.Context, e AuditEvent) error {
+	f.lock()
+	defer f.mu.Unlock()
+	if e.AuditID == "" {
+		e.AuditID = uuid.NewString()
+	}
+	if e.TS.IsZero() {
+		e.TS = time.Now()
+	}
+	e.TS = e.TS.UTC()
+	e.ArgumentsJSON = json.RawMessage(jsonOrEmpty(e.ArgumentsJSON))
+	f.data.Audit = append(f.data.Audit, e)
+	return f.flush()
+}
+
+func (f *File) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	var out []AuditEvent
+	for _, e := range f.data.Audit {
+		if (filter.Actor != "" && e.Actor != filter.Actor) ||
+			(filter.Tool != "" && e.Tool != filter.Tool) ||
+			(filter.Outcome != "" && e.Outcome != filter.Outcome) ||
+			(!filter.Since.IsZero() && e.TS.Before(filter.Since)) {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].TS.After(out[j].TS) })
+	if len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,667 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// File is an embedded Store backed by a single JSON document.
+//
+// Every mutation rewrites the file atomically (write temp + rename). Before
+// each operation the file is re-read if it was replaced since this process
+// last loaded or wrote it, so readers in other processes (e.g.
+// `runs watch`) observe new state. Writers are not coordinated across
+// processes: concurrent writes from two processes can lose updates, so use
+// Postgres when several agents share state.
+type File struct {
+	mu   sync.Mutex
+	path string
+	data fileData
+	// stat of the file as last loaded or written; nil if it did not exist.
+	stat os.FileInfo
+}
+
+type fileData struct {
+	Runs          map[string]Run            `json:"runs"`
+	RunArtifacts  map[string]RunArtifact    `json:"run_artifacts"`
+	MCPServers    map[string]MCPServer      `json:"mcp_servers"`
+	MCPToolsCache map[string]fileToolsCache `json:"mcp_tools_cache"`
+	SkillSources  map[string]SkillSource    `json:"skill_sources"`
+	SkillDocs     map[string]fileSkillDoc   `json:"skill_docs"`
+	KV            map[string]map[string]KV  `json:"kv"`
+	Audit         []AuditEvent              `json:"mcp_audit"`
+	Approvals     map[string]Approval       `json:"approvals"`
+	SkillPins     map[string]SkillPin       `json:"skill_pins"`
+}
+
+type fileToolsCache struct {
+	Tools     json.RawMessage `json:"tools"`
+	ETag      string          `json:"etag,omitempty"`
+	FetchedAt time.Time       `json:"fetched_at"`
+}
+
+type fileSkillDoc struct {
+	SourceID  string          `json:"source_id"`
+	Path      string          `json:"path"`
+	SHA256    string          `json:"sha256"`
+	Content   string          `json:"content"`
+	Commit    string          `json:"commit,omitempty"`
+	Meta      json.RawMessage `json:"meta,omitempty"`
+	FetchedAt time.Time       `json:"fetched_at"`
+}
+
+var (
+	_ Store = (*File)(nil)
+	_ Store = (*Postgres)(nil)
+)
+
+// OpenFile loads (or creates on first write) the JSON state file at path.
+func OpenFile(path string) (*File, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file store: empty path")
+	}
+	f := &File{path: path}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// load replaces f.data with the file's contents. Caller must hold f.mu
+// (or own f exclusively).
+func (f *File) load() error {
+	fi, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.data = fileData{}
+		f.data.init()
+		f.stat = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("file store: %w", err)
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("file store: %w", err)
+	}
+	var d fileData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return fmt.Errorf("file store: parse %s: %w", f.path, err)
+	}
+	d.init()
+	f.data = d
+	f.stat = fi
+	return nil
+}
+
+// lock takes f.mu and reloads the file if another process replaced it. A
+// failed reload keeps the last good snapshot.
+func (f *File) lock() {
+	f.mu.Lock()
+	fi, err := os.Stat(f.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if f.stat == nil {
+			return
+		}
+	case err != nil:
+		return
+	case f.stat != nil && sameFileVersion(f.stat, fi):
+		return
+	}
+	if err := f.load(); err != nil {
+		fmt.Fprintln(os.Stderr, "store: reload:", err)
+	}
+}
+
+// sameFileVersion reports whether b is the file a was taken from, unmodified.
+// flush always renames a new file into place, so the identity check catches
+// rewrites that land within the filesystem's mtime granularity.
+func sameFileVersion(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+func (d *fileData) init() {
+	if d.Runs == nil {
+		d.Runs = map[string]Run{}
+	}
+	if d.RunArtifacts == nil {
+		d.RunArtifacts = map[string]RunArtifact{}
+	}
+	if d.MCPServers == nil {
+		d.MCPServers = map[string]MCPServer{}
+	}
+	if d.MCPToolsCache == nil {
+		d.MCPToolsCache = map[string]fileToolsCache{}
+	}
+	if d.SkillSources == nil {
+		d.SkillSources = map[string]SkillSource{}
+	}
+	if d.SkillDocs == nil {
+		d.SkillDocs = map[string]fileSkillDoc{}
+	}
+	if d.KV == nil {
+		d.KV = map[string]map[string]KV{}
+	}
+	if d.Approvals == nil {
+		d.Approvals = map[string]Approval{}
+	}
+	if d.SkillPins == nil {
+		d.SkillPins = map[string]SkillPin{}
+	}
+}
+
+func (f *File) Close() {}
+
+// flush persists f.data. Caller must hold f.mu.
+func (f *File) flush() error {
+	b, err := json.Marshal(&f.data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".xcf-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if fi, err := os.Stat(f.path); err == nil {
+		f.stat = fi
+	}
+	return nil
+}
+
+func (f *File) CreateRun(ctx context.Context, r Run) (string, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	if r.RunID == "" {
+		r.RunID = uuid.NewString()
+	}
+	if _, ok := f.data.Runs[r.RunID]; ok {
+		return "", fmt.Errorf("run %s already exists", r.RunID)
+	}
+	if r.Status == "" {
+		r.Status = RunQueued
+	}
+	if err := checkInitialRunStatus(r.Status); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	r.StartedAt = now
+	r.FinishedAt = nil
+	r.HeartbeatAt = nil
+	if r.Status == RunRunning {
+		r.HeartbeatAt = &now
+	}
+	r.InputsJSON = json.RawMessage(jsonOrEmpty(r.InputsJSON))
+	r.PlanJSON = json.RawMessage(jsonOrEmpty(r.PlanJSON))
+	r.ResultJSON = json.RawMessage(jsonOrEmpty(r.ResultJSON))
+	f.data.Runs[r.RunID] = r
+	if err := f.flush(); err != nil {
+		return "", err
+	}
+	return r.RunID, nil
+}
+
+func (f *File) StartRun(ctx context.Context, runID string) error {
+	f.lock()
+	defer f.mu.Unlock()
+	r, err := f.transitionRunLocked(runID, RunRunning)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	r.HeartbeatAt = &now
+	f.data.Runs[runID] = r
+	return f.flush()
+}
+
+func (f *File) FinishRun(ctx context.Context, runID string, status string, resultJSON []byte) error {
+	if !IsTerminalRunStatus(status) {
+		return fmt.Errorf("%w: %q is not a final status", ErrInvalidTransition, status)
+	}
+	f.lock()
+	defer f.mu.Unlock()
+	r, err := f.transitionRunLocked(runID, status)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	r.FinishedAt = &now
+	r.ResultJSON = json.RawMessage(jsonOrEmpty(resultJSON))
+	f.data.Runs[runID] = r
+	return f.flush()
+}
+
+func (f *File) transitionRunLocked(runID, to string) (Run, error) {
+	r, ok := f.data.Runs[runID]
+	if !ok {
+		return Run{}, fmt.Errorf("run %s: %w", runID, ErrNotFound)
+	}
+	if err := CheckRunTransition(r.Status, to); err != nil {
+		return Run{}, fmt.Errorf("run %s: %w", runID, err)
+	}
+	r.Status = to
+	return r, nil
+}
+
+func (f *File) Heartbeat(ctx context.Context, runID string) error {
+	f.lock()
+	defer f.mu.Unlock()
+	r, ok := f.data.Runs[runID]
+	if !ok {
+		return fmt.Errorf("run %s: %w", runID, ErrNotFound)
+	}
+	if r.Status != RunRunning {
+		return fmt.Errorf("run %s is %s: %w", runID, r.Status, ErrInvalidTransition)
+	}
+	now := time.Now().UTC()
+	r.HeartbeatAt = &now
+	f.data.Runs[runID] = r
+	return f.flush()
+}
+
+func (f *File) ReapStaleRuns(ctx context.Context, staleAfter time.Duration) ([]string, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	now := time.Now().UTC()
+	var out []string
+	for id, r := range f.data.Runs {
+		if r.Status != RunRunning {
+			continue
+		}
+		last := r.StartedAt
+		if r.HeartbeatAt != nil {
+			last = *r.HeartbeatAt
+		}
+		if now.Sub(last) <= staleAfter {
+			continue
+		}
+		r.Status = RunTimedOut
+		r.FinishedAt = &now
+		r.ResultJSON = mergeJSONObject(r.ResultJSON, map[string]any{"error": "heartbeat expired"})
+		f.data.Runs[id] = r
+		out = append(out, id)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	sort.Strings(out)
+	return out, f.flush()
+}
+
+// mergeJSONObject mirrors jsonb `||` for the file backend.
+func mergeJSONObject(doc json.RawMessage, extra map[string]any) json.RawMessage {
+	m := map[string]any{}
+	_ = json.Unmarshal(doc, &m)
+	for k, v := range extra {
+		m[k] = v
+	}
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func (f *File) GetRun(ctx context.Context, runID string) (Run, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	r, ok := f.data.Runs[runID]
+	if !ok {
+		return Run{}, fmt.Errorf("run %s: %w", runID, ErrNotFound)
+	}
+	return r, nil
+}
+
+func (f *File) ListRuns(ctx context.Context, filter RunFilter) ([]Run, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	var out []Run
+	for _, r := range f.data.Runs {
+		if (filter.Stack != "" && r.Stack != filter.Stack) ||
+			(filter.Env != "" && r.Env != filter.Env) ||
+			(filter.Phase != "" && r.Phase != filter.Phase) ||
+			(filter.Status != "" && r.Status != filter.Status) {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.After(out[j].StartedAt) })
+	if len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out, nil
+}
+
+func (f *File) UpsertMCPServer(ctx context.Context, srv MCPServer) (string, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	if srv.Kind == "" {
+		srv.Kind = "generic"
+	}
+	if srv.AuthType == "" {
+		srv.AuthType = "none"
+	}
+	now := time.Now().UTC()
+	srv.CreatedAt, srv.UpdatedAt = now, now
+	srv.Health, srv.LastError, srv.LastSeenAt, srv.LastCheckedAt = MCPHealthUnknown, "", nil, nil
+	for id, cur := range f.data.MCPServers {
+		if cur.Name == srv.Name {
+			srv.ServerID = id
+			srv.CreatedAt = cur.CreatedAt
+			srv.Health, srv.LastError, srv.LastSeenAt, srv.LastCheckedAt = cur.Health, cur.LastError, cur.LastSeenAt, cur.LastCheckedAt
+			break
+		}
+	}
+	if srv.ServerID == "" {
+		srv.ServerID = uuid.NewString()
+	}
+	f.data.MCPServers[srv.ServerID] = srv
+	if err := f.flush(); err != nil {
+		return "", err
+	}
+	return srv.ServerID, nil
+}
+
+func (f *File) ListMCPServers(ctx context.Context) ([]MCPServer, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	out := make([]MCPServer, 0, len(f.data.MCPServers))
+	for _, srv := range f.data.MCPServers {
+		out = append(out, srv)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (f *File) UpdateMCPToolsCache(ctx context.Context, serverID string, toolsJSON []byte, etag string) error {
+	f.lock()
+	defer f.mu.Unlock()
+	if _, ok := f.data.MCPServers[serverID]; !ok {
+		return fmt.Errorf("mcp server %s: %w", serverID, ErrNotFound)
+	}
+	f.data.MCPToolsCache[serverID] = fileToolsCache{
+		Tools:     json.RawMessage(jsonOrArray(toolsJSON)),
+		ETag:      etag,
+		FetchedAt: time.Now().UTC(),
+	}
+	return f.flush()
+}
+
+func (f *File) TouchMCPToolsCache(ctx context.Context, serverID string) error {
+	f.lock()
+	defer f.mu.Unlock()
+	c, ok := f.data.MCPToolsCache[serverID]
+	if !ok {
+		return fmt.Errorf("mcp tools cache %s: %w", serverID, ErrNotFound)
+	}
+	c.FetchedAt = time.Now().UTC()
+	f.data.MCPToolsCache[serverID] = c
+	return f.flush()
+}
+
+func (f *File) ListMCPToolsCache(ctx context.Context) ([]MCPToolsCache, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	out := make([]MCPToolsCache, 0, len(f.data.MCPToolsCache))
+	for id, c := range f.data.MCPToolsCache {
+		out = append(out, MCPToolsCache{ServerID: id, Tools: c.Tools, ETag: c.ETag, FetchedAt: c.FetchedAt})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ServerID < out[j].ServerID })
+	return out, nil
+}
+
+func (f *File) RecordMCPServerHealth(ctx context.Context, serverID string, checkErr error) error {
+	f.lock()
+	defer f.mu.Unlock()
+	srv, ok := f.data.MCPServers[serverID]
+	if !ok {
+		return fmt.Errorf("mcp server %s: %w", serverID, ErrNotFound)
+	}
+	now := time.Now().UTC()
+	srv.LastCheckedAt = &now
+	if checkErr == nil {
+		srv.Health, srv.LastError, srv.LastSeenAt = MCPHealthOK, "", &now
+	} else {
+		srv.Health, srv.LastError = MCPHealthError, checkErr.Error()
+	}
+	f.data.MCPServers[serverID] = srv
+	return f.flush()
+}
+
+func (f *File) AddSkillSource(ctx context.Context, src SkillSource) (string, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	for id, cur := range f.data.SkillSources {
+		if cur.Name == src.Name {
+			src.SourceID = id
+			break
+		}
+	}
+	if src.SourceID == "" {
+		src.SourceID = uuid.NewString()
+	}
+	f.data.SkillSources[src.SourceID] = src
+	if err := f.flush(); err != nil {
+		return "", err
+	}
+	return src.SourceID, nil
+}
+
+func (f *File) ListSkillSources(ctx context.Context) ([]SkillSource, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	out := make([]SkillSource, 0, len(f.data.SkillSources))
+	for _, src := range f.data.SkillSources {
+		out = append(out, src)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// RemoveSkillSource deletes a source with its docs and pins, as the
+// Postgres foreign keys cascade.
+func (f *File) RemoveSkillSource(ctx context.Context, sourceID string) error {
+	f.lock()
+	defer f.mu.Unlock()
+	if _, ok := f.data.SkillSources[sourceID]; !ok {
+		return fmt.Errorf("skill source %s: %w", sourceID, ErrNotFound)
+	}
+	delete(f.data.SkillSources, sourceID)
+	for key, d := range f.data.SkillDocs {
+		if d.SourceID == sourceID {
+			delete(f.data.SkillDocs, key)
+		}
+	}
+	for skill, p := range f.data.SkillPins {
+		if p.SourceID == sourceID {
+			delete(f.data.SkillPins, skill)
+		}
+	}
+	return f.flush()
+}
+
+func (f *File) UpsertSkillDoc(ctx context.Context, d SkillDoc) error {
+	f.lock()
+	defer f.mu.Unlock()
+	if _, ok := f.data.SkillSources[d.SourceID]; !ok {
+		return fmt.Errorf("skill source %s: %w", d.SourceID, ErrNotFound)
+	}
+	f.data.SkillDocs[d.SourceID+":"+d.Path] = fileSkillDoc{
+		SourceID:  d.SourceID,
+		Path:      d.Path,
+		SHA256:    d.SHA256,
+		Content:   d.Content,
+		Commit:    d.Commit,
+		Meta:      d.Meta,
+		FetchedAt: time.Now().UTC(),
+	}
+	return f.flush()
+}
+
+func (f *File) GetKV(ctx context.Context, namespace, key string) (KV, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	kv, ok := f.data.KV[namespace][key]
+	if !ok {
+		return KV{}, ErrNotFound
+	}
+	return kv, nil
+}
+
+func (f *File) ListKV(ctx context.Context, namespace, prefix string) ([]KV, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	var out []KV
+	for k, kv := range f.data.KV[namespace] {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, kv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func (f *File) PutKV(ctx context.Context, namespace, key string, value []byte) (int64, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	cur, ok := f.data.KV[namespace][key]
+	version := int64(1)
+	if ok {
+		version = cur.Version + 1
+	}
+	return f.putKVLocked(namespace, key, value, version)
+}
+
+func (f *File) CompareAndSwapKV(ctx context.Context, namespace, key string, expected int64, value []byte) (int64, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	cur, ok := f.data.KV[namespace][key]
+	switch {
+	case expected == 0 && ok:
+		return 0, ErrVersionConflict
+	case expected != 0 && (!ok || cur.Version != expected):
+		return 0, ErrVersionConflict
+	}
+	return f.putKVLocked(namespace, key, value, expected+1)
+}
+
+func (f *File) putKVLocked(namespace, key string, value []byte, version int64) (int64, error) {
+	if f.data.KV[namespace] == nil {
+		f.data.KV[namespace] = map[string]KV{}
+	}
+	f.data.KV[namespace][key] = KV{
+		Namespace: namespace,
+		Key:       key,
+		Value:     json.RawMessage(jsonOrEmpty(value)),
+		Version:   version,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (f *File) DeleteKV(ctx context.Context, namespace, key string) error {
+	f.lock()
+	defer f.mu.Unlock()
+	if _, ok := f.data.KV[namespace][key]; !ok {
+		return nil
+	}
+	delete(f.data.KV[namespace], key)
+	return f.flush()
+}
+
+func (f *File) Prune(ctx context.Context, p RetentionPolicy) (PruneReport, error) {
+	rep := PruneReport{DryRun: p.DryRun}
+	if err := p.validate(); err != nil {
+		return rep, err
+	}
+	f.lock()
+	defer f.mu.Unlock()
+	cutoff := p.cutoff(time.Now())
+
+	groups := map[string][]Run{}
+	for _, r := range f.data.Runs {
+		k := r.Stack + "\x00" + r.Env
+		groups[k] = append(groups[k], r)
+	}
+	var drop []string
+	for _, runs := range groups {
+		sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+		lastOK := false
+		for i, r := range runs {
+			keepOK := r.Status == RunOK && !lastOK
+			if r.Status == RunOK {
+				lastOK = true
+			}
+			if !IsTerminalRunStatus(r.Status) || keepOK || i < p.KeepLast || !r.StartedAt.Before(cutoff) {
+				continue
+			}
+			drop = append(drop, r.RunID)
+		}
+	}
+	rep.Runs = int64(len(drop))
+
+	var staleCache []string
+	if p.MaxAge > 0 {
+		for id, c := range f.data.MCPToolsCache {
+			if c.FetchedAt.Before(cutoff) {
+				staleCache = append(staleCache, id)
+			}
+		}
+	}
+	rep.ToolsCache = int64(len(staleCache))
+
+	keptAudit := f.data.Audit[:0:0]
+	for _, e := range f.data.Audit {
+		if p.MaxAge > 0 && e.TS.Before(cutoff) {
+			rep.Audit++
+			continue
+		}
+		keptAudit = append(keptAudit, e)
+	}
+
+	if p.DryRun || (len(drop) == 0 && len(staleCache) == 0 && rep.Audit == 0) {
+		return rep, nil
+	}
+	f.data.Audit = keptAudit
+	for _, id := range drop {
+		delete(f.data.Runs, id)
+	}
+	for aid, a := range f.data.RunArtifacts {
+		if _, ok := f.data.Runs[a.RunID]; !ok {
+			delete(f.data.RunArtifacts, aid)
+		}
+	}
+	for _, id := range staleCache {
+		delete(f.data.MCPToolsCache, id)
+	}
+	return rep, f.flush()
+}
@@ -0,0 +1,466 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"xcloudflow/internal/metrics"
+)
+
+func TestFileStoreRunsPersist(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	st, err := Open(ctx, "file://"+path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	runID, err := st.CreateRun(ctx, Run{Stack: "demo", Phase: "validate", Status: "running"})
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := st.FinishRun(ctx, runID, "ok", []byte(`{"ok":true}`)); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+	st.Close()
+
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	r, ok := f.data.Runs[runID]
+	if !ok {
+		t.Fatalf("run %s not persisted", runID)
+	}
+	if r.Status != "ok" || r.FinishedAt == nil || string(r.ResultJSON) != `{"ok":true}` {
+		t.Fatalf("unexpected run: %+v", r)
+	}
+}
+
+func TestFileStoreKVCompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	v, err := st.CompareAndSwapKV(ctx, "cursors", "dns", 0, []byte(`1`))
+	if err != nil || v != 1 {
+		t.Fatalf("create: v=%d err=%v", v, err)
+	}
+	if _, err := st.CompareAndSwapKV(ctx, "cursors", "dns", 0, []byte(`2`)); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected conflict on create-only, got %v", err)
+	}
+	if _, err := st.CompareAndSwapKV(ctx, "cursors", "dns", 5, []byte(`2`)); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected conflict on stale version, got %v", err)
+	}
+	v, err = st.CompareAndSwapKV(ctx, "cursors", "dns", 1, []byte(`2`))
+	if err != nil || v != 2 {
+		t.Fatalf("swap: v=%d err=%v", v, err)
+	}
+
+	kv, err := st.GetKV(ctx, "cursors", "dns")
+	if err != nil || string(kv.Value) != `2` || kv.Version != 2 {
+		t.Fatalf("get: %+v err=%v", kv, err)
+	}
+	if err := st.DeleteKV(ctx, "cursors", "dns"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := st.GetKV(ctx, "cursors", "dns"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestFileStoreRunTransitionsAndReap(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	queued, err := st.CreateRun(ctx, Run{Stack: "demo", Phase: "plan"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := st.Heartbeat(ctx, queued); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("heartbeat on queued run: %v", err)
+	}
+	if err := st.StartRun(ctx, queued); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := st.FinishRun(ctx, queued, RunOK, nil); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if err := st.FinishRun(ctx, queued, RunFailed, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("finishing a finished run should fail, got %v", err)
+	}
+
+	stale, err := st.CreateRun(ctx, Run{Stack: "demo", Phase: "plan", Status: RunRunning})
+	if err != nil {
+		t.Fatalf("create running: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	r := st.data.Runs[stale]
+	r.HeartbeatAt = &old
+	st.data.Runs[stale] = r
+
+	ids, err := st.ReapStaleRuns(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("reap: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != stale {
+		t.Fatalf("reaped %v, want [%s]", ids, stale)
+	}
+	if got := st.data.Runs[stale].Status; got != RunTimedOut {
+		t.Fatalf("status = %s, want %s", got, RunTimedOut)
+	}
+}
+
+func TestFileStorePruneKeepsLastOK(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// Oldest first: ok, failed, failed, running.
+	statuses := []string{RunOK, RunFailed, RunFailed, ""}
+	var ids []string
+	for i, status := range statuses {
+		id, err := st.CreateRun(ctx, Run{Stack: "demo", Phase: "plan", Status: RunRunning})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if status != "" {
+			if err := st.FinishRun(ctx, id, status, nil); err != nil {
+				t.Fatalf("finish: %v", err)
+			}
+		}
+		r := st.data.Runs[id]
+		r.StartedAt = time.Now().Add(-time.Duration(len(statuses)-i) * 48 * time.Hour)
+		st.data.Runs[id] = r
+		ids = append(ids, id)
+	}
+
+	rep, err := st.Prune(ctx, RetentionPolicy{MaxAge: 24 * time.Hour, DryRun: true})
+	if err != nil || rep.Runs != 2 {
+		t.Fatalf("dry run: %+v err=%v", rep, err)
+	}
+	if len(st.data.Runs) != 4 {
+		t.Fatalf("dry run deleted runs")
+	}
+	if _, err := st.Prune(ctx, RetentionPolicy{MaxAge: 24 * time.Hour}); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	for _, id := range []string{ids[0], ids[3]} {
+		if _, ok := st.data.Runs[id]; !ok {
+			t.Fatalf("run %s should be kept", id)
+		}
+	}
+	if len(st.data.Runs) != 2 {
+		t.Fatalf("got %d runs after prune, want 2", len(st.data.Runs))
+	}
+}
+
+func TestFileStoreAuditFilterAndPrune(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	now := time.Now()
+	for _, e := range []AuditEvent{
+		{TS: now.Add(-72 * time.Hour), Actor: "alice", Tool: "stackflow.validate", Outcome: AuditOK},
+		{TS: now.Add(-time.Hour), Actor: "alice", Tool: "stackflow.apply", Outcome: AuditForbidden},
+		{TS: now, Actor: "ci", Tool: "stackflow.apply", Outcome: AuditOK},
+	} {
+		if err := st.RecordAudit(ctx, e); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	got, err := st.ListAudit(ctx, AuditFilter{Tool: "stackflow.apply"})
+	if err != nil || len(got) != 2 || got[0].Actor != "ci" || string(got[0].ArgumentsJSON) != "{}" {
+		t.Fatalf("by tool: %+v err=%v", got, err)
+	}
+	if got, _ := st.ListAudit(ctx, AuditFilter{Actor: "alice", Since: now.Add(-24 * time.Hour)}); len(got) != 1 || got[0].Outcome != AuditForbidden {
+		t.Fatalf("by actor since: %+v", got)
+	}
+
+	rep, err := st.Prune(ctx, RetentionPolicy{MaxAge: 24 * time.Hour})
+	if err != nil || rep.Audit != 1 {
+		t.Fatalf("prune: %+v err=%v", rep, err)
+	}
+	if got, _ := st.ListAudit(ctx, AuditFilter{}); len(got) != 2 {
+		t.Fatalf("after prune: %d events, want 2", len(got))
+	}
+}
+
+func TestFileStoreRunStatsMetrics(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct{ stack, phase, final string }{
+		{"demo", "apply", "ok"},
+		{"demo", "apply", "ok"},
+		{"demo", "apply", "failed"},
+		{"web", "plan", ""},
+	} {
+		id, err := st.CreateRun(ctx, Run{Stack: r.stack, Phase: r.phase, Status: "running"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.final != "" {
+			if err := st.FinishRun(ctx, id, r.final, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	counts, err := st.RunStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RunCount{
+		{Stack: "demo", Phase: "apply", Status: "failed", Count: 1},
+		{Stack: "demo", Phase: "apply", Status: "ok", Count: 2},
+		{Stack: "web", Phase: "plan", Status: "running", Count: 1},
+	}
+	if fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Fatalf("RunStats = %v, want %v", counts, want)
+	}
+
+	reg := metrics.NewRegistry()
+	RegisterMetrics(reg, st)
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `xcf_runs{stack="demo",phase="apply",status="ok"} 2`) ||
+		strings.Contains(body, "xcf_db_pool") {
+		t.Fatalf("metrics:\n%s", body)
+	}
+}
+
+func TestFileStoreApprovals(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := []byte(`{"records": [{"name": "www", "type": "CNAME"}], "zone": "example.com"}`)
+	reordered := []byte(`{"zone":"example.com","records":[{"type":"CNAME","name":"www"}]}`)
+
+	a, err := st.RequestApproval(ctx, Approval{Stack: "demo", Env: "prod", PlanJSON: plan, RequestedBy: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := PlanHash(reordered); a.Status != ApprovalPending || a.PlanHash != h {
+		t.Fatalf("request: %+v (hash of reordered plan %s)", a, h)
+	}
+	if _, err := CheckApproval(ctx, st, "demo", "prod", plan); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("pending plan passed check: %v", err)
+	}
+	if _, err := st.DecideApproval(ctx, a.ApprovalID, ApprovalDecision{Status: ApprovalApproved, Actor: "alice"}); !errors.Is(err, ErrInvalidDecision) {
+		t.Fatalf("self-approval: %v", err)
+	}
+	exp := time.Now().Add(time.Hour)
+	if _, err := st.DecideApproval(ctx, a.ApprovalID, ApprovalDecision{Status: ApprovalApproved, Actor: "bob", ExpiresAt: &exp}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := CheckApproval(ctx, st, "demo", "prod", reordered); err != nil || got.DecidedBy != "bob" {
+		t.Fatalf("approved plan: %+v, %v", got, err)
+	}
+	for name, c := range map[string]struct {
+		env  string
+		plan string
+	}{
+		"other env":     {"dev", string(plan)},
+		"env omitted":   {"", string(plan)},
+		"modified plan": {"prod", `{"records":[],"zone":"example.com"}`},
+	} {
+		if _, err := CheckApproval(ctx, st, "demo", c.env, []byte(c.plan)); !errors.Is(err, ErrNotApproved) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Rejecting an approved plan revokes it; a rejected one stays rejected.
+	if _, err := st.DecideApproval(ctx, a.ApprovalID, ApprovalDecision{Status: ApprovalRejected, Actor: "carol", Reason: "freeze"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckApproval(ctx, st, "demo", "prod", plan); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("revoked plan passed check: %v", err)
+	}
+	if _, err := st.DecideApproval(ctx, a.ApprovalID, ApprovalDecision{Status: ApprovalApproved, Actor: "bob"}); !errors.Is(err, ErrInvalidDecision) {
+		t.Fatalf("re-approve rejected: %v", err)
+	}
+
+	// Expired approvals do not count.
+	b, _ := st.RequestApproval(ctx, Approval{Stack: "demo", Env: "prod", PlanJSON: plan})
+	if _, err := st.DecideApproval(ctx, b.ApprovalID, ApprovalDecision{Status: ApprovalApproved, Actor: "bob", ExpiresAt: &exp}); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	st.data.Approvals[b.ApprovalID] = func(a Approval) Approval { a.ExpiresAt = &past; return a }(st.data.Approvals[b.ApprovalID])
+	if _, err := CheckApproval(ctx, st, "demo", "prod", plan); !errors.Is(err, ErrNotApproved) || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expired approval: %v", err)
+	}
+	if list, _ := st.ListApprovals(ctx, ApprovalFilter{Stack: "demo", Status: ApprovalRejected}); len(list) != 1 || list[0].Reason != "freeze" {
+		t.Fatalf("list rejected: %+v", list)
+	}
+}
+
+func TestFileStoreResolveSkills(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]string{}
+	for _, src := range []SkillSource{
+		{Name: "upstream", Priority: 0, Enabled: true},
+		{Name: "team", Priority: 10, Enabled: true},
+		{Name: "mirror", Priority: 0, Enabled: true},
+		{Name: "old", Priority: 100, Enabled: false},
+	} {
+		src.Type, src.URI = "local", "/tmp/"+src.Name
+		if ids[src.Name], err = st.AddSkillSource(ctx, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range []struct{ src, path string }{
+		{"upstream", "dns/SKILL.md"}, {"team", "dns/SKILL.md"}, {"old", "dns/SKILL.md"},
+		{"upstream", "rollback/SKILL.md"}, {"mirror", "rollback/SKILL.md"},
+		{"old", "legacy/SKILL.md"}, {"team", "notes.md"},
+	} {
+		if err := st.UpsertSkillDoc(ctx, SkillDoc{SourceID: ids[d.src], Path: d.path, SHA256: d.src, Content: "# " + d.src}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ResolveSkills(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("resolved %+v", got)
+	}
+	dns, rollback := got[0], got[1]
+	if dns.Name != "dns" || dns.Source != "team" || dns.Doc.Content != "# team" || len(dns.Shadowed) != 2 ||
+		dns.Shadowed[0].Source != "upstream" || dns.Shadowed[1].Reason != "source disabled" {
+		t.Fatalf("dns: %+v", dns)
+	}
+	if rollback.Source != "mirror" || !strings.Contains(rollback.Reason, "tie with upstream") {
+		t.Fatalf("rollback: %+v", rollback)
+	}
+
+	if _, err := st.PinSkill(ctx, SkillPin{Skill: "dns", SourceID: "nope"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("pin to unknown source: %v", err)
+	}
+	for skill, src := range map[string]string{"dns": "upstream", "rollback": "old"} {
+		if _, err := st.PinSkill(ctx, SkillPin{Skill: skill, SourceID: ids[src], Reason: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = ResolveSkills(ctx, st)
+	if dns := got[0]; dns.Source != "upstream" || !dns.Pinned || dns.Reason != "pinned to upstream" || dns.Shadowed[0].Reason != "shadowed by pin to upstream" {
+		t.Fatalf("pinned dns: %+v", dns)
+	}
+	if rb := got[1]; rb.Source != "mirror" || rb.Pinned || !strings.HasPrefix(rb.Reason, "pin to old ignored") {
+		t.Fatalf("pin to disabled source: %+v", rb)
+	}
+	if err := st.UnpinSkill(ctx, "dns"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = ResolveSkills(ctx, st); got[0].Source != "team" {
+		t.Fatalf("after unpin: %+v", got[0])
+	}
+
+	// Removing a source drops its docs and pins, as the Postgres foreign
+	// keys cascade.
+	if err := st.RemoveSkillSource(ctx, ids["old"]); err != nil {
+		t.Fatal(err)
+	}
+	if pins, _ := st.ListSkillPins(ctx); len(pins) != 0 {
+		t.Fatalf("pins of removed source: %+v", pins)
+	}
+	if _, err := st.GetSkillDoc(ctx, ids["old"], "legacy/SKILL.md"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("doc of removed source: %v", err)
+	}
+	if got, _ = ResolveSkills(ctx, st); got[1].Source != "mirror" || strings.Contains(got[1].Reason, "pin") {
+		t.Fatalf("after removing source: %+v", got[1])
+	}
+	if err := st.RemoveSkillSource(ctx, ids["old"]); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("remove twice: %v", err)
+	}
+}
+
+func TestFileStoreWatchSeesOtherProcess(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// Two handles on one path stand in for `runs watch` and a runner in
+	// separate processes; they share nothing but the file.
+	writer, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.CreateRun(ctx, Run{RunID: "old", Stack: "demo", Phase: "plan"}); err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := Watch(ctx, watcher, 10*time.Millisecond)
+
+	next := func() Change {
+		t.Helper()
+		select {
+		case c := <-ch:
+			return c
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for change")
+			return Change{}
+		}
+	}
+	// Wait for the seeding poll so "old" is not reported.
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := writer.CreateRun(ctx, Run{RunID: "new", Stack: "demo", Env: "prod", Phase: "apply"}); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Op != "INSERT" || c.RunID != "new" || c.Env != "prod" || c.Status != RunQueued {
+		t.Fatalf("insert: %+v", c)
+	}
+	if err := writer.StartRun(ctx, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Op != "UPDATE" || c.RunID != "new" || c.Status != RunRunning {
+		t.Fatalf("start: %+v", c)
+	}
+	if err := writer.FinishRun(ctx, "new", RunOK, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Op != "UPDATE" || c.RunID != "new" || c.Status != RunOK {
+		t.Fatalf("finish: %+v", c)
+	}
+
+	// Writes go the other way too, without dropping what the writer added.
+	if _, err := watcher.CreateRun(ctx, Run{RunID: "third", Stack: "demo", Phase: "plan"}); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := writer.ListRuns(ctx, RunFilter{})
+	if err != nil || len(runs) != 3 {
+		t.Fatalf("runs after reload: %d %v", len(runs), err)
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Pinger is implemented by backends with a connection that can fail
+// independently of the process (readiness checks).
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PoolStater is implemented by backends with a connection pool.
+type PoolStater interface {
+	PoolStats() *pgxpool.Stat
+}
+
+func (s *Postgres) Ping(ctx context.Context) error { return s.pool.Ping(ctx) }
+
+func (s *Postgres) PoolStats() *pgxpool.Stat { return s.pool.Stat() }
+
+// RunStats counts runs by stack, phase and status.
+func (s *Postgres) RunStats(ctx context.Context) ([]RunCount, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT stack, phase, status, count(*)
+		FROM xcf.runs
+		GROUP BY stack, phase, status
+		ORDER BY stack, phase, status
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []RunCount
+	for rows.Next() {
+		var c RunCount
+		if err := rows.Scan(&c.Stack, &c.Phase, &c.Status, &c.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (f *File) RunStats(ctx context.Context) ([]RunCount, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	counts := map[RunCount]int64{}
+	for _, r := range f.data.Runs {
+		counts[RunCount{Stack: r.Stack, Phase: r.Phase, Status: r.Status}]++
+	}
+	out := make([]RunCount, 0, len(counts))
+	for k, n := range counts {
+		k.Count = n
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Stack != b.Stack {
+			return a.Stack < b.Stack
+		}
+		if a.Phase != b.Phase {
+			return a.Phase < b.Phase
+		}
+		return a.Status < b.Status
+	})
+	return out, nil
+}
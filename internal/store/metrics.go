@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"xcloudflow/internal/metrics"
+)
+
+// RegisterMetrics exports run counts and, for pooled backends, connection
+// pool stats from st on every scrape.
+func RegisterMetrics(reg *metrics.Registry, st Store) {
+	reg.Collect(func(ctx context.Context, e *metrics.Emitter) {
+		if ps, ok := st.(PoolStater); ok {
+			s := ps.PoolStats()
+			e.Gauge("xcf_db_pool_max_conns", "Maximum size of the DB connection pool.", float64(s.MaxConns()))
+			e.Gauge("xcf_db_pool_total_conns", "DB connections currently open.", float64(s.TotalConns()))
+			e.Gauge("xcf_db_pool_acquired_conns", "DB connections currently in use.", float64(s.AcquiredConns()))
+			e.Gauge("xcf_db_pool_idle_conns", "DB connections currently idle.", float64(s.IdleConns()))
+			e.CounterValue("xcf_db_pool_acquires_total", "Connections acquired from the pool.", float64(s.AcquireCount()))
+			e.CounterValue("xcf_db_pool_empty_acquires_total", "Acquires that had to wait for a connection.", float64(s.EmptyAcquireCount()))
+			e.CounterValue("xcf_db_pool_acquire_wait_seconds_total", "Total time spent acquiring connections.", s.AcquireDuration().Seconds())
+		}
+		counts, err := st.RunStats(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "metrics: run stats:", err)
+			return
+		}
+		for _, c := range counts {
+			e.Gauge("xcf_runs", "Runs in the store by stack, phase and status.", float64(c.Count),
+				"stack", c.Stack, "phase", c.Phase, "status", c.Status)
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package store
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Run struct {
 	RunID      string
@@ -12,21 +15,154 @@ type Run struct {
 	ConfigRef  string
 	StartedAt  time.Time
 	FinishedAt *time.Time
-	InputsJSON []byte
-	PlanJSON   []byte
-	ResultJSON []byte
+	// HeartbeatAt is refreshed while the run is in progress (see Heartbeat).
+	HeartbeatAt *time.Time
+	InputsJSON  json.RawMessage
+	PlanJSON    json.RawMessage
+	ResultJSON  json.RawMessage
+}
+
+// RunFilter narrows ListRuns. Empty fields match everything.
+type RunFilter struct {
+	Stack  string
+	Env    string
+	Phase  string
+	Status string
+	Limit  int
+}
+
+// RunArtifact points at an output of a run (plan file, log, report).
+// URI is where the content lives; the store only keeps the reference.
+type RunArtifact struct {
+	ArtifactID   string
+	RunID        string
+	Kind         string
+	URI          string
+	Checksum     string
+	CreatedAt    time.Time
+	MetadataJSON json.RawMessage
 }
 
 type MCPServer struct {
-	ServerID  string
-	Name      string
-	BaseURL   string
-	Kind      string
-	AuthType  string
-	Audience  string
+	ServerID string
+	Name     string
+	BaseURL  string
+	Kind     string
+	AuthType string
+	Audience string
+	// SecretRef locates the bearer token (auth_type=bearer), e.g.
+	// "env:SERVICE_TOKEN"; see internal/secrets.
+	SecretRef string
 	Enabled   bool
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// AllowTools/DenyTools are glob patterns (path.Match) applied by the MCP
+	// gateway to this server's tool names. Deny wins; empty AllowTools
+	// allows everything not denied.
+	AllowTools []string
+	DenyTools  []string
+	// ApplyTools are glob patterns marking tools that change infrastructure
+	// (like "deploy"): the gateway requires authn.ScopeApply and an approved
+	// plan for them, as for "*.apply" tools.
+	ApplyTools []string
+
+	// Health is ok|error|unknown; LastSeenAt is the last successful contact.
+	Health        string
+	LastError     string
+	LastSeenAt    *time.Time
+	LastCheckedAt *time.Time
+}
+
+// MCP server health values.
+const (
+	MCPHealthUnknown = "unknown"
+	MCPHealthOK      = "ok"
+	MCPHealthError   = "error"
+)
+
+type MCPToolsCache struct {
+	ServerID  string
+	Tools     json.RawMessage
+	ETag      string
+	FetchedAt time.Time
+}
+
+// AuditEvent is one audited MCP tools/call. ArgumentsJSON is already
+// redacted by the caller.
+type AuditEvent struct {
+	AuditID       string          `json:"audit_id"`
+	TS            time.Time       `json:"ts"`
+	Actor         string          `json:"actor,omitempty"`
+	SessionID     string          `json:"session_id,omitempty"`
+	Tool          string          `json:"tool"`
+	ArgumentsJSON json.RawMessage `json:"arguments"`
+	DurationMS    int64           `json:"duration_ms"`
+	Outcome       string          `json:"outcome"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// Audit outcomes.
+const (
+	AuditOK        = "ok"        // the tool succeeded
+	AuditError     = "error"     // the tool ran and failed (isError result)
+	AuditRejected  = "rejected"  // unknown tool or invalid arguments
+	AuditForbidden = "forbidden" // the caller lacks the tool's scope
+	AuditCancelled = "cancelled" // the client cancelled the call
+	AuditThrottled = "throttled" // refused by the rate or concurrency limiter
+)
+
+// RunCount is the number of runs per stack, phase and status (RunStats).
+type RunCount struct {
+	Stack  string `json:"stack"`
+	Phase  string `json:"phase"`
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+// AuditFilter narrows ListAudit. Empty fields match everything.
+type AuditFilter struct {
+	Actor   string
+	Tool    string
+	Outcome string
+	Since   time.Time
+	Limit   int
+}
+
+// Approval binds a decision to one plan, identified by its content hash
+// (PlanHash), for a stack/env. See CheckApproval.
+type Approval struct {
+	ApprovalID  string          `json:"approval_id"`
+	Stack       string          `json:"stack"`
+	Env         string          `json:"env"`
+	PlanHash    string          `json:"plan_hash"`
+	PlanJSON    json.RawMessage `json:"plan,omitempty"`
+	RunID       string          `json:"run_id,omitempty"`
+	Status      string          `json:"status"`
+	RequestedBy string          `json:"requested_by,omitempty"`
+	RequestedAt time.Time       `json:"requested_at"`
+	DecidedBy   string          `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time      `json:"decided_at,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+}
+
+// ApprovalDecision approves or rejects a pending approval (or revokes an
+// approved one by rejecting it).
+type ApprovalDecision struct {
+	Status    string
+	Actor     string
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+// ApprovalFilter narrows ListApprovals. Empty fields match everything.
+type ApprovalFilter struct {
+	Stack    string
+	Env      string
+	Status   string
+	PlanHash string
+	Limit    int
 }
 
 type SkillSource struct {
@@ -37,5 +173,53 @@ type SkillSource struct {
 	Ref      string
 	BasePath string
 	Enabled  bool
+	// Priority orders sources for ResolveSkills: a higher priority source
+	// shadows same-named skills of lower ones.
+	Priority int
 }
 
+// SkillPin makes ResolveSkills take Skill from the given source regardless
+// of priorities.
+type SkillPin struct {
+	Skill      string    `json:"skill"`
+	SourceID   string    `json:"source_id"`
+	SourceName string    `json:"source"`
+	PinnedBy   string    `json:"pinned_by,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SkillDoc is a cached skill document. Name is derived from Path as for
+// SkillHit.
+type SkillDoc struct {
+	SourceID   string
+	SourceName string
+	Name       string
+	Path       string
+	SHA256     string
+	Content    string
+	// Commit is the git commit the doc was read at (git sources only).
+	Commit string
+	// Meta is the doc's parsed frontmatter as JSON (skills.Meta); empty
+	// when it was cached without one.
+	Meta      json.RawMessage
+	FetchedAt time.Time
+}
+
+type KV struct {
+	Namespace string
+	Key       string
+	Value     json.RawMessage
+	Version   int64
+	UpdatedAt time.Time
+}
+
+// SkillHit is a ranked SearchSkills result.
+type SkillHit struct {
+	SourceID   string  `json:"source_id"`
+	SourceName string  `json:"source"`
+	Name       string  `json:"name"`
+	Path       string  `json:"path"`
+	Rank       float64 `json:"rank"`
+	Snippet    string  `json:"snippet"`
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// NOTIFY channels populated by the triggers in sql/schema.sql.
+const (
+	ChannelRuns        = "xcf_runs"
+	ChannelAgentEvents = "xcf_agent_events"
+)
+
+// Change is a run or agent event insert/update.
+type Change struct {
+	Kind string `json:"kind"` // run | event
+	Op   string `json:"op"`   // INSERT | UPDATE
+
+	RunID  string `json:"run_id,omitempty"`
+	Stack  string `json:"stack,omitempty"`
+	Env    string `json:"env,omitempty"`
+	Phase  string `json:"phase,omitempty"`
+	Status string `json:"status,omitempty"`
+
+	EventID   string `json:"event_id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Level     string `json:"level,omitempty"`
+	EventType string `json:"event_type,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Subscriber is implemented by backends that can push changes.
+type Subscriber interface {
+	// Subscribe streams changes until ctx is done or the connection is lost;
+	// the channel is closed in both cases.
+	Subscribe(ctx context.Context) (<-chan Change, error)
+}
+
+// Subscribe LISTENs on a dedicated pool connection.
+func (s *Postgres) Subscribe(ctx context.Context) (<-chan Change, error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range []string{ChannelRuns, ChannelAgentEvents} {
+		if _, err := conn.Exec(ctx, "LISTEN "+ch); err != nil {
+			conn.Release()
+			return nil, fmt.Errorf("listen %s: %w", ch, err)
+		}
+	}
+	// The connection carries LISTEN state; take it out of the pool for good.
+	pc := conn.Hijack()
+
+	out := make(chan Change, 64)
+	go func() {
+		defer close(out)
+		defer pc.Close(context.Background())
+		for {
+			n, err := pc.WaitForNotification(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintln(os.Stderr, "store: listen:", err)
+				}
+				return
+			}
+			var c Change
+			if err := json.Unmarshal([]byte(n.Payload), &c); err != nil {
+				continue
+			}
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Watch streams run/event changes. It uses LISTEN/NOTIFY when st supports it
+// and falls back to polling ListRuns every pollEvery when it does not, when
+// LISTEN fails (e.g. behind a transaction pooler) or when the listening
+// connection is lost. Polling only observes runs, not agent events.
+func Watch(ctx context.Context, st Store, pollEvery time.Duration) <-chan Change {
+	if pollEvery <= 0 {
+		pollEvery = 5 * time.Second
+	}
+	out := make(chan Change, 64)
+	go func() {
+		defer close(out)
+		if sub, ok := st.(Subscriber); ok {
+			ch, err := sub.Subscribe(ctx)
+			if err == nil {
+				for c := range ch {
+					select {
+					case out <- c:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+			} else {
+				fmt.Fprintln(os.Stderr, "store: listen unavailable, polling:", err)
+			}
+		}
+		pollRuns(ctx, st, pollEvery, out)
+	}()
+	return out
+}
+
+// pollRuns diffs the most recent runs on every tick and emits inserts and
+// status changes. The first snapshot only seeds state.
+func pollRuns(ctx context.Context, st Store, every time.Duration, out chan<- Change) {
+	seen := map[string]string{}
+	seeded := false
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		runs, err := st.ListRuns(ctx, RunFilter{Limit: 200})
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "store: poll runs:", err)
+		}
+		// ListRuns is newest first; emit oldest first.
+		next := make(map[string]string, len(runs))
+		for i := len(runs) - 1; i >= 0; i-- {
+			r := runs[i]
+			prev, ok := seen[r.RunID]
+			next[r.RunID] = r.Status
+			if seeded && (!ok || prev != r.Status) {
+				op := "UPDATE"
+				if !ok {
+					op = "INSERT"
+				}
+				select {
+				case out <- Change{Kind: "run", Op: op, RunID: r.RunID, Stack: r.Stack, Env: r.Env, Phase: r.Phase, Status: r.Status}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		if err == nil {
+			seen, seeded = next, true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
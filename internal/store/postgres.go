@@ -2,18 +2,21 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type Store struct {
+// Postgres is the PostgreSQL-backed Store (schema: sql/schema.sql).
+type Postgres struct {
 	pool *pgxpool.Pool
 }
 
-func Open(ctx context.Context, dsn string) (*Store, error) {
+func OpenPostgres(ctx context.Context, dsn string) (*Postgres, error) {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parse dsn: %w", err)
@@ -28,25 +31,32 @@ func Open(ctx context.Context, dsn string) (*Store, error) {
 		pool.Close()
 		return nil, fmt.Errorf("ping: %w", err)
 	}
-	return &Store{pool: pool}, nil
+	return &Postgres{pool: pool}, nil
 }
 
-func (s *Store) Close() { s.pool.Close() }
+func (s *Postgres) Close() { s.pool.Close() }
 
 // ExecSQL executes raw SQL (used for schema bootstrap).
 // Caller is responsible for idempotency (schema.sql should be).
-func (s *Store) ExecSQL(ctx context.Context, sql string) error {
+func (s *Postgres) ExecSQL(ctx context.Context, sql string) error {
 	_, err := s.pool.Exec(ctx, sql)
 	return err
 }
 
-func (s *Store) CreateRun(ctx context.Context, r Run) (string, error) {
+// CreateRun inserts a run in status queued (default) or running.
+func (s *Postgres) CreateRun(ctx context.Context, r Run) (string, error) {
 	if r.RunID == "" {
 		r.RunID = uuid.NewString()
 	}
+	if r.Status == "" {
+		r.Status = RunQueued
+	}
+	if err := checkInitialRunStatus(r.Status); err != nil {
+		return "", err
+	}
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO xcf.runs (run_id, stack, env, phase, status, actor, config_ref, inputs, plan, result)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8::jsonb,$9::jsonb,$10::jsonb)
+		INSERT INTO xcf.runs (run_id, stack, env, phase, status, actor, config_ref, inputs, plan, result, heartbeat_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8::jsonb,$9::jsonb,$10::jsonb, CASE WHEN $5='running' THEN now() END)
 	`, r.RunID, r.Stack, r.Env, r.Phase, r.Status, nullIfEmpty(r.Actor), nullIfEmpty(r.ConfigRef),
 		jsonOrEmpty(r.InputsJSON), jsonOrEmpty(r.PlanJSON), jsonOrEmpty(r.ResultJSON),
 	)
@@ -56,16 +66,149 @@ func (s *Store) CreateRun(ctx context.Context, r Run) (string, error) {
 	return r.RunID, nil
 }
 
-func (s *Store) FinishRun(ctx context.Context, runID string, status string, resultJSON []byte) error {
-	_, err := s.pool.Exec(ctx, `
+// StartRun moves a queued run to running and records the first heartbeat.
+func (s *Postgres) StartRun(ctx context.Context, runID string) error {
+	return s.transitionRun(ctx, runID, RunRunning, `
+		UPDATE xcf.runs
+		SET status=$2, heartbeat_at=now()
+		WHERE run_id=$1
+	`)
+}
+
+// FinishRun moves an active run to a terminal status (ok, failed, cancelled, timed_out).
+func (s *Postgres) FinishRun(ctx context.Context, runID string, status string, resultJSON []byte) error {
+	if !IsTerminalRunStatus(status) {
+		return fmt.Errorf("%w: %q is not a final status", ErrInvalidTransition, status)
+	}
+	return s.transitionRun(ctx, runID, status, `
 		UPDATE xcf.runs
 		SET status=$2, finished_at=now(), result=$3::jsonb
 		WHERE run_id=$1
-	`, runID, status, jsonOrEmpty(resultJSON))
-	return err
+	`, jsonOrEmpty(resultJSON))
+}
+
+// transitionRun locks the run row, checks the status transition and applies
+// update ($1=run_id, $2=new status, $3.. = args).
+func (s *Postgres) transitionRun(ctx context.Context, runID, to, update string, args ...any) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var from string
+	err = tx.QueryRow(ctx, `SELECT status FROM xcf.runs WHERE run_id=$1 FOR UPDATE`, runID).Scan(&from)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("run %s: %w", runID, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if err := CheckRunTransition(from, to); err != nil {
+		return fmt.Errorf("run %s: %w", runID, err)
+	}
+	if _, err := tx.Exec(ctx, update, append([]any{runID, to}, args...)...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Heartbeat refreshes heartbeat_at of a running run. It fails with
+// ErrInvalidTransition once the run left running (e.g. it was reaped).
+func (s *Postgres) Heartbeat(ctx context.Context, runID string) error {
+	var status string
+	err := s.pool.QueryRow(ctx, `
+		UPDATE xcf.runs r
+		SET heartbeat_at = CASE WHEN r.status='running' THEN now() ELSE r.heartbeat_at END
+		WHERE r.run_id=$1
+		RETURNING r.status
+	`, runID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("run %s: %w", runID, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if status != RunRunning {
+		return fmt.Errorf("run %s is %s: %w", runID, status, ErrInvalidTransition)
+	}
+	return nil
+}
+
+// ReapStaleRuns marks running runs whose last heartbeat is older than
+// staleAfter as timed_out and returns their IDs.
+func (s *Postgres) ReapStaleRuns(ctx context.Context, staleAfter time.Duration) ([]string, error) {
+	rows, err := s.pool.Query(ctx, `
+		UPDATE xcf.runs
+		SET status='timed_out', finished_at=now(),
+		    result = result || jsonb_build_object('error', 'heartbeat expired')
+		WHERE status='running'
+		  AND COALESCE(heartbeat_at, started_at) < now() - make_interval(secs => $1)
+		RETURNING run_id::text
+	`, staleAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+const runColumns = `run_id::text, stack, env, phase, status, COALESCE(actor,''), COALESCE(config_ref,''),
+		started_at, finished_at, heartbeat_at, inputs, plan, result`
+
+func scanRun(row pgx.Row) (Run, error) {
+	var r Run
+	err := row.Scan(&r.RunID, &r.Stack, &r.Env, &r.Phase, &r.Status, &r.Actor, &r.ConfigRef,
+		&r.StartedAt, &r.FinishedAt, &r.HeartbeatAt, &r.InputsJSON, &r.PlanJSON, &r.ResultJSON)
+	return r, err
+}
+
+func (s *Postgres) GetRun(ctx context.Context, runID string) (Run, error) {
+	r, err := scanRun(s.pool.QueryRow(ctx, `SELECT `+runColumns+` FROM xcf.runs WHERE run_id=$1`, runID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Run{}, fmt.Errorf("run %s: %w", runID, ErrNotFound)
+	}
+	return r, err
 }
 
-func (s *Store) UpsertMCPServer(ctx context.Context, srv MCPServer) (string, error) {
+// ListRuns returns runs newest first (default limit 50).
+func (s *Postgres) ListRuns(ctx context.Context, f RunFilter) ([]Run, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+runColumns+`
+		FROM xcf.runs
+		WHERE ($1='' OR stack=$1) AND ($2='' OR env=$2) AND ($3='' OR phase=$3) AND ($4='' OR status=$4)
+		ORDER BY started_at DESC
+		LIMIT $5
+	`, f.Stack, f.Env, f.Phase, f.Status, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Run
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *Postgres) UpsertMCPServer(ctx context.Context, srv MCPServer) (string, error) {
 	if srv.ServerID == "" {
 		srv.ServerID = uuid.NewString()
 	}
@@ -76,25 +219,31 @@ func (s *Store) UpsertMCPServer(ctx context.Context, srv MCPServer) (string, err
 		srv.AuthType = "none"
 	}
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO xcf.mcp_servers (server_id, name, base_url, kind, auth_type, audience, enabled)
-		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		INSERT INTO xcf.mcp_servers (server_id, name, base_url, kind, auth_type, audience, secret_ref, enabled, tools_allow, tools_deny, tools_apply)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
 		ON CONFLICT (name) DO UPDATE SET
 		  base_url=EXCLUDED.base_url,
 		  kind=EXCLUDED.kind,
 		  auth_type=EXCLUDED.auth_type,
 		  audience=EXCLUDED.audience,
+		  secret_ref=EXCLUDED.secret_ref,
 		  enabled=EXCLUDED.enabled,
+		  tools_allow=EXCLUDED.tools_allow,
+		  tools_deny=EXCLUDED.tools_deny,
+		  tools_apply=EXCLUDED.tools_apply,
 		  updated_at=now()
-	`, srv.ServerID, srv.Name, srv.BaseURL, srv.Kind, srv.AuthType, nullIfEmpty(srv.Audience), srv.Enabled)
+	`, srv.ServerID, srv.Name, srv.BaseURL, srv.Kind, srv.AuthType, nullIfEmpty(srv.Audience), nullIfEmpty(srv.SecretRef), srv.Enabled,
+		nonNilStrings(srv.AllowTools), nonNilStrings(srv.DenyTools), nonNilStrings(srv.ApplyTools))
 	if err != nil {
 		return "", err
 	}
 	return srv.ServerID, nil
 }
 
-func (s *Store) ListMCPServers(ctx context.Context) ([]MCPServer, error) {
+func (s *Postgres) ListMCPServers(ctx context.Context) ([]MCPServer, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT server_id, name, base_url, kind, auth_type, COALESCE(audience,''), enabled, created_at, updated_at
+		SELECT server_id, name, base_url, kind, auth_type, COALESCE(audience,''), COALESCE(secret_ref,''), enabled, created_at, updated_at,
+		       health, COALESCE(last_error,''), last_seen_at, last_checked_at, tools_allow, tools_deny, tools_apply
 		FROM xcf.mcp_servers
 		ORDER BY name
 	`)
@@ -105,7 +254,8 @@ func (s *Store) ListMCPServers(ctx context.Context) ([]MCPServer, error) {
 	var out []MCPServer
 	for rows.Next() {
 		var srv MCPServer
-		if err := rows.Scan(&srv.ServerID, &srv.Name, &srv.BaseURL, &srv.Kind, &srv.AuthType, &srv.Audience, &srv.Enabled, &srv.CreatedAt, &srv.UpdatedAt); err != nil {
+		if err := rows.Scan(&srv.ServerID, &srv.Name, &srv.BaseURL, &srv.Kind, &srv.AuthType, &srv.Audience, &srv.SecretRef, &srv.Enabled, &srv.CreatedAt, &srv.UpdatedAt,
+			&srv.Health, &srv.LastError, &srv.LastSeenAt, &srv.LastCheckedAt, &srv.AllowTools, &srv.DenyTools, &srv.ApplyTools); err != nil {
 			return nil, err
 		}
 		out = append(out, srv)
@@ -113,7 +263,7 @@ func (s *Store) ListMCPServers(ctx context.Context) ([]MCPServer, error) {
 	return out, rows.Err()
 }
 
-func (s *Store) UpdateMCPToolsCache(ctx context.Context, serverID string, toolsJSON []byte, etag string) error {
+func (s *Postgres) UpdateMCPToolsCache(ctx context.Context, serverID string, toolsJSON []byte, etag string) error {
 	_, err := s.pool.Exec(ctx, `
 		INSERT INTO xcf.mcp_tools_cache (server_id, tools, etag)
 		VALUES ($1,$2::jsonb,$3)
@@ -125,30 +275,97 @@ func (s *Store) UpdateMCPToolsCache(ctx context.Context, serverID string, toolsJ
 	return err
 }
 
-func (s *Store) AddSkillSource(ctx context.Context, src SkillSource) (string, error) {
+// TouchMCPToolsCache marks a server's cached tools as confirmed current
+// (an ETag hit) so retention pruning, which goes by fetched_at, keeps them.
+func (s *Postgres) TouchMCPToolsCache(ctx context.Context, serverID string) error {
+	tag, err := s.pool.Exec(ctx, `UPDATE xcf.mcp_tools_cache SET fetched_at=now() WHERE server_id=$1`, serverID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("mcp tools cache %s: %w", serverID, ErrNotFound)
+	}
+	return nil
+}
+
+// ListMCPToolsCache returns the cached tools/list result of every server.
+func (s *Postgres) ListMCPToolsCache(ctx context.Context) ([]MCPToolsCache, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT server_id::text, tools, COALESCE(etag,''), fetched_at
+		FROM xcf.mcp_tools_cache
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []MCPToolsCache
+	for rows.Next() {
+		var c MCPToolsCache
+		if err := rows.Scan(&c.ServerID, &c.Tools, &c.ETag, &c.FetchedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// RecordMCPServerHealth stores the outcome of a contact attempt. A nil
+// checkErr marks the server ok and bumps last_seen_at.
+func (s *Postgres) RecordMCPServerHealth(ctx context.Context, serverID string, checkErr error) error {
+	if checkErr == nil {
+		_, err := s.pool.Exec(ctx, `
+			UPDATE xcf.mcp_servers
+			SET health='ok', last_error=NULL, last_seen_at=now(), last_checked_at=now()
+			WHERE server_id=$1
+		`, serverID)
+		return err
+	}
+	_, err := s.pool.Exec(ctx, `
+		UPDATE xcf.mcp_servers
+		SET health='error', last_error=$2, last_checked_at=now()
+		WHERE server_id=$1
+	`, serverID, checkErr.Error())
+	return err
+}
+
+func (s *Postgres) AddSkillSource(ctx context.Context, src SkillSource) (string, error) {
 	if src.SourceID == "" {
 		src.SourceID = uuid.NewString()
 	}
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO xcf.skill_sources (source_id, name, type, uri, ref, base_path, enabled)
-		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		INSERT INTO xcf.skill_sources (source_id, name, type, uri, ref, base_path, enabled, priority)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
 		ON CONFLICT (name) DO UPDATE SET
 		  type=EXCLUDED.type,
 		  uri=EXCLUDED.uri,
 		  ref=EXCLUDED.ref,
 		  base_path=EXCLUDED.base_path,
 		  enabled=EXCLUDED.enabled,
+		  priority=EXCLUDED.priority,
 		  updated_at=now()
-	`, src.SourceID, src.Name, src.Type, src.URI, nullIfEmpty(src.Ref), nullIfEmpty(src.BasePath), src.Enabled)
+	`, src.SourceID, src.Name, src.Type, src.URI, nullIfEmpty(src.Ref), nullIfEmpty(src.BasePath), src.Enabled, src.Priority)
 	if err != nil {
 		return "", err
 	}
 	return src.SourceID, nil
 }
 
-func (s *Store) ListSkillSources(ctx context.Context) ([]SkillSource, error) {
+// RemoveSkillSource deletes a source; its docs and pins go with it
+// (ON DELETE CASCADE).
+func (s *Postgres) RemoveSkillSource(ctx context.Context, sourceID string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM xcf.skill_sources WHERE source_id=$1`, sourceID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("skill source %s: %w", sourceID, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *Postgres) ListSkillSources(ctx context.Context) ([]SkillSource, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT source_id, name, type, uri, COALESCE(ref,''), COALESCE(base_path,''), enabled
+		SELECT source_id, name, type, uri, COALESCE(ref,''), COALESCE(base_path,''), enabled, priority
 		FROM xcf.skill_sources
 		ORDER BY name
 	`)
@@ -160,7 +377,7 @@ func (s *Store) ListSkillSources(ctx context.Context) ([]SkillSource, error) {
 	var out []SkillSource
 	for rows.Next() {
 		var src SkillSource
-		if err := rows.Scan(&src.SourceID, &src.Name, &src.Type, &src.URI, &src.Ref, &src.BasePath, &src.Enabled); err != nil {
+		if err := rows.Scan(&src.SourceID, &src.Name, &src.Type, &src.URI, &src.Ref, &src.BasePath, &src.Enabled, &src.Priority); err != nil {
 			return nil, err
 		}
 		out = append(out, src)
@@ -168,15 +385,18 @@ func (s *Store) ListSkillSources(ctx context.Context) ([]SkillSource, error) {
 	return out, rows.Err()
 }
 
-func (s *Store) UpsertSkillDoc(ctx context.Context, sourceID string, path string, sha256 string, content string) error {
+// UpsertSkillDoc caches d under (SourceID, Path).
+func (s *Postgres) UpsertSkillDoc(ctx context.Context, d SkillDoc) error {
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO xcf.skill_docs (source_id, path, sha256, content)
-		VALUES ($1,$2,$3,$4)
+		INSERT INTO xcf.skill_docs (source_id, path, sha256, content, commit_sha, meta)
+		VALUES ($1,$2,$3,$4,$5,$6::jsonb)
 		ON CONFLICT (source_id, path) DO UPDATE SET
 		  sha256=EXCLUDED.sha256,
 		  content=EXCLUDED.content,
+		  commit_sha=EXCLUDED.commit_sha,
+		  meta=EXCLUDED.meta,
 		  fetched_at=now()
-	`, sourceID, path, sha256, content)
+	`, d.SourceID, d.Path, d.SHA256, d.Content, nullIfEmpty(d.Commit), jsonOrEmpty(d.Meta))
 	return err
 }
 
@@ -187,6 +407,14 @@ func nullIfEmpty(s string) any {
 	return s
 }
 
+// nonNilStrings keeps NOT NULL TEXT[] columns at '{}' rather than NULL.
+func nonNilStrings(v []string) []string {
+	if v == nil {
+		return []string{}
+	}
+	return v
+}
+
 func jsonOrEmpty(b []byte) string {
 	if len(b) == 0 {
 		return "{}"
@@ -200,4 +428,3 @@ func jsonOrArray(b []byte) string {
 	}
 	return string(b)
 }
-
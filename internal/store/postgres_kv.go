@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetKV returns a single xcf.kv entry, or ErrNotFound.
+func (s *Postgres) GetKV(ctx context.Context, namespace, key string) (KV, error) {
+	kv := KV{Namespace: namespace, Key: key}
+	err := s.pool.QueryRow(ctx, `
+		SELECT value, version, updated_at
+		FROM xcf.kv
+		WHERE namespace=$1 AND key=$2
+	`, namespace, key).Scan(&kv.Value, &kv.Version, &kv.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return KV{}, ErrNotFound
+	}
+	if err != nil {
+		return KV{}, err
+	}
+	return kv, nil
+}
+
+// ListKV returns all entries in a namespace whose key starts with prefix.
+func (s *Postgres) ListKV(ctx context.Context, namespace, prefix string) ([]KV, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT namespace, key, value, version, updated_at
+		FROM xcf.kv
+		WHERE namespace=$1 AND starts_with(key, $2)
+		ORDER BY key
+	`, namespace, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []KV
+	for rows.Next() {
+		var kv KV
+		if err := rows.Scan(&kv.Namespace, &kv.Key, &kv.Value, &kv.Version, &kv.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, kv)
+	}
+	return out, rows.Err()
+}
+
+// PutKV unconditionally writes value (JSON) and returns the new version.
+func (s *Postgres) PutKV(ctx context.Context, namespace, key string, value []byte) (int64, error) {
+	var version int64
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO xcf.kv (namespace, key, value)
+		VALUES ($1,$2,$3::jsonb)
+		ON CONFLICT (namespace, key) DO UPDATE SET
+		  value=EXCLUDED.value,
+		  version=xcf.kv.version+1,
+		  updated_at=now()
+		RETURNING version
+	`, namespace, key, jsonOrEmpty(value)).Scan(&version)
+	return version, err
+}
+
+// CompareAndSwapKV writes value only if the stored version equals expected.
+// An expected version of 0 means "create only if absent".
+// Returns the new version, or ErrVersionConflict if another writer won.
+func (s *Postgres) CompareAndSwapKV(ctx context.Context, namespace, key string, expected int64, value []byte) (int64, error) {
+	var version int64
+	var err error
+	if expected == 0 {
+		err = s.pool.QueryRow(ctx, `
+			INSERT INTO xcf.kv (namespace, key, value)
+			VALUES ($1,$2,$3::jsonb)
+			ON CONFLICT (namespace, key) DO NOTHING
+			RETURNING version
+		`, namespace, key, jsonOrEmpty(value)).Scan(&version)
+	} else {
+		err = s.pool.QueryRow(ctx, `
+			UPDATE xcf.kv
+			SET value=$4::jsonb, version=version+1, updated_at=now()
+			WHERE namespace=$1 AND key=$2 AND version=$3
+			RETURNING version
+		`, namespace, key, expected, jsonOrEmpty(value)).Scan(&version)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrVersionConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// DeleteKV removes an entry. Deleting a missing key is not an error.
+func (s *Postgres) DeleteKV(ctx context.Context, namespace, key string) error {
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM xcf.kv
+		WHERE namespace=$1 AND key=$2
+	`, namespace, key)
+	return err
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy controls Prune.
+//
+// A finished run is deleted only when it is older than MaxAge AND outside the
+// KeepLast newest runs of its stack/env. The newest ok run per stack/env and
+// active (queued/running) runs are always kept. Agent events, MCP tools
+// cache rows and MCP audit events older than MaxAge are deleted.
+type RetentionPolicy struct {
+	MaxAge    time.Duration
+	KeepLast  int
+	BatchSize int
+	DryRun    bool
+}
+
+// PruneReport counts deleted (or, in dry-run mode, deletable) rows.
+type PruneReport struct {
+	DryRun      bool  `json:"dry_run"`
+	Runs        int64 `json:"runs"`
+	AgentEvents int64 `json:"agent_events"`
+	ToolsCache  int64 `json:"mcp_tools_cache"`
+	Audit       int64 `json:"mcp_audit"`
+}
+
+func (p RetentionPolicy) validate() error {
+	if p.MaxAge <= 0 && p.KeepLast <= 0 {
+		return fmt.Errorf("retention: set a max age and/or keep-last")
+	}
+	if p.MaxAge < 0 || p.KeepLast < 0 {
+		return fmt.Errorf("retention: max age and keep-last must not be negative")
+	}
+	return nil
+}
+
+func (p RetentionPolicy) cutoff(now time.Time) time.Time {
+	return now.Add(-p.MaxAge)
+}
+
+func (p RetentionPolicy) batchSize() int {
+	if p.BatchSize <= 0 {
+		return 500
+	}
+	return p.BatchSize
+}
+
+// prunableRuns selects run_ids eligible for deletion ($1=cutoff, $2=keep last).
+const prunableRuns = `
+	SELECT run_id FROM (
+	  SELECT run_id, status, started_at,
+	    row_number() OVER (PARTITION BY stack, env ORDER BY started_at DESC) AS rn,
+	    row_number() OVER (PARTITION BY stack, env, status='ok' ORDER BY started_at DESC) AS status_rn
+	  FROM xcf.runs
+	) ranked
+	WHERE status IN ('ok','failed','cancelled','timed_out')
+	  AND started_at < $1
+	  AND rn > $2
+	  AND NOT (status='ok' AND status_rn=1)`
+
+// Prune applies the retention policy, deleting in batches of BatchSize so no
+// single statement holds locks for long.
+func (s *Postgres) Prune(ctx context.Context, p RetentionPolicy) (PruneReport, error) {
+	rep := PruneReport{DryRun: p.DryRun}
+	if err := p.validate(); err != nil {
+		return rep, err
+	}
+	cutoff := p.cutoff(time.Now())
+	var err error
+
+	if p.DryRun {
+		if err = s.pool.QueryRow(ctx, `SELECT count(*) FROM (`+prunableRuns+`) x`, cutoff, p.KeepLast).Scan(&rep.Runs); err != nil {
+			return rep, err
+		}
+		if p.MaxAge > 0 {
+			if err = s.pool.QueryRow(ctx, `SELECT count(*) FROM xcf.agent_events WHERE ts < $1`, cutoff).Scan(&rep.AgentEvents); err != nil {
+				return rep, err
+			}
+			if err = s.pool.QueryRow(ctx, `SELECT count(*) FROM xcf.mcp_tools_cache WHERE fetched_at < $1`, cutoff).Scan(&rep.ToolsCache); err != nil {
+				return rep, err
+			}
+			if err = s.pool.QueryRow(ctx, `SELECT count(*) FROM xcf.mcp_audit WHERE ts < $1`, cutoff).Scan(&rep.Audit); err != nil {
+				return rep, err
+			}
+		}
+		return rep, nil
+	}
+
+	if rep.Runs, err = s.deleteBatched(ctx, `
+		DELETE FROM xcf.runs WHERE run_id IN (`+prunableRuns+` LIMIT $3)
+	`, cutoff, p.KeepLast, p.batchSize()); err != nil {
+		return rep, err
+	}
+	if p.MaxAge > 0 {
+		if rep.AgentEvents, err = s.deleteBatched(ctx, `
+			DELETE FROM xcf.agent_events WHERE event_id IN (
+			  SELECT event_id FROM xcf.agent_events WHERE ts < $1 LIMIT $2
+			)
+		`, cutoff, p.batchSize()); err != nil {
+			return rep, err
+		}
+		if rep.ToolsCache, err = s.deleteBatched(ctx, `
+			DELETE FROM xcf.mcp_tools_cache WHERE server_id IN (
+			  SELECT server_id FROM xcf.mcp_tools_cache WHERE fetched_at < $1 LIMIT $2
+			)
+		`, cutoff, p.batchSize()); err != nil {
+			return rep, err
+		}
+		if rep.Audit, err = s.deleteBatched(ctx, `
+			DELETE FROM xcf.mcp_audit WHERE audit_id IN (
+			  SELECT audit_id FROM xcf.mcp_audit WHERE ts < $1 LIMIT $2
+			)
+		`, cutoff, p.batchSize()); err != nil {
+			return rep, err
+		}
+	}
+	return rep, nil
+}
+
+// deleteBatched runs a LIMITed DELETE until it affects no rows.
+func (s *Postgres) deleteBatched(ctx context.Context, sql string, args ...any) (int64, error) {
+	var total int64
+	for {
+		tag, err := s.pool.Exec(ctx, sql, args...)
+		if err != nil {
+			return total, err
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() == 0 {
+			return total, nil
+		}
+	}
+}
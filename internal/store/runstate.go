@@ -0,0 +1,51 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Run statuses. queued and running are active; the rest are terminal.
+const (
+	RunQueued    = "queued"
+	RunRunning   = "running"
+	RunOK        = "ok"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+	RunTimedOut  = "timed_out"
+)
+
+// ErrInvalidTransition is returned when a run status change is not allowed
+// (for example finishing a run that already finished).
+var ErrInvalidTransition = errors.New("invalid run status transition")
+
+var runTransitions = map[string][]string{
+	RunQueued:  {RunRunning, RunFailed, RunCancelled},
+	RunRunning: {RunOK, RunFailed, RunCancelled, RunTimedOut},
+}
+
+// IsTerminalRunStatus reports whether status is a final run status.
+func IsTerminalRunStatus(status string) bool {
+	switch status {
+	case RunOK, RunFailed, RunCancelled, RunTimedOut:
+		return true
+	}
+	return false
+}
+
+// CheckRunTransition returns ErrInvalidTransition unless from -> to is allowed.
+func CheckRunTransition(from, to string) error {
+	for _, s := range runTransitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+}
+
+func checkInitialRunStatus(status string) error {
+	if status != RunQueued && status != RunRunning {
+		return fmt.Errorf("%w: new run must be %s or %s, got %q", ErrInvalidTransition, RunQueued, RunRunning, status)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SearchSkills runs a web-style query (words, "phrases", -exclusions) against
+// cached skill docs and returns ranked hits with highlighted snippets.
+func (s *Postgres) SearchSkills(ctx context.Context, query string, limit int) ([]SkillHit, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	rows, err := s.pool.Query(ctx, `
+		WITH q AS (SELECT websearch_to_tsquery('simple', $1) AS q)
+		SELECT d.source_id::text, s.name, d.path,
+		       ts_rank(d.search, q.q) AS rank,
+		       ts_headline('simple', d.content, q.q, 'MaxFragments=2, MaxWords=30, MinWords=10, StartSel=**, StopSel=**')
+		FROM xcf.skill_docs d
+		JOIN xcf.skill_sources s ON s.source_id = d.source_id
+		CROSS JOIN q
+		WHERE d.search @@ q.q
+		ORDER BY rank DESC, d.path
+		LIMIT $2
+	`, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SkillHit
+	for rows.Next() {
+		var h SkillHit
+		if err := rows.Scan(&h.SourceID, &h.SourceName, &h.Path, &h.Rank, &h.Snippet); err != nil {
+			return nil, err
+		}
+		h.Name = skillNameFromPath(h.Path, h.SourceName)
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// SearchSkills on the file backend accepts the same syntax as Postgres'
+// websearch_to_tsquery (words, "phrases", -exclusions, or) but matches
+// case-insensitive substrings rather than lexemes, so "deploy" also finds
+// "deployment". Rank is the number of occurrences of the matched terms, not
+// ts_rank, and the snippet is a single fragment around the first match.
+func (f *File) SearchSkills(ctx context.Context, query string, limit int) ([]SkillHit, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	q := parseWebQuery(query)
+	if len(q.all) == 0 && len(q.none) == 0 {
+		return nil, nil
+	}
+	f.lock()
+	defer f.mu.Unlock()
+
+	var out []SkillHit
+	for _, d := range f.data.SkillDocs {
+		rank, first, ok := q.match(strings.ToLower(collapseSpace(d.Path + " " + d.Content)))
+		if !ok {
+			continue
+		}
+		src := f.data.SkillSources[d.SourceID]
+		out = append(out, SkillHit{
+			SourceID:   d.SourceID,
+			SourceName: src.Name,
+			Name:       skillNameFromPath(d.Path, src.Name),
+			Path:       d.Path,
+			Rank:       float64(rank),
+			Snippet:    snippet(d.Content, first, q.terms(), 120),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rank != out[j].Rank {
+			return out[i].Rank > out[j].Rank
+		}
+		return out[i].Path < out[j].Path
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// webQuery is a parsed websearch-style query: every group in all must have
+// at least one alternative present and no term in none may occur. Terms are
+// lower-cased; phrases keep single spaces between words.
+type webQuery struct {
+	all  [][]string
+	none []string
+}
+
+// parseWebQuery follows websearch_to_tsquery: "..." is a phrase, a leading
+// - negates, and or (any case) between two terms makes them alternatives.
+// Unbalanced quotes run to the end of the query.
+func parseWebQuery(query string) webQuery {
+	var q webQuery
+	or := false
+	for rest := strings.TrimSpace(strings.ToLower(query)); rest != ""; rest = strings.TrimSpace(rest) {
+		neg := false
+		if rest[0] == '-' {
+			neg, rest = true, rest[1:]
+		}
+		var term string
+		if rest != "" && rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				term, rest = rest[1:], ""
+			} else {
+				term, rest = rest[1:end+1], rest[end+2:]
+			}
+			term = strings.Join(strings.Fields(term), " ")
+		} else {
+			end := strings.IndexAny(rest, " \t\r\n\"")
+			if end < 0 {
+				end = len(rest)
+			}
+			term, rest = rest[:end], rest[end:]
+			if !neg && term == "or" {
+				or = len(q.all) > 0
+				continue
+			}
+		}
+		if term == "" {
+			continue
+		}
+		switch {
+		case neg:
+			q.none = append(q.none, term)
+		case or:
+			q.all[len(q.all)-1] = append(q.all[len(q.all)-1], term)
+		default:
+			q.all = append(q.all, []string{term})
+		}
+		or = false
+	}
+	return q
+}
+
+// match reports whether lower-cased text satisfies q, the total number of
+// occurrences of the terms that matched, and the first of those terms.
+func (q webQuery) match(text string) (rank int, first string, ok bool) {
+	for _, t := range q.none {
+		if strings.Contains(text, t) {
+			return 0, "", false
+		}
+	}
+	for _, group := range q.all {
+		hit := false
+		for _, t := range group {
+			if n := strings.Count(text, t); n > 0 {
+				if first == "" {
+					first = t
+				}
+				rank += n
+				hit = true
+			}
+		}
+		if !hit {
+			return 0, "", false
+		}
+	}
+	return rank, first, true
+}
+
+// terms lists the positive terms of q, for highlighting.
+func (q webQuery) terms() []string {
+	var out []string
+	for _, group := range q.all {
+		out = append(out, group...)
+	}
+	return out
+}
+
+// skillNameFromPath maps "<name>/SKILL.md" to name; single-file sources
+// ("SKILL.md") are named after their source.
+func skillNameFromPath(p, sourceName string) string {
+	if dir := path.Dir(p); dir != "." && dir != "/" {
+		return path.Base(dir)
+	}
+	return sourceName
+}
+
+// snippet returns about width bytes of content around the first match of
+// term, with every occurrence of highlight wrapped in ** like ts_headline.
+func snippet(content, term string, highlight []string, width int) string {
+	content = collapseSpace(content)
+	i := strings.Index(strings.ToLower(content), term)
+	if i < 0 || term == "" {
+		i = 0
+	}
+	start := min(max(i-width/2, 0), len(content))
+	end := min(start+width, len(content))
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+	s := highlightTerms(strings.TrimSpace(content[start:end]), highlight)
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(content) {
+		s += "…"
+	}
+	return s
+}
+
+// highlightTerms wraps case-insensitive occurrences of terms in s with **.
+// Text whose lower-casing changes its byte length is returned unchanged.
+func highlightTerms(s string, terms []string) string {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := 0
+		for _, t := range terms {
+			if len(t) > n && strings.HasPrefix(lower[i:], t) {
+				n = len(t)
+			}
+		}
+		if n == 0 {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		b.WriteString("**" + s[i:i+n] + "**")
+		i += n
+	}
+	return b.String()
+}
+
+// collapseSpace replaces runs of whitespace with a single space, so phrases
+// match across line breaks.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFileStoreSearchSkills(t *testing.T) {
+	st, err := OpenFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSearchSkills(t, st)
+
+	// Substring matching is where the file backend differs from Postgres.
+	hits, err := st.SearchSkills(context.Background(), "dashb", 0)
+	if err != nil || len(hits) != 1 || hits[0].Name != "deploy" {
+		t.Fatalf("substring: %+v %v", hits, err)
+	}
+}
+
+// TestPostgresSearchSkills runs against XCF_TEST_DATABASE_URL, applying
+// sql/schema.sql first; it is skipped when the variable is unset.
+func TestPostgresSearchSkills(t *testing.T) {
+	dsn := os.Getenv("XCF_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("XCF_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	st, err := OpenPostgres(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	schema, err := os.ReadFile("../../sql/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ExecSQL(ctx, string(schema)); err != nil {
+		t.Fatalf("apply schema: %v", err)
+	}
+	testSearchSkills(t, st)
+}
+
+// testSearchSkills covers the behaviour both backends share. Every doc and
+// query carries a per-run marker word so a shared database does not leak
+// unrelated hits into the results.
+func testSearchSkills(t *testing.T, st Store) {
+	t.Helper()
+	ctx := context.Background()
+	mark := "zq" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	srcID, err := st.AddSkillSource(ctx, SkillSource{Name: "search-" + mark, Type: "local", URI: "/tmp/" + mark, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.RemoveSkillSource(context.Background(), srcID) })
+	for p, body := range map[string]string{
+		"dns/SKILL.md":      "Lower the TTL before the cutover.\nVerify the cutover with dig, then\nrestore the old TTL once the cutover is done.",
+		"deploy/SKILL.md":   "Roll out the service, then watch the cutover dashboard.",
+		"release/SKILL.md":  "Restore the previous release if the canary fails.\nWatch the canary first.",
+		"untagged/SKILL.md": "Nothing to see here.",
+	} {
+		doc := SkillDoc{SourceID: srcID, Path: p, SHA256: p, Content: "# " + mark + "\n" + body}
+		if err := st.UpsertSkillDoc(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(hits []SkillHit) string {
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	for _, tc := range []struct {
+		query string
+		limit int
+		want  string
+	}{
+		// More occurrences rank higher.
+		{mark + " cutover", 0, "dns,deploy"},
+		{mark + " CUTOVER", 0, "dns,deploy"},
+		{mark + " cutover", 1, "dns"},
+		{mark + " cutover -dig", 0, "deploy"},
+		// The phrase spans a line break in the dns doc.
+		{mark + ` "then restore the old"`, 0, "dns"},
+		{mark + ` "restore the previous"`, 0, "release"},
+		{mark + " dig or canary", 0, "release,dns"},
+		{mark + " nosuchword", 0, ""},
+	} {
+		hits, err := st.SearchSkills(ctx, tc.query, tc.limit)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		if got := names(hits); got != tc.want {
+			t.Errorf("%q limit %d: got %q, want %q", tc.query, tc.limit, got, tc.want)
+		}
+		for i, h := range hits {
+			if h.SourceID != srcID || h.SourceName != "search-"+mark || h.Path != h.Name+"/SKILL.md" {
+				t.Errorf("%q: hit %+v", tc.query, h)
+			}
+			if i > 0 && h.Rank > hits[i-1].Rank {
+				t.Errorf("%q: not ranked: %+v", tc.query, hits)
+			}
+		}
+	}
+
+	hits, err := st.SearchSkills(ctx, mark+" canary", 0)
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("snippet query: %+v %v", hits, err)
+	}
+	if s := hits[0].Snippet; !strings.Contains(s, "**canary**") || strings.Contains(s, "\n") {
+		t.Errorf("snippet %q", s)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListSkillDocs returns every cached doc with its content, ordered by source
+// name and path.
+func (s *Postgres) ListSkillDocs(ctx context.Context) ([]SkillDoc, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT d.source_id, s.name, d.path, d.sha256, d.content, COALESCE(d.commit_sha,''), d.meta, d.fetched_at
+		FROM xcf.skill_docs d
+		JOIN xcf.skill_sources s ON s.source_id = d.source_id
+		ORDER BY s.name, d.path
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SkillDoc
+	for rows.Next() {
+		var d SkillDoc
+		if err := rows.Scan(&d.SourceID, &d.SourceName, &d.Path, &d.SHA256, &d.Content, &d.Commit, &d.Meta, &d.FetchedAt); err != nil {
+			return nil, err
+		}
+		d.Name = skillNameFromPath(d.Path, d.SourceName)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// PruneSkillDocs deletes the docs of a source whose path is not in keep, i.e.
+// skills removed or renamed upstream since the last sync. It returns the
+// number of docs deleted.
+func (s *Postgres) PruneSkillDocs(ctx context.Context, sourceID string, keep []string) (int, error) {
+	if keep == nil {
+		keep = []string{}
+	}
+	tag, err := s.pool.Exec(ctx, `DELETE FROM xcf.skill_docs WHERE source_id=$1 AND NOT (path = ANY($2))`, sourceID, keep)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *Postgres) GetSkillDoc(ctx context.Context, sourceID, path string) (SkillDoc, error) {
+	var d SkillDoc
+	err := s.pool.QueryRow(ctx, `
+		SELECT d.source_id, s.name, d.path, d.sha256, d.content, COALESCE(d.commit_sha,''), d.meta, d.fetched_at
+		FROM xcf.skill_docs d
+		JOIN xcf.skill_sources s ON s.source_id = d.source_id
+		WHERE d.source_id=$1 AND d.path=$2
+	`, sourceID, path).Scan(&d.SourceID, &d.SourceName, &d.Path, &d.SHA256, &d.Content, &d.Commit, &d.Meta, &d.FetchedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SkillDoc{}, fmt.Errorf("skill doc %s:%s: %w", sourceID, path, ErrNotFound)
+	}
+	if err != nil {
+		return SkillDoc{}, err
+	}
+	d.Name = skillNameFromPath(d.Path, d.SourceName)
+	return d, nil
+}
+
+func (f *File) ListSkillDocs(ctx context.Context) ([]SkillDoc, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	out := make([]SkillDoc, 0, len(f.data.SkillDocs))
+	for _, d := range f.data.SkillDocs {
+		out = append(out, f.skillDocLocked(d))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SourceName != out[j].SourceName {
+			return out[i].SourceName < out[j].SourceName
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out, nil
+}
+
+func (f *File) PruneSkillDocs(ctx context.Context, sourceID string, keep []string) (int, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	kept := make(map[string]bool, len(keep))
+	for _, p := range keep {
+		kept[p] = true
+	}
+	n := 0
+	for key, d := range f.data.SkillDocs {
+		if d.SourceID == sourceID && !kept[d.Path] {
+			delete(f.data.SkillDocs, key)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, f.flush()
+}
+
+func (f *File) GetSkillDoc(ctx context.Context, sourceID, path string) (SkillDoc, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	d, ok := f.data.SkillDocs[sourceID+":"+path]
+	if !ok {
+		return SkillDoc{}, fmt.Errorf("skill doc %s:%s: %w", sourceID, path, ErrNotFound)
+	}
+	return f.skillDocLocked(d), nil
+}
+
+func (f *File) skillDocLocked(d fileSkillDoc) SkillDoc {
+	src := f.data.SkillSources[d.SourceID]
+	return SkillDoc{
+		SourceID:   d.SourceID,
+		SourceName: src.Name,
+		Name:       skillNameFromPath(d.Path, src.Name),
+		Path:       d.Path,
+		SHA256:     d.SHA256,
+		Content:    d.Content,
+		Commit:     d.Commit,
+		Meta:       d.Meta,
+		FetchedAt:  d.FetchedAt,
+	}
+}
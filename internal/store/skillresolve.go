@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ResolvedSkill is the effective copy of one skill name across sources.
+type ResolvedSkill struct {
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Path     string `json:"path"`
+	SHA256   string `json:"sha256"`
+	Commit   string `json:"commit,omitempty"`
+	Priority int    `json:"priority"`
+	Pinned   bool   `json:"pinned,omitempty"`
+	// Reason says why Source won.
+	Reason string `json:"reason"`
+	// Shadowed lists the other copies of the skill and why each lost.
+	Shadowed []ShadowedSkill `json:"shadowed,omitempty"`
+	// Doc is the winning cached doc, content included.
+	Doc SkillDoc `json:"-"`
+}
+
+// ShadowedSkill is a copy of a skill that did not win.
+type ShadowedSkill struct {
+	Source   string `json:"source"`
+	Priority int    `json:"priority"`
+	Reason   string `json:"reason"`
+}
+
+// ResolveSkills picks one doc per skill name (the <name>/SKILL.md docs of
+// enabled sources), sorted by name:
+//
+//   - a pinned skill comes from its pinned source; when that source is
+//     disabled or lacks the skill the pin is ignored and Reason says so
+//   - otherwise the source with the highest priority wins
+//   - equal priorities are broken by source name, so the result does not
+//     depend on sync order
+//
+// Skills that only exist in disabled sources are left out.
+func ResolveSkills(ctx context.Context, st Store) ([]ResolvedSkill, error) {
+	srcs, err := st.ListSkillSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := st.ListSkillDocs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pins, err := st.ListSkillPins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resolveSkills(srcs, docs, pins), nil
+}
+
+func resolveSkills(srcs []SkillSource, docs []SkillDoc, pins []SkillPin) []ResolvedSkill {
+	byID := map[string]SkillSource{}
+	for _, s := range srcs {
+		byID[s.SourceID] = s
+	}
+	pinned := map[string]SkillPin{}
+	for _, p := range pins {
+		pinned[p.Skill] = p
+	}
+	type candidate struct {
+		doc SkillDoc
+		src SkillSource
+	}
+	byName := map[string][]candidate{}
+	for _, d := range docs {
+		if !strings.EqualFold(path.Base(d.Path), "SKILL.md") {
+			continue
+		}
+		byName[d.Name] = append(byName[d.Name], candidate{d, byID[d.SourceID]})
+	}
+
+	out := make([]ResolvedSkill, 0, len(byName))
+	for name, cands := range byName {
+		sort.Slice(cands, func(i, j int) bool {
+			if cands[i].src.Priority != cands[j].src.Priority {
+				return cands[i].src.Priority > cands[j].src.Priority
+			}
+			return cands[i].src.Name < cands[j].src.Name
+		})
+		var enabled []candidate
+		var disabled []ShadowedSkill
+		for _, c := range cands {
+			if c.src.Enabled {
+				enabled = append(enabled, c)
+			} else {
+				disabled = append(disabled, ShadowedSkill{Source: c.src.Name, Priority: c.src.Priority, Reason: "source disabled"})
+			}
+		}
+		if len(enabled) == 0 {
+			continue
+		}
+
+		win, pinnedTo := 0, -1
+		reason := "only source"
+		if len(enabled) > 1 {
+			reason = fmt.Sprintf("highest priority (%d)", enabled[0].src.Priority)
+			if enabled[1].src.Priority == enabled[0].src.Priority {
+				reason = fmt.Sprintf("priority %d, tie with %s broken by source name", enabled[0].src.Priority, enabled[1].src.Name)
+			}
+		}
+		if pin, ok := pinned[name]; ok {
+			for i, c := range enabled {
+				if c.src.SourceID == pin.SourceID {
+					pinnedTo = i
+				}
+			}
+			if pinnedTo >= 0 {
+				win, reason = pinnedTo, "pinned to "+pin.SourceName
+			} else {
+				reason = fmt.Sprintf("pin to %s ignored (source disabled or lacks the skill); %s", pin.SourceName, reason)
+			}
+		}
+
+		w := enabled[win]
+		r := ResolvedSkill{
+			Name: name, Source: w.src.Name, Path: w.doc.Path, SHA256: w.doc.SHA256, Commit: w.doc.Commit,
+			Priority: w.src.Priority, Pinned: pinnedTo >= 0, Reason: reason, Doc: w.doc,
+		}
+		for i, c := range enabled {
+			if i == win {
+				continue
+			}
+			why := fmt.Sprintf("shadowed by %s (priority %d > %d)", w.src.Name, w.src.Priority, c.src.Priority)
+			switch {
+			case r.Pinned:
+				why = "shadowed by pin to " + w.src.Name
+			case c.src.Priority == w.src.Priority:
+				why = fmt.Sprintf("shadowed by %s (same priority %d, earlier source name)", w.src.Name, w.src.Priority)
+			}
+			r.Shadowed = append(r.Shadowed, ShadowedSkill{Source: c.src.Name, Priority: c.src.Priority, Reason: why})
+		}
+		r.Shadowed = append(r.Shadowed, disabled...)
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func checkSkillPin(p SkillPin) error {
+	if p.Skill == "" || p.SourceID == "" {
+		return fmt.Errorf("skill pin: skill and source are required")
+	}
+	return nil
+}
+
+// PinSkill creates or replaces the pin of p.Skill.
+func (s *Postgres) PinSkill(ctx context.Context, p SkillPin) (SkillPin, error) {
+	if err := checkSkillPin(p); err != nil {
+		return SkillPin{}, err
+	}
+	err := s.pool.QueryRow(ctx, `
+		WITH src AS (
+		  SELECT source_id, name FROM xcf.skill_sources WHERE source_id=$2::uuid
+		), pin AS (
+		  INSERT INTO xcf.skill_pins (skill, source_id, pinned_by, reason)
+		  SELECT $1, source_id, $3, $4 FROM src
+		  ON CONFLICT (skill) DO UPDATE SET
+		    source_id=EXCLUDED.source_id,
+		    pinned_by=EXCLUDED.pinned_by,
+		    reason=EXCLUDED.reason,
+		    created_at=now()
+		  RETURNING created_at
+		)
+		SELECT src.name, pin.created_at FROM src, pin
+	`, p.Skill, p.SourceID, nullIfEmpty(p.PinnedBy), nullIfEmpty(p.Reason)).Scan(&p.SourceName, &p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SkillPin{}, fmt.Errorf("skill source %s: %w", p.SourceID, ErrNotFound)
+	}
+	if err != nil {
+		return SkillPin{}, err
+	}
+	return p, nil
+}
+
+// UnpinSkill removes the pin of skill; unpinned skills are not an error.
+func (s *Postgres) UnpinSkill(ctx context.Context, skill string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM xcf.skill_pins WHERE skill=$1`, skill)
+	return err
+}
+
+func (s *Postgres) ListSkillPins(ctx context.Context) ([]SkillPin, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT p.skill, p.source_id::text, s.name, COALESCE(p.pinned_by,''), COALESCE(p.reason,''), p.created_at
+		FROM xcf.skill_pins p
+		JOIN xcf.skill_sources s ON s.source_id = p.source_id
+		ORDER BY p.skill
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SkillPin
+	for rows.Next() {
+		var p SkillPin
+		if err := rows.Scan(&p.Skill, &p.SourceID, &p.SourceName, &p.PinnedBy, &p.Reason, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (f *File) PinSkill(ctx context.Context, p SkillPin) (SkillPin, error) {
+	if err := checkSkillPin(p); err != nil {
+		return SkillPin{}, err
+	}
+	f.lock()
+	defer f.mu.Unlock()
+	src, ok := f.data.SkillSources[p.SourceID]
+	if !ok {
+		return SkillPin{}, fmt.Errorf("skill source %s: %w", p.SourceID, ErrNotFound)
+	}
+	p.SourceName, p.CreatedAt = src.Name, time.Now().UTC()
+	f.data.SkillPins[p.Skill] = p
+	if err := f.flush(); err != nil {
+		return SkillPin{}, err
+	}
+	return p, nil
+}
+
+func (f *File) UnpinSkill(ctx context.Context, skill string) error {
+	f.lock()
+	defer f.mu.Unlock()
+	if _, ok := f.data.SkillPins[skill]; !ok {
+		return nil
+	}
+	delete(f.data.SkillPins, skill)
+	return f.flush()
+}
+
+func (f *File) ListSkillPins(ctx context.Context) ([]SkillPin, error) {
+	f.lock()
+	defer f.mu.Unlock()
+	out := make([]SkillPin, 0, len(f.data.SkillPins))
+	for _, p := range f.data.SkillPins {
+		p.SourceName = f.data.SkillSources[p.SourceID].Name
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Skill < out[j].Skill })
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrVersionConflict is returned by CompareAndSwapKV when the stored
+	// version no longer matches the expected one.
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// Store is the persistence boundary for runs, plan approvals, the MCP
+// registry and audit trail, skills and KV.
+//
+// Implementations:
+//   - Postgres: the production backend (postgres:// DSN)
+//   - File: embedded single-file JSON backend (file:// DSN) for laptops and tests
+type Store interface {
+	Close()
+
+	CreateRun(ctx context.Context, r Run) (string, error)
+	StartRun(ctx context.Context, runID string) error
+	FinishRun(ctx context.Context, runID string, status string, resultJSON []byte) error
+	Heartbeat(ctx context.Context, runID string) error
+	ReapStaleRuns(ctx context.Context, staleAfter time.Duration) ([]string, error)
+	GetRun(ctx context.Context, runID string) (Run, error)
+	ListRuns(ctx context.Context, f RunFilter) ([]Run, error)
+	RunStats(ctx context.Context) ([]RunCount, error)
+	AddRunArtifact(ctx context.Context, a RunArtifact) (string, error)
+	ListRunArtifacts(ctx context.Context, runID string) ([]RunArtifact, error)
+
+	UpsertMCPServer(ctx context.Context, srv MCPServer) (string, error)
+	ListMCPServers(ctx context.Context) ([]MCPServer, error)
+	UpdateMCPToolsCache(ctx context.Context, serverID string, toolsJSON []byte, etag string) error
+	TouchMCPToolsCache(ctx context.Context, serverID string) error
+	ListMCPToolsCache(ctx context.Context) ([]MCPToolsCache, error)
+	RecordMCPServerHealth(ctx context.Context, serverID string, checkErr error) error
+	RecordAudit(ctx context.Context, e AuditEvent) error
+	ListAudit(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+
+	RequestApproval(ctx context.Context, a Approval) (Approval, error)
+	DecideApproval(ctx context.Context, approvalID string, d ApprovalDecision) (Approval, error)
+	GetApproval(ctx context.Context, approvalID string) (Approval, error)
+	ListApprovals(ctx context.Context, f ApprovalFilter) ([]Approval, error)
+
+	AddSkillSource(ctx context.Context, src SkillSource) (string, error)
+	ListSkillSources(ctx context.Context) ([]SkillSource, error)
+	RemoveSkillSource(ctx context.Context, sourceID string) error
+	PinSkill(ctx context.Context, p SkillPin) (SkillPin, error)
+	UnpinSkill(ctx context.Context, skill string) error
+	ListSkillPins(ctx context.Context) ([]SkillPin, error)
+	UpsertSkillDoc(ctx context.Context, d SkillDoc) error
+	PruneSkillDocs(ctx context.Context, sourceID string, keep []string) (int, error)
+	SearchSkills(ctx context.Context, query string, limit int) ([]SkillHit, error)
+	ListSkillDocs(ctx context.Context) ([]SkillDoc, error)
+	GetSkillDoc(ctx context.Context, sourceID, path string) (SkillDoc, error)
+
+	GetKV(ctx context.Context, namespace, key string) (KV, error)
+	ListKV(ctx context.Context, namespace, prefix string) ([]KV, error)
+	PutKV(ctx context.Context, namespace, key string, value []byte) (int64, error)
+	CompareAndSwapKV(ctx context.Context, namespace, key string, expected int64, value []byte) (int64, error)
+	DeleteKV(ctx context.Context, namespace, key string) error
+
+	Prune(ctx context.Context, p RetentionPolicy) (PruneReport, error)
+}
+
+// Open selects a backend from the DSN: file:///path/state.json opens the
+// embedded file store, anything else is handed to pgx.
+func Open(ctx context.Context, dsn string) (Store, error) {
+	if path, ok := strings.CutPrefix(dsn, "file://"); ok {
+		return OpenFile(path)
+	}
+	return OpenPostgres(ctx, dsn)
+}
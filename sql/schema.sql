@@ -68,6 +68,14 @@ CREATE TABLE IF NOT EXISTS xcf.runs (
 CREATE INDEX IF NOT EXISTS runs_stack_env_phase_started
   ON xcf.runs(stack, env, phase, started_at DESC);
 
+-- status: queued|running|ok|failed|cancelled|timed_out (transitions enforced in internal/store).
+-- heartbeat_at is refreshed by the owning process; the reaper times out stale running runs.
+ALTER TABLE xcf.runs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS runs_active_heartbeat
+  ON xcf.runs(heartbeat_at)
+  WHERE status IN ('queued', 'running');
+
 CREATE TABLE IF NOT EXISTS xcf.run_artifacts (
   artifact_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
   run_id      UUID NOT NULL REFERENCES xcf.runs(run_id) ON DELETE CASCADE,
@@ -81,6 +89,53 @@ CREATE TABLE IF NOT EXISTS xcf.run_artifacts (
 CREATE INDEX IF NOT EXISTS run_artifacts_run_id
   ON xcf.run_artifacts(run_id);
 
+-- ------------------------------------------------------------
+-- Change notifications (LISTEN xcf_runs / xcf_agent_events)
+-- Payloads stay small (NOTIFY is capped at 8000 bytes); listeners
+-- fetch full rows when they need them.
+-- ------------------------------------------------------------
+
+CREATE OR REPLACE FUNCTION xcf.notify_run_change() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('xcf_runs', json_build_object(
+    'kind',   'run',
+    'op',     TG_OP,
+    'run_id', NEW.run_id,
+    'stack',  NEW.stack,
+    'env',    NEW.env,
+    'phase',  NEW.phase,
+    'status', NEW.status
+  )::text);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Heartbeat-only updates do not notify.
+DROP TRIGGER IF EXISTS runs_notify ON xcf.runs;
+CREATE TRIGGER runs_notify
+  AFTER INSERT OR UPDATE OF status, finished_at, result ON xcf.runs
+  FOR EACH ROW EXECUTE FUNCTION xcf.notify_run_change();
+
+CREATE OR REPLACE FUNCTION xcf.notify_agent_event() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('xcf_agent_events', json_build_object(
+    'kind',       'event',
+    'op',         TG_OP,
+    'event_id',   NEW.event_id,
+    'session_id', NEW.session_id,
+    'level',      NEW.level,
+    'event_type', NEW.event_type,
+    'message',    left(NEW.message, 512)
+  )::text);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS agent_events_notify ON xcf.agent_events;
+CREATE TRIGGER agent_events_notify
+  AFTER INSERT OR UPDATE ON xcf.agent_events
+  FOR EACH ROW EXECUTE FUNCTION xcf.notify_agent_event();
+
 -- ------------------------------------------------------------
 -- Leases (distributed lock) for multi-instance Agent runs
 -- ------------------------------------------------------------
@@ -113,6 +168,22 @@ CREATE TABLE IF NOT EXISTS xcf.mcp_servers (
   metadata     JSONB NOT NULL DEFAULT '{}'::jsonb
 );
 
+-- Health as observed by `mcp servers refresh-tools` / `mcp servers status --probe`.
+ALTER TABLE xcf.mcp_servers ADD COLUMN IF NOT EXISTS health TEXT NOT NULL DEFAULT 'unknown';
+ALTER TABLE xcf.mcp_servers ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE xcf.mcp_servers ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMPTZ;
+
+-- Where the client reads the bearer token for auth_type='bearer'
+-- (env:NAME or file:PATH); the token itself is never stored.
+ALTER TABLE xcf.mcp_servers ADD COLUMN IF NOT EXISTS secret_ref TEXT;
+
+-- Gateway policy: glob patterns over the server's tool names. Deny wins; an
+-- empty allow list allows everything not denied.
+ALTER TABLE xcf.mcp_servers ADD COLUMN IF NOT EXISTS tools_allow TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE xcf.mcp_servers ADD COLUMN IF NOT EXISTS tools_deny TEXT[] NOT NULL DEFAULT '{}';
+-- Tools (besides "*.apply") that need xcf:apply and an approved plan.
+ALTER TABLE xcf.mcp_servers ADD COLUMN IF NOT EXISTS tools_apply TEXT[] NOT NULL DEFAULT '{}';
+
 CREATE TABLE IF NOT EXISTS xcf.mcp_tools_cache (
   server_id  UUID PRIMARY KEY REFERENCES xcf.mcp_servers(server_id) ON DELETE CASCADE,
   fetched_at TIMESTAMPTZ NOT NULL DEFAULT now(),
@@ -120,6 +191,55 @@ CREATE TABLE IF NOT EXISTS xcf.mcp_tools_cache (
   etag       TEXT
 );
 
+-- Audit trail: one row per MCP tools/call (local or federated). arguments
+-- are stored after redaction (see internal/mcp/audit.go).
+-- outcome: ok|error|rejected|forbidden|cancelled|throttled
+CREATE TABLE IF NOT EXISTS xcf.mcp_audit (
+  audit_id    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  ts          TIMESTAMPTZ NOT NULL DEFAULT now(),
+  actor       TEXT,
+  session_id  TEXT,
+  tool        TEXT NOT NULL,
+  arguments   JSONB NOT NULL DEFAULT '{}'::jsonb,
+  duration_ms BIGINT NOT NULL DEFAULT 0,
+  outcome     TEXT NOT NULL,
+  error       TEXT
+);
+
+CREATE INDEX IF NOT EXISTS mcp_audit_ts
+  ON xcf.mcp_audit(ts DESC);
+
+CREATE INDEX IF NOT EXISTS mcp_audit_tool_ts
+  ON xcf.mcp_audit(tool, ts DESC);
+
+CREATE INDEX IF NOT EXISTS mcp_audit_actor_ts
+  ON xcf.mcp_audit(actor, ts DESC);
+
+-- Plan approvals: apply is refused unless the plan it is handed hashes to an
+-- approved, unexpired plan_hash of the same stack/env (see internal/store/approvals.go).
+-- status: pending|approved|rejected (approved -> rejected revokes)
+CREATE TABLE IF NOT EXISTS xcf.approvals (
+  approval_id  UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  stack        TEXT NOT NULL,
+  env          TEXT NOT NULL DEFAULT '',
+  plan_hash    TEXT NOT NULL,
+  plan         JSONB NOT NULL DEFAULT '{}'::jsonb,
+  run_id       UUID REFERENCES xcf.runs(run_id) ON DELETE SET NULL,
+  status       TEXT NOT NULL DEFAULT 'pending',
+  requested_by TEXT,
+  requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  decided_by   TEXT,
+  decided_at   TIMESTAMPTZ,
+  reason       TEXT,
+  expires_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS approvals_stack_env_hash
+  ON xcf.approvals(stack, env, plan_hash);
+
+CREATE INDEX IF NOT EXISTS approvals_requested
+  ON xcf.approvals(requested_at DESC);
+
 -- ------------------------------------------------------------
 -- Skills: external sources + cached docs (Cloud Run friendly)
 -- ------------------------------------------------------------
@@ -146,6 +266,36 @@ CREATE TABLE IF NOT EXISTS xcf.skill_docs (
   PRIMARY KEY (source_id, path)
 );
 
+-- priority: higher shadows same-named skills of lower sources (store.ResolveSkills).
+ALTER TABLE xcf.skill_sources ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 0;
+
+-- Explicit pins: the skill is always taken from this source.
+CREATE TABLE IF NOT EXISTS xcf.skill_pins (
+  skill      TEXT PRIMARY KEY,
+  source_id  UUID NOT NULL REFERENCES xcf.skill_sources(source_id) ON DELETE CASCADE,
+  pinned_by  TEXT,
+  reason     TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- commit_sha: git commit the doc was read at (git sources).
+ALTER TABLE xcf.skill_docs ADD COLUMN IF NOT EXISTS commit_sha TEXT;
+
+-- meta: parsed SKILL.md frontmatter (name, description, version, tags,
+-- applies_to.phases/tools).
+ALTER TABLE xcf.skill_docs ADD COLUMN IF NOT EXISTS meta JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS skill_docs_meta
+  ON xcf.skill_docs USING GIN (meta jsonb_path_ops);
+
+-- Full-text search (store.SearchSkills). 'simple' config: no stemming, works
+-- for mixed-language runbooks.
+ALTER TABLE xcf.skill_docs ADD COLUMN IF NOT EXISTS search tsvector
+  GENERATED ALWAYS AS (to_tsvector('simple', path || ' ' || content)) STORED;
+
+CREATE INDEX IF NOT EXISTS skill_docs_search
+  ON xcf.skill_docs USING GIN (search);
+
 -- ------------------------------------------------------------
 -- Generic KV for small state (feature flags, cursors, etc.)
 -- ------------------------------------------------------------
@@ -154,8 +304,12 @@ CREATE TABLE IF NOT EXISTS xcf.kv (
   namespace  TEXT NOT NULL,
   key        TEXT NOT NULL,
   value      JSONB NOT NULL,
+  version    BIGINT NOT NULL DEFAULT 1,
   updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
   PRIMARY KEY (namespace, key)
 );
 
+-- version is bumped on every write; used for compare-and-swap.
+ALTER TABLE xcf.kv ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
 COMMIT;
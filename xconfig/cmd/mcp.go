@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -10,20 +11,26 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"xconfig/internal/authn"
 	"xconfig/internal/xcfstore"
 )
 
-// Minimal MCP-like server for xconfig (exec engine).
+// Minimal MCP server for xconfig (exec engine).
 // Exposes:
 // - GET  /healthz
-// - POST /mcp (JSON-RPC: initialize, tools/list, tools/call)
+// - POST /mcp (JSON-RPC: initialize, notifications/initialized, ping, tools/list, tools/call)
 //
 // This is a skeleton intended to be called by xcloud-server as an external MCP server.
+// With --auth-tokens or --auth-issuer/--auth-audience/--auth-jwks set,
+// /mcp requires a bearer token; tools are filtered and checked by scope and
+// the caller is recorded as the run actor.
 
 type tool struct {
 	Name        string          `json:"name"`
 	Description string          `json:"description,omitempty"`
 	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+	// Scope an authenticated caller needs (default authn.RequiredScope).
+	Scope string `json:"-"`
 }
 
 var mcpCmd = &cobra.Command{
@@ -44,6 +51,17 @@ var mcpServeCmd = &cobra.Command{
 			}
 		}
 
+		var auth authn.Config
+		auth.TokensRef, _ = cmd.Flags().GetString("auth-tokens")
+		auth.Issuer, _ = cmd.Flags().GetString("auth-issuer")
+		auth.Audience, _ = cmd.Flags().GetString("auth-audience")
+		auth.JWKS, _ = cmd.Flags().GetString("auth-jwks")
+		auth.DefaultScopes, _ = cmd.Flags().GetStringSlice("auth-default-scopes")
+		verifier, err := auth.Verifier()
+		if err != nil {
+			return err
+		}
+
 		var st *xcfstore.Store
 		if DSN != "" {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -66,12 +84,42 @@ var mcpServeCmd = &cobra.Command{
 				Name:        "xconfig.playbook.run",
 				Description: "Run a playbook (skeleton; returns not-implemented).",
 				InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"inventory":{"type":"string"}},"required":["path"]}`),
+				// Playbooks change hosts.
+				Scope: authn.ScopeApply,
 			},
 		}
+		for i := range tools {
+			if tools[i].Scope == "" {
+				tools[i].Scope = authn.RequiredScope(tools[i].Name)
+			}
+		}
+		// allowed reports whether the caller may call t; unauthenticated
+		// requests only get here when auth is off.
+		allowed := func(ctx context.Context, t tool) bool {
+			id, ok := authn.FromContext(ctx)
+			return !ok || id.HasScope(t.Scope)
+		}
 
 		mux := http.NewServeMux()
 		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
 		mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+			if verifier != nil {
+				tok, err := authn.BearerToken(r)
+				var id authn.Identity
+				if err == nil {
+					id, err = verifier.Verify(r.Context(), tok)
+				}
+				if err != nil {
+					challenge := `Bearer realm="xconfig"`
+					if !errors.Is(err, authn.ErrNoToken) {
+						challenge += `, error="invalid_token"`
+					}
+					w.Header().Set("WWW-Authenticate", challenge)
+					http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+					return
+				}
+				r = r.WithContext(authn.WithIdentity(r.Context(), id))
+			}
 			if r.Method != http.MethodPost {
 				w.WriteHeader(http.StatusMethodNotAllowed)
 				return
@@ -92,26 +140,48 @@ var mcpServeCmd = &cobra.Command{
 				req.JSONRPC = "2.0"
 			}
 
-			write := func(id any, result any, errMsg string) {
+			write := func(id any, result any) {
 				w.Header().Set("Content-Type", "application/json")
-				if errMsg != "" {
-					_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": id, "error": map[string]any{"code": -32000, "message": errMsg}})
-					return
-				}
 				_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
 			}
+			writeErr := func(id any, code int, msg string) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": id, "error": map[string]any{"code": code, "message": msg}})
+			}
 
 			switch req.Method {
 			case "initialize":
+				var p struct {
+					ProtocolVersion string `json:"protocolVersion"`
+				}
+				if len(req.Params) > 0 {
+					if err := json.Unmarshal(req.Params, &p); err != nil {
+						writeErr(req.ID, -32602, "invalid params")
+						return
+					}
+				}
 				write(req.ID, map[string]any{
-					"server": map[string]any{"name": "xconfig", "version": "0.1"},
+					"protocolVersion": negotiateMCPVersion(p.ProtocolVersion),
 					"capabilities": map[string]any{
-						"tools": true,
+						"tools": map[string]any{"listChanged": false},
 					},
-				}, "")
+					"serverInfo": map[string]any{"name": "xconfig", "version": "0.1"},
+				})
+				return
+			case "notifications/initialized":
+				w.WriteHeader(http.StatusAccepted)
+				return
+			case "ping":
+				write(req.ID, map[string]any{})
 				return
 			case "tools/list":
-				write(req.ID, map[string]any{"tools": tools}, "")
+				visible := []tool{}
+				for _, t := range tools {
+					if allowed(r.Context(), t) {
+						visible = append(visible, t)
+					}
+				}
+				write(req.ID, map[string]any{"tools": visible})
 				return
 			case "tools/call":
 				var p struct {
@@ -119,16 +189,22 @@ var mcpServeCmd = &cobra.Command{
 					Arguments json.RawMessage `json:"arguments"`
 				}
 				if err := json.Unmarshal(req.Params, &p); err != nil || p.Name == "" {
-					write(req.ID, nil, "invalid params")
+					writeErr(req.ID, -32602, "invalid params")
 					return
 				}
+				for _, t := range tools {
+					if t.Name == p.Name && !allowed(r.Context(), t) {
+						writeErr(req.ID, -32003, "forbidden: "+t.Name+" requires scope "+t.Scope)
+						return
+					}
+				}
 
 				// Closed loop: write a run record for each tool call (if DSN configured).
 				var runID string
 				if st != nil {
 					ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 					defer cancel()
-					rid, err := st.CreateRun(ctx, "xconfig", "", "mcp.tools/call", "running", "", "", []byte(fmt.Sprintf(`{"tool":%q}`, p.Name)))
+					rid, err := st.CreateRun(ctx, "xconfig", "", "mcp.tools/call", "running", authn.Actor(r.Context()), "", []byte(fmt.Sprintf(`{"tool":%q}`, p.Name)))
 					if err == nil {
 						runID = rid
 					}
@@ -139,23 +215,23 @@ var mcpServeCmd = &cobra.Command{
 					if st != nil && runID != "" {
 						_ = st.FinishRun(r.Context(), runID, "ok", []byte(`{"ok":true}`))
 					}
-					write(req.ID, map[string]any{"ok": true}, "")
+					write(req.ID, mcpToolResult(map[string]any{"ok": true}, ""))
 					return
 				case "xconfig.playbook.run":
 					if st != nil && runID != "" {
 						_ = st.FinishRun(r.Context(), runID, "failed", []byte(`{"error":"not implemented"}`))
 					}
-					write(req.ID, nil, "not implemented")
+					write(req.ID, mcpToolResult(nil, "not implemented"))
 					return
 				default:
 					if st != nil && runID != "" {
 						_ = st.FinishRun(r.Context(), runID, "failed", []byte(`{"error":"unknown tool"}`))
 					}
-					write(req.ID, nil, "unknown tool")
+					writeErr(req.ID, -32602, "unknown tool: "+p.Name)
 					return
 				}
 			default:
-				write(req.ID, nil, "method not found")
+				writeErr(req.ID, -32601, "method not found")
 				return
 			}
 		})
@@ -167,7 +243,40 @@ var mcpServeCmd = &cobra.Command{
 
 func init() {
 	mcpServeCmd.Flags().String("addr", "", "listen addr (default :8081, or :$PORT)")
+	mcpServeCmd.Flags().String("auth-tokens", "", "static bearer tokens file as a secret ref (env:NAME|file:PATH); lines of <token> <subject> [scope...]")
+	mcpServeCmd.Flags().String("auth-issuer", "", "accept JWTs from this issuer (with --auth-audience and --auth-jwks)")
+	mcpServeCmd.Flags().String("auth-audience", "", "required JWT audience")
+	mcpServeCmd.Flags().String("auth-jwks", "", "JWKS file path or http(s) URL used to verify JWT signatures")
+	mcpServeCmd.Flags().StringSlice("auth-default-scopes", []string{authn.ScopeRead}, "scopes granted to JWTs without a scope claim")
 	mcpCmd.AddCommand(mcpServeCmd)
 	addCommandOnce(rootCmd, mcpCmd)
 }
 
+// MCP protocol revisions spoken by the xconfig server, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// negotiateMCPVersion echoes a supported client version, else offers the latest.
+func negotiateMCPVersion(requested string) string {
+	for _, v := range mcpProtocolVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return mcpProtocolVersions[0]
+}
+
+// mcpToolResult builds a tools/call result (content[], structuredContent, isError).
+func mcpToolResult(out map[string]any, errMsg string) map[string]any {
+	if errMsg != "" {
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": errMsg}},
+			"isError": true,
+		}
+	}
+	b, _ := json.Marshal(out)
+	return map[string]any{
+		"content":           []map[string]any{{"type": "text", "text": string(b)}},
+		"structuredContent": out,
+		"isError":           false,
+	}
+}
@@ -0,0 +1,162 @@
+// Package authn authenticates inbound MCP callers of `xconfig mcp serve`.
+//
+// It is a copy of XCloudFlow's internal/authn, which is the source of truth:
+// change that package first and copy the files here, keeping the same flag
+// names, tokens file format, JWT rules and scope names so both servers share
+// one auth configuration. Only this comment and import paths may differ.
+//
+// A Verifier turns the bearer token of a request into an Identity: either a
+// static token from a tokens file (see ParseTokens) or a JWT checked against
+// an issuer, an audience and a JWKS (see JWTVerifier). The Identity carries
+// the caller's subject, recorded as the actor on runs, and the scopes that
+// decide which tools it may call.
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"xconfig/internal/secrets"
+)
+
+// Scopes understood by the MCP server. Apply implies read.
+const (
+	ScopeRead  = "xcf:read"
+	ScopeApply = "xcf:apply"
+)
+
+var (
+	// ErrNoToken means the request carried no bearer token.
+	ErrNoToken = errors.New("missing bearer token")
+	// ErrInvalidToken wraps every rejection of a presented token.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope reports whether the identity was granted scope.
+func (id Identity) HasScope(scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope || (s == ScopeApply && scope == ScopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier checks a bearer token.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (Identity, error)
+}
+
+// Chain accepts a token if any of its verifiers does. The first rejection
+// other than a non-matching static token is reported.
+type Chain []Verifier
+
+func (c Chain) Verify(ctx context.Context, token string) (Identity, error) {
+	err := error(ErrInvalidToken)
+	for _, v := range c {
+		id, verr := v.Verify(ctx, token)
+		if verr == nil {
+			return id, nil
+		}
+		if _, static := v.(Tokens); !static {
+			err = verr
+		}
+	}
+	return Identity{}, err
+}
+
+// BearerToken extracts the token of an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, error) {
+	scheme, tok, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(tok) == "" {
+		return "", ErrNoToken
+	}
+	return strings.TrimSpace(tok), nil
+}
+
+// RequiredScope is the scope a tool needs unless it declares its own:
+// "*.apply" tools (and "apply" itself) change infrastructure and need
+// ScopeApply, everything else is read-only.
+func RequiredScope(tool string) string {
+	if tool == "apply" || strings.HasSuffix(tool, ".apply") {
+		return ScopeApply
+	}
+	return ScopeRead
+}
+
+type ctxKey struct{}
+
+// WithIdentity attaches the caller to ctx.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the caller, if the request was authenticated.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxKey{}).(Identity)
+	return id, ok
+}
+
+// Actor is the caller's subject, or "" for unauthenticated (local) callers.
+func Actor(ctx context.Context) string {
+	id, _ := FromContext(ctx)
+	return id.Subject
+}
+
+// Config is the inbound auth configuration of a server, as set by flags.
+type Config struct {
+	// TokensRef is a secret ref (env:NAME or file:PATH) to a tokens file,
+	// see ParseTokens.
+	TokensRef string
+	// Issuer, Audience and JWKS (file path or http(s) URL) enable JWT
+	// verification; all three are required together.
+	Issuer   string
+	Audience string
+	JWKS     string
+	// DefaultScopes are granted to JWTs that carry no scope claim.
+	DefaultScopes []string
+}
+
+// Verifier builds the configured verifiers. It returns nil (no auth) when
+// nothing is configured.
+func (c Config) Verifier() (Verifier, error) {
+	var chain Chain
+	if c.TokensRef != "" {
+		text, err := secrets.Resolve(c.TokensRef)
+		if err != nil {
+			return nil, fmt.Errorf("auth tokens: %w", err)
+		}
+		toks, err := ParseTokens(text)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, toks)
+	}
+	if c.Issuer != "" || c.Audience != "" || c.JWKS != "" {
+		if c.Issuer == "" || c.Audience == "" || c.JWKS == "" {
+			return nil, errors.New("jwt auth needs issuer, audience and jwks")
+		}
+		chain = append(chain, &JWTVerifier{
+			Issuer:        c.Issuer,
+			Audience:      c.Audience,
+			Keys:          &JWKS{Location: c.JWKS},
+			DefaultScopes: c.DefaultScopes,
+		})
+	}
+	switch len(chain) {
+	case 0:
+		return nil, nil
+	case 1:
+		return chain[0], nil
+	}
+	return chain, nil
+}
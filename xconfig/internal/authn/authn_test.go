@@ -0,0 +1,240 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding.EncodeToString
+
+// signJWT signs claims with an RSA key (RS256) or an EC key. EC tokens are
+// always labelled ES256, whatever the key's curve.
+func signJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := b64(hdr) + "." + b64(body)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = s
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	}
+	return signed + "." + b64(sig)
+}
+
+func jwksJSON(t *testing.T, keys map[string]crypto.Signer) []byte {
+	t.Helper()
+	var set []map[string]string
+	for kid, k := range keys {
+		switch pub := k.Public().(type) {
+		case *rsa.PublicKey:
+			set = append(set, map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+				"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			set = append(set, map[string]string{"kty": "EC", "kid": kid, "crv": pub.Curve.Params().Name,
+				"x": b64(pub.X.FillBytes(make([]byte, size))), "y": b64(pub.Y.FillBytes(make([]byte, size)))})
+		}
+	}
+	b, _ := json.Marshal(map[string]any{"keys": set})
+	return b
+}
+
+// testKeys generates one RSA and one EC key for tests.
+func testKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rk, ek
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rk, ek := testKeys(t)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, jwksJSON(t, map[string]crypto.Signer{"r1": rk, "e1": ek, "e384": p384}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v := &JWTVerifier{
+		Issuer:        "https://issuer.example",
+		Audience:      "xcloudflow",
+		Keys:          &JWKS{Location: jwksPath},
+		DefaultScopes: []string{ScopeRead},
+	}
+	ctx := context.Background()
+	now := time.Now().Unix()
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{"iss": "https://issuer.example", "aud": "xcloudflow", "sub": "u-1", "exp": now + 300, "iat": now}
+		for k, val := range extra {
+			c[k] = val
+		}
+		return c
+	}
+
+	id, err := v.Verify(ctx, signJWT(t, rk, "r1", claims(map[string]any{"scope": "xcf:read xcf:apply"})))
+	if err != nil || id.Subject != "u-1" || !id.HasScope(ScopeApply) {
+		t.Fatalf("RS256: %+v, %v", id, err)
+	}
+	id, err = v.Verify(ctx, signJWT(t, ek, "e1", claims(map[string]any{"email": "ci@proj.iam.gserviceaccount.com", "aud": []string{"other", "xcloudflow"}})))
+	if err != nil || id.Subject != "ci@proj.iam.gserviceaccount.com" || !id.HasScope(ScopeRead) || id.HasScope(ScopeApply) {
+		t.Fatalf("ES256 with default scopes: %+v, %v", id, err)
+	}
+	id, err = v.Verify(ctx, signJWT(t, rk, "r1", claims(map[string]any{"scp": []string{"xcf:apply"}})))
+	if err != nil || !id.HasScope(ScopeRead) {
+		t.Fatalf("scp array, apply implies read: %+v, %v", id, err)
+	}
+
+	other, _ := testKeys(t)
+	for name, tok := range map[string]string{
+		"wrong issuer":   signJWT(t, rk, "r1", claims(map[string]any{"iss": "https://evil.example"})),
+		"wrong audience": signJWT(t, rk, "r1", claims(map[string]any{"aud": "someone-else"})),
+		"expired":        signJWT(t, rk, "r1", claims(map[string]any{"exp": now - 3600})),
+		"not yet valid":  signJWT(t, rk, "r1", claims(map[string]any{"nbf": now + 3600})),
+		"no exp":         signJWT(t, rk, "r1", claims(map[string]any{"exp": nil})),
+		"unknown key":    signJWT(t, other, "r1", claims(nil)),
+		"unknown kid":    signJWT(t, rk, "nope", claims(nil)),
+		"alg mismatch":   signJWT(t, ek, "r1", claims(nil)),
+		"ES256 on P-384": signJWT(t, p384, "e384", claims(nil)),
+		"garbage":        "not-a-jwt",
+	} {
+		if _, err := v.Verify(ctx, tok); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestJWKSURLRefreshesOnUnknownKid(t *testing.T) {
+	rk, ek := testKeys(t)
+	var fetches atomic.Int32
+	var current atomic.Value
+	current.Store(jwksJSON(t, map[string]crypto.Signer{"old": rk}))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(current.Load().([]byte))
+	}))
+	defer ts.Close()
+
+	keys := &JWKS{Location: ts.URL}
+	v := &JWTVerifier{Issuer: "iss", Audience: "aud", Keys: keys}
+	tok := func(k crypto.Signer, kid string) string {
+		return signJWT(t, k, kid, map[string]any{"iss": "iss", "aud": "aud", "sub": "s", "exp": time.Now().Add(time.Hour).Unix()})
+	}
+	ctx := context.Background()
+	for range 3 {
+		if _, err := v.Verify(ctx, tok(rk, "old")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("fetched %d times, want 1 (cached)", fetches.Load())
+	}
+
+	// Rotation: the new kid is only picked up once the refresh interval passed.
+	current.Store(jwksJSON(t, map[string]crypto.Signer{"old": rk, "new": ek}))
+	if _, err := v.Verify(ctx, tok(ek, "new")); err == nil {
+		t.Fatal("new kid accepted before refresh interval")
+	}
+	keys.mu.Lock()
+	keys.fetchedAt = keys.fetchedAt.Add(-2 * jwksMinRefresh)
+	keys.mu.Unlock()
+	if _, err := v.Verify(ctx, tok(ek, "new")); err != nil {
+		t.Fatalf("after rotation: %v", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	toks, err := ParseTokens("# ops tokens\nt-read alice\n\nt-apply ci xcf:read xcf:apply\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	id, err := toks.Verify(ctx, "t-read")
+	if err != nil || id.Subject != "alice" || !id.HasScope(ScopeRead) || id.HasScope(ScopeApply) {
+		t.Fatalf("t-read: %+v, %v", id, err)
+	}
+	if id, err := toks.Verify(ctx, "t-apply"); err != nil || id.Subject != "ci" || !id.HasScope(ScopeApply) {
+		t.Fatalf("t-apply: %+v, %v", id, err)
+	}
+	if _, err := toks.Verify(ctx, "t-rea"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("unknown token: %v", err)
+	}
+	if _, err := ParseTokens("lonely-token\n"); err == nil {
+		t.Fatal("line without subject accepted")
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	for tool, want := range map[string]string{
+		"stackflow.validate":     ScopeRead,
+		"stackflow.apply":        ScopeApply,
+		"infra.terraform.apply":  ScopeApply,
+		"stackflow.applyish":     ScopeRead,
+		"stackflow.plan.dns":     ScopeRead,
+		"cloudrun.service.apply": ScopeApply,
+	} {
+		if got := RequiredScope(tool); got != want {
+			t.Errorf("RequiredScope(%q) = %q, want %q", tool, got, want)
+		}
+	}
+}
+
+func TestConfigVerifier(t *testing.T) {
+	if v, err := (Config{}).Verifier(); v != nil || err != nil {
+		t.Fatalf("empty config: %v, %v", v, err)
+	}
+	if _, err := (Config{Issuer: "iss"}).Verifier(); err == nil {
+		t.Fatal("partial jwt config accepted")
+	}
+	t.Setenv("XCF_TEST_AUTH_TOKENS", "tok bob")
+	v, err := Config{TokensRef: "env:XCF_TEST_AUTH_TOKENS", Issuer: "iss", Audience: "aud", JWKS: "/nonexistent"}.Verifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := v.Verify(context.Background(), "tok"); err != nil || id.Subject != "bob" {
+		t.Fatalf("chain static: %+v, %v", id, err)
+	}
+	if _, err := v.Verify(context.Background(), "a.b.c"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("chain jwt: %v", err)
+	}
+}